@@ -16,7 +16,10 @@ import (
 )
 
 func init() {
-	configureCmd.Flags().String("file", "layerform.json", "the configuration file with layer definitions")
+	configureCmd.Flags().StringArrayP("file", "f", []string{}, "a configuration file with layer definitions, can be given many times, defaults to the first of layerform.json, layerform.yaml, layerform.yml or layerform.hcl found in the current directory")
+	configureCmd.Flags().Bool("dry-run", false, "print which layers and instances would be affected without saving anything")
+	configureCmd.Flags().Bool("allow-orphans", false, "allow removing layers that still have instances")
+	configureCmd.Flags().Bool("merge", false, "add the layers of the file to the current definitions instead of replacing them")
 	rootCmd.AddCommand(configureCmd)
 }
 
@@ -52,7 +55,44 @@ Here's an example layer definition configurations:
       ]
     }
   ]
-}`,
+}
+
+The same definitions can be written in YAML, in a layerform.yaml file:
+
+layers:
+  - name: eks
+    files:
+      - layers/eks.tf
+      - layers/eks/**
+  - name: kibana
+    files:
+      - layers/kibana.tf
+      - layers/kibana/**
+    dependencies:
+      - eks
+
+Or in HCL, in a layerform.hcl file:
+
+layer "eks" {
+  files = ["layers/eks.tf", "layers/eks/**"]
+}
+
+layer "kibana" {
+  files      = ["layers/kibana.tf", "layers/kibana/**"]
+  depends_on = ["eks"]
+}
+
+The format is detected from the extension of the file.
+
+Definitions can be split across many files, either by passing --file more than once or by listing other files under an include key, like "include": ["apps/layerform.json"] in JSON or include = ["apps/layerform.hcl"] in HCL. Included paths and the files of each layer are relative to the directory of the file they are written in. Layers can depend on layers of any other file, but each name can only be defined once.
+
+Terraform modules shared between layers are listed under the modules key of a layer, like "modules": ["../modules/vpc"]. Their files are bundled into the layer definition, so changing them changes the layer, and they are written next to the layer files when it runs, so relative sources like source = "../modules/vpc" keep working.
+
+After saving, configure prints the layers that were added, removed or changed, with the files changed in each of them, and the instances that became outdated. Use --dry-run to see that report without saving anything or running terraform.
+
+Removing a layer that still has instances is refused unless --allow-orphans is given.
+
+With --merge, the layers of the file are added to the current definitions, replacing the ones with the same name, and layers missing from the file are kept. Layers of the file can then depend on layers that were configured before. Use "layerform definitions delete" to remove a single layer.`,
 	Run: func(cmd *cobra.Command, _ []string) {
 		logger := hclog.Default()
 		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
@@ -68,12 +108,15 @@ Here's an example layer definition configurations:
 			return
 		}
 
-		fpath, err := cmd.Flags().GetString("file")
+		fpaths, err := cmd.Flags().GetStringArray("file")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --file flag, this is a bug in layerform"))
 			os.Exit(1)
 			return
 		}
+		if len(fpaths) == 0 {
+			fpaths = []string{layerfile.Find(".")}
+		}
 
 		layersBackend, err := cfg.GetDefinitionsBackend(ctx)
 		if err != nil {
@@ -89,9 +132,20 @@ Here's an example layer definition configurations:
 			return
 		}
 
-		configure := command.NewConfigure(layersBackend, instancesBackend)
+		signer, err := cfg.GetSigner(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+			return
+		}
+
+		configure := command.NewConfigure(layersBackend, instancesBackend, signer, cfg.GetCurrent().Terraform)
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		allowOrphans, _ := cmd.Flags().GetBool("allow-orphans")
+		merge, _ := cmd.Flags().GetBool("merge")
 
-		err = configure.Run(ctx, fpath)
+		err = configure.Run(ctx, fpaths, dryRun, allowOrphans, merge)
 		if err != nil {
 			if errors.Is(err, layerfile.ErrInvalidDefinitionName) {
 				fmt.Fprintln(
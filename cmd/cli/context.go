@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+}
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Manage the data stored in the current context",
+	Long:  `Manage the data stored in the current context using subcommands like "layerform context rotate-key"`,
+	Example: `# Encrypt the current context with the key stored in a file
+layerform context rotate-key --key-file ~/.layerform/key`,
+}
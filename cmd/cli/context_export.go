@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	contextExportCmd.Flags().StringP("output", "o", "", "file to write the archive to, defaults to stdout")
+	contextCmd.AddCommand(contextExportCmd)
+}
+
+var contextExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the current context to a tar.gz archive",
+	Long: `Export the current context to a tar.gz archive.
+
+The archive holds every layer definition, every layer instance along with its terraform state and every environment variable of the current context, plus a manifest with the layerform version that created it and the checksum of each file. It can be imported into a context of any type with "layerform context import".
+
+Terraform state and environment variables are stored unencrypted in the archive, keep it somewhere safe.`,
+	Example: `# Back up the current context
+layerform context export > backup.tar.gz`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		output, _ := cmd.Flags().GetString("output")
+
+		var w io.Writer = os.Stdout
+		if output == "" {
+			if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				fmt.Fprintln(os.Stderr, "refusing to write archive to a terminal, redirect stdout or use --output")
+				os.Exit(1)
+			}
+		} else {
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to create output file"))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+		}
+
+		backends, err := cfg.GetContextBackends(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get context backends"))
+			os.Exit(1)
+		}
+
+		err = command.NewExport(backends, versioninfo.Version).Run(ctx, w)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to export context"))
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
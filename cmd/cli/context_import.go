@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	contextImportCmd.Flags().String("on-conflict", string(command.ConflictPolicyFail), "what to do with data that differs between the archive and the context, one of \"skip\", \"overwrite\" or \"fail\"")
+	contextCmd.AddCommand(contextImportCmd)
+}
+
+var contextImportCmd = &cobra.Command{
+	Use:   "import <archive>",
+	Short: "Import an archive created by \"layerform context export\" into the current context",
+	Long: `Import an archive created by "layerform context export" into the current context.
+
+The checksums of the archive are verified before anything is written. Definitions, instances and environment variables that are identical in the archive and in the context are left alone. The ones that differ are handled according to --on-conflict: "skip" keeps what is in the context, "overwrite" replaces it with what is in the archive and "fail" aborts without writing anything.
+
+Use "-" to read the archive from stdin.`,
+	Example: `# Restore a backup into the current context
+layerform context import backup.tar.gz
+
+# Restore a backup replacing anything that changed since it was taken
+layerform context import backup.tar.gz --on-conflict overwrite`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		policy, err := command.ParseConflictPolicy(onConflict)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to open archive"))
+				os.Exit(1)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+		}
+
+		backends, err := cfg.GetContextBackends(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get context backends"))
+			os.Exit(1)
+		}
+
+		err = command.NewImport(backends).Run(ctx, r, policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to import context"))
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
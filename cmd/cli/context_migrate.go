@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	contextMigrateCmd.Flags().Bool("dry-run", false, "only print what would be migrated")
+	contextMigrateCmd.Flags().Bool("force", false, "overwrite definitions, instances and environment variables that already exist in the target context")
+	contextCmd.AddCommand(contextMigrateCmd)
+}
+
+var contextMigrateCmd = &cobra.Command{
+	Use:   "migrate <source-context> <target-context>",
+	Short: "Copy definitions, instances and environment variables between contexts",
+	Long: `Copy definitions, instances and environment variables between contexts.
+
+Any pair of context types is supported, e.g. from "local" to "s3" or from "s3" to "cloud". A summary of what changes in the target context is printed before anything is written, and once the migration finishes the target context is read again to verify that every definition SHA, instance state and environment variable matches the source.
+
+Definitions of the target context are replaced by the ones of the source context while instances and environment variables are merged. Migrating into a context that already has data that would be overwritten or removed requires --force.
+
+Contexts of type "cloud" don't keep previous versions of definitions, only the current ones are migrated into them. Instances spawned from a previous version can then only be killed with "layerform kill --use-current-definition", so migrating them requires --force too.`,
+	Example: `# See what would be copied from the local context to the s3 context
+layerform context migrate local-example s3-example --dry-run
+
+# Copy everything from the local context to the s3 context
+layerform context migrate local-example s3-example`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if args[0] == args[1] {
+			fmt.Fprintln(os.Stderr, "source and target contexts must be different")
+			os.Exit(1)
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+		}
+
+		sourceCfg, err := cfg.WithContext(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "invalid source context"))
+			os.Exit(1)
+		}
+
+		targetCfg, err := cfg.WithContext(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "invalid target context"))
+			os.Exit(1)
+		}
+
+		source, err := sourceCfg.GetContextBackends(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get source context backends"))
+			os.Exit(1)
+		}
+
+		target, err := targetCfg.GetContextBackends(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get target context backends"))
+			os.Exit(1)
+		}
+
+		migrate := command.NewMigrate(source, target)
+		err = migrate.Run(ctx, dryRun, force)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to migrate context"))
+			os.Exit(1)
+		}
+
+		if dryRun {
+			return
+		}
+
+		// backends are loaded again so verification reads what was
+		// actually persisted
+		migrated, err := targetCfg.GetContextBackends(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to reload target context backends"))
+			os.Exit(1)
+		}
+
+		err = migrate.Verify(ctx, migrated)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+)
+
+func init() {
+	contextCmd.AddCommand(contextPublicKeyCmd)
+}
+
+var contextPublicKeyCmd = &cobra.Command{
+	Use:   "public-key",
+	Short: "Print the public key of the key that signs layer definitions",
+	Long: `Print the public key of the key that signs layer definitions of the current context.
+
+The printed key can be given to "layerform config set-context --trusted-key" so other contexts only run layers signed by it.`,
+	Example: `# Trust the signing key of the current context in another context
+layerform config set-context production -t s3 --bucket example-bucket --region us-east-1 --trusted-key "$(layerform context public-key)"`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+		}
+
+		signer, err := cfg.GetSigner(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+
+		if signer == nil {
+			fmt.Fprintf(os.Stderr, "context %s has no signing key, set one with \"layerform config set-context --signing-key-file\"\n", cfg.CurrentContext)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(os.Stdout, signer.PublicKey())
+	},
+	SilenceErrors: true,
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	addEncryptionFlags(contextRotateKeyCmd, "", ", the new key")
+	contextCmd.AddCommand(contextRotateKeyCmd)
+}
+
+var contextRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt the current context with a new key",
+	Long: `Re-encrypt the current context with a new key.
+
+Terraform state and environment variables of contexts of type "local", "s3" and "gcs" can be encrypted at rest. Every file is decrypted with the key currently configured, or read as is when the context is not encrypted yet, encrypted again with the new key and the context is then updated to use the new key. Once a context is encrypted, files that are not encrypted are refused.
+
+Backups of contexts of type "local" hold plain content or content encrypted with the old key, so they are deleted once their file is re-encrypted and "layerform state restore-backup" can't go back to before the rotation. Previous versions kept by buckets with versioning enabled are not deleted.
+
+Contexts of type "git" keep every previous version in the history of the repository, so rotating is refused once their files were committed. Enable encryption when creating them with "layerform config set-context --encryption-key-env", or rewrite the history of the repository first.
+
+Keys are 32 random bytes encoded in base64, they can be generated with "openssl rand -base64 32".`,
+	Example: `# Encrypt the current context using a key read from an environment variable
+layerform context rotate-key --key-env LAYERFORM_KEY
+
+# Rotate to a key printed by a command
+layerform context rotate-key --key-command "pass show layerform/key"`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		enc := getEncryptionFlags(cmd, "")
+		if enc == nil {
+			fmt.Fprintln(os.Stderr, "one of --key-env, --key-file or --key-command is required")
+			os.Exit(1)
+		}
+
+		err := lfconfig.ValidateEncryption(*enc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "invalid encryption configuration"))
+			os.Exit(1)
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+		}
+
+		storages, err := cfg.GetRawStorages(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get context storages"))
+			os.Exit(1)
+		}
+
+		oldKey, err := cfg.GetEncryptionKey(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load current key"))
+			os.Exit(1)
+		}
+
+		newKey, err := storage.LoadEncryptionKey(ctx, enc.KeySource())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load new key"))
+			os.Exit(1)
+		}
+
+		err = command.NewRotateKey(storages).Run(ctx, oldKey, newKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to rotate key"))
+			os.Exit(1)
+		}
+
+		current := cfg.Contexts[cfg.CurrentContext]
+		current.Encryption = enc
+		cfg.Contexts[cfg.CurrentContext] = current
+		err = cfg.Save()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to save config file"))
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stdout, "Context \"%s\" is now encrypted with key %s.\n", cfg.CurrentContext, newKey.ID)
+	},
+	SilenceErrors: true,
+}
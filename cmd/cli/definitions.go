@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(definitionsCmd)
+}
+
+var definitionsCmd = &cobra.Command{
+	Use:   "definitions",
+	Short: "Manage the layer definitions of the current context",
+	Long:  `Manage the layer definitions of the current context using subcommands like "layerform definitions delete"`,
+	Example: `# Delete the definition of a single layer
+layerform definitions delete kibana`,
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	definitionsDeleteCmd.Flags().Bool("allow-orphans", false, "allow deleting a layer that still has instances")
+	definitionsCmd.AddCommand(definitionsDeleteCmd)
+}
+
+var definitionsDeleteCmd = &cobra.Command{
+	Use:   "delete <layer>",
+	Short: "Delete a single layer definition",
+	Long: `Delete a single layer definition, leaving every other definition untouched.
+
+A layer that other layers depend on can't be deleted. Deleting a layer that still has instances is refused unless --allow-orphans is given, the instances of a deleted layer can still be killed.`,
+	Example: `# Delete the definition of the kibana layer
+layerform definitions delete kibana`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+			return
+		}
+
+		definitionsBackend, err := cfg.GetDefinitionsBackend(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get layers backend"))
+			os.Exit(1)
+			return
+		}
+
+		instancesBackend, err := cfg.GetInstancesBackend(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get instance backend"))
+			os.Exit(1)
+			return
+		}
+
+		allowOrphans, _ := cmd.Flags().GetBool("allow-orphans")
+
+		err = command.NewDeleteDefinition(definitionsBackend, instancesBackend).Run(ctx, args[0], allowOrphans)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
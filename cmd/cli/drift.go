@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command/drift"
+)
+
+func init() {
+	driftCmd.Flags().Bool("all", false, "check every instance of the current context")
+	driftCmd.Flags().StringArray("var", []string{}, "a map of variables for the layer's Terraform files. I.e. 'foo=bar,baz=qux'")
+	rootCmd.AddCommand(driftCmd)
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift [layer] [instance]",
+	Short: "checks layer instances for changes made outside terraform",
+	Long: `The drift command checks layer instances for resources changed outside terraform.
+
+It runs a refresh-only terraform plan on each instance and reports the resources that no longer match the instance state, nothing is changed nor saved. Pass a layer to check all of its instances, a layer and an instance to check only that instance or --all to check every instance of the current context.
+
+The command exits with status 2 when any instance drifted and with status 1 when any instance could not be checked.`,
+	Example: `# Check a single instance
+layerform drift eks default
+
+# Check every instance, i.e. in a nightly job
+layerform drift --all`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
+
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --all flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		if all && len(args) > 0 {
+			fmt.Fprintln(os.Stderr, "--all can't be used together with a layer or an instance")
+			os.Exit(1)
+			return
+		}
+
+		if !all && len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "a layer is required, use --all to check every instance")
+			os.Exit(1)
+			return
+		}
+
+		vars, err := cmd.Flags().GetStringArray("var")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --var flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+			return
+		}
+
+		driftCommand, err := cfg.GetDriftCommand(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get drift command"))
+			os.Exit(1)
+			return
+		}
+
+		layerName := ""
+		if len(args) > 0 {
+			layerName = args[0]
+		}
+		instanceName := ""
+		if len(args) > 1 {
+			instanceName = args[1]
+		}
+
+		reports, err := driftCommand.Run(ctx, layerName, instanceName, vars)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+			return
+		}
+
+		drift.Print(os.Stdout, reports)
+
+		drifted := false
+		for _, r := range reports {
+			if r.Err != nil {
+				os.Exit(1)
+				return
+			}
+
+			drifted = drifted || r.Drifted()
+		}
+
+		if drifted {
+			os.Exit(2)
+		}
+	},
+}
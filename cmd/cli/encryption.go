@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+)
+
+func addEncryptionFlags(cmd *cobra.Command, prefix, usage string) {
+	cmd.Flags().String(prefix+"key-env", "", "environment variable holding the base64 encoded encryption key"+usage)
+	cmd.Flags().String(prefix+"key-file", "", "file holding the base64 encoded encryption key"+usage)
+	cmd.Flags().String(prefix+"key-command", "", "command that prints the base64 encoded encryption key"+usage)
+}
+
+// getEncryptionFlags returns nil when none of the flags added by
+// addEncryptionFlags were set.
+func getEncryptionFlags(cmd *cobra.Command, prefix string) *lfconfig.EncryptionConfig {
+	keyEnv, _ := cmd.Flags().GetString(prefix + "key-env")
+	keyFile, _ := cmd.Flags().GetString(prefix + "key-file")
+	keyCommand, _ := cmd.Flags().GetString(prefix + "key-command")
+
+	enc := &lfconfig.EncryptionConfig{
+		KeyEnv:     strings.TrimSpace(keyEnv),
+		KeyFile:    strings.TrimSpace(keyFile),
+		KeyCommand: strings.TrimSpace(keyCommand),
+	}
+	if enc.KeyEnv == "" && enc.KeyFile == "" && enc.KeyCommand == "" {
+		return nil
+	}
+
+	if enc.KeyFile != "" {
+		if abs, err := filepath.Abs(enc.KeyFile); err == nil {
+			enc.KeyFile = abs
+		}
+	}
+
+	return enc
+}
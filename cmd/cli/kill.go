@@ -16,6 +16,7 @@ import (
 func init() {
 	killCmd.Flags().StringArray("var", []string{}, "a map of variables for the layer's Terraform files. I.e. 'foo=bar,baz=qux'")
 	killCmd.Flags().Bool("force", false, "force the destruction of the layer instance even if it has dependants")
+	killCmd.Flags().Bool("use-current-definition", false, "destroy the layer instance with the current definition of its layer instead of the one it was spawned from")
 
 	rootCmd.AddCommand(killCmd)
 }
@@ -26,7 +27,9 @@ var killCmd = &cobra.Command{
 	Short: "destroys a layer instance",
 	Long: `The kill command destroys a layer instance.
 
-Please notice that the kill command cannot destroy a layer instance which has dependants. To delete a layer instance with dependants, you must first delete all of its dependants.`,
+Please notice that the kill command cannot destroy a layer instance which has dependants. To delete a layer instance with dependants, you must first delete all of its dependants.
+
+Instances are destroyed with the definition they were spawned from, even when their layer was configured again since. When that version is no longer known, e.g. because the context was migrated to one that does not keep the history of definitions, --use-current-definition destroys the instance with the current definition of its layer instead. The current definition may not match the resources of the instance anymore, so check the plan carefully before approving it.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := hclog.Default()
 		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
@@ -34,6 +37,8 @@ Please notice that the kill command cannot destroy a layer instance which has de
 			logger.SetLevel(logLevel)
 		}
 		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
 
 		cfg, err := lfconfig.Load("")
 		if err != nil {
@@ -54,6 +59,12 @@ Please notice that the kill command cannot destroy a layer instance which has de
 			os.Exit(1)
 			return
 		}
+		useCurrentDefinition, err := cmd.Flags().GetBool("use-current-definition")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --use-current-definition flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
 		kill, err := cfg.GetKillCommand(ctx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get kill command"))
@@ -63,7 +74,7 @@ Please notice that the kill command cannot destroy a layer instance which has de
 		layerName := args[0]
 		instanceName := args[1]
 
-		err = kill.Run(ctx, layerName, instanceName, false, vars, force)
+		err = kill.Run(ctx, layerName, instanceName, false, vars, force, useCurrentDefinition)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
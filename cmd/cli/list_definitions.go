@@ -1,12 +1,15 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
@@ -14,9 +17,12 @@ import (
 
 	"github.com/ergomake/layerform/internal/lfconfig"
 	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
 )
 
 func init() {
+	listDefinitionsCmd.Flags().String("history", "", "list every version configured for the given layer instead")
 	listCmd.AddCommand(listDefinitionsCmd)
 }
 
@@ -25,8 +31,15 @@ var listDefinitionsCmd = &cobra.Command{
 	Short: "List layers definitions",
 	Long: `List layers definitions.
 
-Prints a table of the most important information about layer definitions.`,
-	Run: func(_ *cobra.Command, _ []string) {
+Prints a table of the most important information about layer definitions.
+
+With --history, prints every version configured for a layer, most recent first, along with the instances spawned from each version.`,
+	Example: `# List the current layer definitions
+layerform list definitions
+
+# List every version of the eks layer
+layerform list definitions --history eks`,
+	Run: func(cmd *cobra.Command, _ []string) {
 		logger := hclog.Default()
 		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
 		if logLevel != hclog.NoLevel {
@@ -48,6 +61,23 @@ Prints a table of the most important information about layer definitions.`,
 			return
 		}
 
+		history, _ := cmd.Flags().GetString("history")
+		if history != "" {
+			instancesBackend, err := cfg.GetInstancesBackend(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get instances backend"))
+				os.Exit(1)
+				return
+			}
+
+			err = printDefinitionHistory(ctx, layersBackend, instancesBackend, history)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
 		layers, err := layersBackend.ListLayers(ctx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to list layer definitions"))
@@ -80,6 +110,69 @@ Prints a table of the most important information about layer definitions.`,
 	},
 }
 
+func printDefinitionHistory(
+	ctx context.Context,
+	layersBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	layerName string,
+) error {
+	versions, err := layersBackend.ListLayerHistory(ctx, layerName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to list history of layer %s", layerName)
+	}
+
+	if len(versions) == 0 {
+		return errors.Errorf("layer %s has no history", layerName)
+	}
+
+	instances, err := instancesBackend.ListInstancesByLayer(ctx, layerName)
+	if err != nil {
+		return errors.Wrap(err, "fail to list layer instances")
+	}
+
+	var current []byte
+	if layer, err := layersBackend.GetLayer(ctx, layerName); err == nil && layer != nil {
+		current = layer.SHA
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "SHA\tCONFIGURED AT\tFILES\tDEPENDENCIES\tINSTANCES")
+	for _, v := range versions {
+		sha := hex.EncodeToString(v.Definition.SHA)
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		if bytes.Equal(v.Definition.SHA, current) {
+			sha += " (current)"
+		}
+
+		configuredAt := "unknown"
+		if !v.ConfiguredAt.IsZero() {
+			configuredAt = v.ConfiguredAt.Local().Format(time.RFC3339)
+		}
+
+		names := []string{}
+		for _, i := range instances {
+			if bytes.Equal(i.DefinitionSHA, v.Definition.SHA) {
+				names = append(names, i.InstanceName)
+			}
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%d\t%s\t%s\n",
+			sha,
+			configuredAt,
+			len(v.Definition.Files),
+			strings.Join(v.Definition.Dependencies, ","),
+			strings.Join(names, ","),
+		)
+	}
+
+	return errors.Wrap(w.Flush(), "fail to print output")
+}
+
 func sortLayersByDepth(layers []*data.LayerDefinition) {
 	byName := make(map[string]*data.LayerDefinition)
 	for _, l := range layers {
@@ -12,10 +12,12 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
 )
 
 func init() {
+	listInstancesCmd.Flags().Bool("outdated", false, "only list instances spawned from a definition that is no longer current")
 	listCmd.AddCommand(listInstancesCmd)
 }
 
@@ -24,8 +26,10 @@ var listInstancesCmd = &cobra.Command{
 	Short: "List layers instances",
 	Long: `List layers instances.
 
-Prints a table of the most important information about layer instances.`,
-	Run: func(_ *cobra.Command, _ []string) {
+Prints a table of the most important information about layer instances.
+
+With --outdated only instances spawned from a definition that is no longer the current definition of their layer are listed, "layerform upgrade" upgrades them.`,
+	Run: func(cmd *cobra.Command, _ []string) {
 		logger := hclog.Default()
 		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
 		if logLevel != hclog.NoLevel {
@@ -33,6 +37,13 @@ Prints a table of the most important information about layer instances.`,
 		}
 		ctx := hclog.WithContext(context.Background(), logger)
 
+		outdated, err := cmd.Flags().GetBool("outdated")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --outdated flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
 		cfg, err := lfconfig.Load("")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
@@ -73,6 +84,14 @@ Prints a table of the most important information about layer instances.`,
 			return
 		}
 
+		if outdated {
+			instances = command.OutdatedInstances(layers, instances)
+			if len(instances) == 0 {
+				fmt.Fprintln(os.Stdout, "All layer instances are up to date.")
+				return
+			}
+		}
+
 		layersByName := make(map[string]*data.LayerDefinition)
 		for _, l := range layers {
 			layersByName[l.Name] = l
@@ -56,7 +56,7 @@ var outputCmd = &cobra.Command{
 		layerName := args[0]
 		instanceName := args[1]
 
-		output := command.NewOutput(layersBackend, instancesBackend)
+		output := command.NewOutput(layersBackend, instancesBackend, cfg.GetCurrent().Terraform)
 
 		template, err := cmd.Flags().GetString("template")
 		if err != nil {
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/lithammer/shortuuid/v3"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+func init() {
+	planCmd.Flags().StringToString("base", map[string]string{}, "a map of underlying layers and their IDs to place the layer on top of")
+	planCmd.Flags().StringArray("var", []string{}, "a map of variables for the layer's Terraform files. I.e. 'foo=bar,baz=qux'")
+	rootCmd.AddCommand(planCmd)
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan <layer> [instance]",
+	Short: "shows what spawning or refreshing a layer instance would change",
+	Long: `The plan command shows what terraform would add, change and destroy without changing anything.
+
+When the instance exists the plan is the one of "layerform refresh", otherwise it is the one of "layerform spawn". Instances of the dependencies of the layer must already exist.`,
+	Example: `# Preview spawning a new instance of the layer named example
+layerform plan example
+
+# Preview refreshing the instance named dev of the layer named example
+layerform plan example dev`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+			return
+		}
+
+		vars, err := cmd.Flags().GetStringArray("var")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --var flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		dependenciesInstance, err := cmd.Flags().GetStringToString("base")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --base flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		instancesBackend, err := cfg.GetInstancesBackend(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get instance backend"))
+			os.Exit(1)
+			return
+		}
+
+		layerName := args[0]
+		instanceName := shortuuid.New()
+		if len(args) > 1 {
+			instanceName = args[1]
+		}
+
+		_, err = instancesBackend.GetInstance(ctx, layerName, instanceName)
+		if err != nil && !errors.Is(err, layerinstances.ErrInstanceNotFound) {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get instance"))
+			os.Exit(1)
+			return
+		}
+
+		if err == nil {
+			refresh, err := cfg.GetRefreshCommand(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get refresh command"))
+				os.Exit(1)
+			}
+
+			err = refresh.Run(ctx, layerName, instanceName, vars, command.PlanOnly)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(1)
+			}
+
+			return
+		}
+
+		spawn, err := cfg.GetSpawnCommand(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get spawn command"))
+			os.Exit(1)
+		}
+
+		err = spawn.Run(ctx, layerName, instanceName, dependenciesInstance, vars, command.PlanOnly, 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
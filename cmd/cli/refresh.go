@@ -12,10 +12,12 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
 )
 
 func init() {
 	refreshCmd.Flags().StringArray("var", []string{}, "a map of variables for the layer's Terraform files. I.e. 'foo=bar,baz=qux'")
+	refreshCmd.Flags().Bool("plan", false, "show what terraform will change and ask for approval when anything changes")
 	rootCmd.AddCommand(refreshCmd)
 }
 
@@ -33,6 +35,8 @@ This command updates the layer instance resources to comply with the current ver
 			logger.SetLevel(logLevel)
 		}
 		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
 
 		cfg, err := lfconfig.Load("")
 		if err != nil {
@@ -60,7 +64,12 @@ This command updates the layer instance resources to comply with the current ver
 			instanceName = args[1]
 		}
 
-		err = refresh.Run(ctx, layerName, instanceName, vars)
+		planMode := command.PlanNone
+		if plan, _ := cmd.Flags().GetBool("plan"); plan {
+			planMode = command.PlanApprove
+		}
+
+		err = refresh.Run(ctx, layerName, instanceName, vars, planMode)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
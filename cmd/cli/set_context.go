@@ -3,19 +3,35 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/data"
 )
 
 func init() {
-	configSetContextCmd.Flags().StringP("type", "t", "local", "type of the context entry, must be \"local\", \"s3\" or \"cloud\"")
-	configSetContextCmd.Flags().String("dir", "", "directory to store definitions and instances, required when type is \"local\"")
-	configSetContextCmd.Flags().String("bucket", "", "bucket to store definitions and instances, required when type is \"s3\"")
-	configSetContextCmd.Flags().String("region", "", "region where bucket is located, required when type is \"s3\"")
+	configSetContextCmd.Flags().StringP("type", "t", "local", "type of the context entry, must be \"local\", \"s3\", \"gcs\", \"sqlite\", \"git\" or \"cloud\"")
+	configSetContextCmd.Flags().String("dir", "", "directory to store definitions and instances, required when type is \"local\" or \"git\"")
+	configSetContextCmd.Flags().Int("backups", 5, "number of backups to keep of each state file when type is \"local\"")
+	configSetContextCmd.Flags().String("file", "", "path of the database file, required when type is \"sqlite\"")
+	configSetContextCmd.Flags().String("bucket", "", "bucket to store definitions and instances, required when type is \"s3\" or \"gcs\"")
+	configSetContextCmd.Flags().String("region", "", "region where bucket is located, required when type is \"s3\" unless an endpoint or profile is given")
+	configSetContextCmd.Flags().String("endpoint", "", "custom endpoint of an S3 compatible store like MinIO, Ceph or R2 when type is \"s3\"")
+	configSetContextCmd.Flags().Bool("force-path-style", false, "address objects as <endpoint>/<bucket>/<key> when type is \"s3\", required by most S3 compatible stores")
+	configSetContextCmd.Flags().String("profile", "", "profile from the AWS shared config files to use when type is \"s3\"")
+	configSetContextCmd.Flags().String("key-prefix", "", "prefix of the objects inside the bucket when type is \"s3\" or \"gcs\", lets many contexts share a bucket")
+	configSetContextCmd.Flags().String("prefix", "", "prefix of the objects inside the bucket when type is \"gcs\"")
+	_ = configSetContextCmd.Flags().MarkDeprecated("prefix", "use --key-prefix instead")
+	configSetContextCmd.Flags().String("credentials", "", "path to a service account credentials file when type is \"gcs\", defaults to application default credentials")
+	addEncryptionFlags(configSetContextCmd, "encryption-", " when type is \"local\", \"s3\", \"gcs\" or \"git\", enables encryption at rest")
+	addSigningFlags(configSetContextCmd)
+	configSetContextCmd.Flags().String("terraform-engine", "", "default engine of layers, \"terraform\" or \"tofu\"")
+	configSetContextCmd.Flags().String("terraform-version", "", "default version constraint of the terraform binary of layers, like \">= 1.5, < 2\"")
+	configSetContextCmd.Flags().String("terraform-path", "", "terraform binary to use instead of looking one up in the PATH")
 	configSetContextCmd.Flags().String("url", "", "url of layerform cloud, required when type is \"cloud\"")
 	configSetContextCmd.Flags().String("email", "", "email of layerform cloud user, required when type is \"cloud\"")
 	configSetContextCmd.Flags().String("password", "", "password of layerform cloud user, required when type is \"cloud\"")
@@ -36,6 +52,24 @@ layerform config set-context local-example -t local --dir example-dir
 # Set a context of type s3 named s3-example
 layerform config set-context s3-example -t s3 --bucket example-bucket --region us-east-1
 
+# Set a context of type s3 named minio-example backed by a MinIO server
+layerform config set-context minio-example -t s3 --bucket example-bucket --endpoint http://localhost:9000 --force-path-style --key-prefix team-a
+
+# Set a context of type gcs named gcs-example
+layerform config set-context gcs-example -t gcs --bucket example-bucket --key-prefix team-a
+
+# Set a context of type sqlite named sqlite-example
+layerform config set-context sqlite-example -t sqlite --file layerform.db
+
+# Set a context of type git named git-example, every change is committed to the repository
+layerform config set-context git-example -t git --dir example-repo
+
+# Set a context of type s3 that refuses layer definitions not signed by the given key
+layerform config set-context signed-example -t s3 --bucket example-bucket --region us-east-1 --trusted-key "$(cat signing.pub)" --require-signed-definitions
+
+# Set a context of type local named tofu-example that runs layers with OpenTofu
+layerform config set-context tofu-example -t local --dir example-dir --terraform-engine tofu --terraform-version ">= 1.6"
+
 # Set a context of type cloud named cloud-example
 layerform config set-context cloud-example -t cloud --url https://example.layerform.dev --email foo@example.com --password secretpass`,
 	Args: cobra.ExactArgs(1),
@@ -49,11 +83,44 @@ layerform config set-context cloud-example -t cloud --url https://example.layerf
 			dir, _ := cmd.Flags().GetString("dir")
 			configCtx.Type = t
 			configCtx.Dir = strings.TrimSpace(dir)
+			if cmd.Flags().Changed("backups") {
+				backups, _ := cmd.Flags().GetInt("backups")
+				configCtx.Backups = &backups
+			}
 		case "s3":
 			bucket, _ := cmd.Flags().GetString("bucket")
 			region, _ := cmd.Flags().GetString("region")
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			forcePathStyle, _ := cmd.Flags().GetBool("force-path-style")
+			profile, _ := cmd.Flags().GetString("profile")
+			keyPrefix, _ := cmd.Flags().GetString("key-prefix")
 			configCtx.Bucket = strings.TrimSpace(bucket)
 			configCtx.Region = strings.TrimSpace(region)
+			configCtx.Endpoint = strings.TrimSpace(endpoint)
+			configCtx.ForcePathStyle = forcePathStyle
+			configCtx.Profile = strings.TrimSpace(profile)
+			configCtx.KeyPrefix = strings.Trim(strings.TrimSpace(keyPrefix), "/")
+		case "gcs":
+			bucket, _ := cmd.Flags().GetString("bucket")
+			keyPrefix, _ := cmd.Flags().GetString("key-prefix")
+			if !cmd.Flags().Changed("key-prefix") {
+				keyPrefix, _ = cmd.Flags().GetString("prefix")
+			}
+			credentials, _ := cmd.Flags().GetString("credentials")
+			configCtx.Bucket = strings.TrimSpace(bucket)
+			configCtx.KeyPrefix = strings.Trim(strings.TrimSpace(keyPrefix), "/")
+			configCtx.Credentials = strings.TrimSpace(credentials)
+			if configCtx.Credentials != "" {
+				if abs, err := filepath.Abs(configCtx.Credentials); err == nil {
+					configCtx.Credentials = abs
+				}
+			}
+		case "git":
+			dir, _ := cmd.Flags().GetString("dir")
+			configCtx.Dir = strings.TrimSpace(dir)
+		case "sqlite":
+			file, _ := cmd.Flags().GetString("file")
+			configCtx.File = strings.TrimSpace(file)
 		case "cloud":
 			url, _ := cmd.Flags().GetString("url")
 			email, _ := cmd.Flags().GetString("email")
@@ -66,6 +133,15 @@ layerform config set-context cloud-example -t cloud --url https://example.layerf
 			os.Exit(1)
 		}
 
+		configCtx.Encryption = getEncryptionFlags(cmd, "encryption-")
+		configCtx.SigningKey = getSigningKeyFlags(cmd)
+		trustedKeys, _ := cmd.Flags().GetStringArray("trusted-key")
+		for _, k := range trustedKeys {
+			configCtx.TrustedKeys = append(configCtx.TrustedKeys, strings.TrimSpace(k))
+		}
+		configCtx.RequireSignedDefinitions, _ = cmd.Flags().GetBool("require-signed-definitions")
+		configCtx.Terraform = getTerraformFlags(cmd)
+
 		err := lfconfig.Validate(configCtx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "invalid context configuration"))
@@ -101,6 +177,19 @@ layerform config set-context cloud-example -t cloud --url https://example.layerf
 				)
 				os.Exit(1)
 			}
+
+			// dropping the key would make the context unreadable and
+			// adding one would refuse its plain files, keys are changed
+			// with "layerform context rotate-key"
+			if ok && configCtx.Encryption == nil {
+				configCtx.Encryption = prev.Encryption
+			} else if ok && prev.Encryption == nil {
+				fmt.Fprintf(os.Stderr, "%s context already exists, use \"layerform context rotate-key\" to encrypt it.\n", name)
+				os.Exit(1)
+			} else if ok && *prev.Encryption != *configCtx.Encryption {
+				fmt.Fprintf(os.Stderr, "%s context is already encrypted, use \"layerform context rotate-key\" to change its key.\n", name)
+				os.Exit(1)
+			}
 			cfg.Contexts[name] = configCtx
 		}
 
@@ -116,3 +205,27 @@ layerform config set-context cloud-example -t cloud --url https://example.layerf
 	},
 	SilenceErrors: true,
 }
+
+// getTerraformFlags returns nil when none of the terraform flags were set.
+func getTerraformFlags(cmd *cobra.Command) *data.TerraformConfig {
+	engine, _ := cmd.Flags().GetString("terraform-engine")
+	version, _ := cmd.Flags().GetString("terraform-version")
+	tfpath, _ := cmd.Flags().GetString("terraform-path")
+
+	tf := &data.TerraformConfig{
+		Engine:  strings.TrimSpace(engine),
+		Version: strings.TrimSpace(version),
+		Path:    strings.TrimSpace(tfpath),
+	}
+	if tf.Engine == "" && tf.Version == "" && tf.Path == "" {
+		return nil
+	}
+
+	if tf.Path != "" {
+		if abs, err := filepath.Abs(tf.Path); err == nil {
+			tf.Path = abs
+		}
+	}
+
+	return tf
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptible returns a context that is cancelled on the first interrupt,
+// which makes terraform stop gracefully so the state it already has can be
+// saved. A second interrupt exits right away.
+func interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+
+		fmt.Fprintln(
+			os.Stderr,
+			"\nInterrupting, terraform is given time to stop and save its state. Press Ctrl-C again to exit right away.",
+		)
+		cancel()
+
+		<-signals
+		os.Exit(130)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+)
+
+func addSigningFlags(cmd *cobra.Command) {
+	cmd.Flags().String("signing-key-env", "", "environment variable holding the ed25519 key that signs layer definitions")
+	cmd.Flags().String("signing-key-file", "", "file holding the ed25519 key that signs layer definitions")
+	cmd.Flags().String("signing-key-command", "", "command that prints the ed25519 key that signs layer definitions")
+	cmd.Flags().StringArray("trusted-key", nil, "base64 or PEM encoded ed25519 public key trusted to sign layer definitions, can be repeated")
+	cmd.Flags().Bool("require-signed-definitions", false, "refuse to spawn, kill or refresh layers whose definitions are not signed by a trusted key")
+}
+
+// getSigningKeyFlags returns nil when none of the signing key flags added by
+// addSigningFlags were set.
+func getSigningKeyFlags(cmd *cobra.Command) *lfconfig.SigningKeyConfig {
+	keyEnv, _ := cmd.Flags().GetString("signing-key-env")
+	keyFile, _ := cmd.Flags().GetString("signing-key-file")
+	keyCommand, _ := cmd.Flags().GetString("signing-key-command")
+
+	key := &lfconfig.SigningKeyConfig{
+		KeyEnv:     strings.TrimSpace(keyEnv),
+		KeyFile:    strings.TrimSpace(keyFile),
+		KeyCommand: strings.TrimSpace(keyCommand),
+	}
+	if key.KeyEnv == "" && key.KeyFile == "" && key.KeyCommand == "" {
+		return nil
+	}
+
+	if key.KeyFile != "" {
+		if abs, err := filepath.Abs(key.KeyFile); err == nil {
+			key.KeyFile = abs
+		}
+	}
+
+	return key
+}
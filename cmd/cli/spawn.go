@@ -12,11 +12,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
 )
 
 func init() {
 	spawnCmd.Flags().StringToString("base", map[string]string{}, "a map of underlying layers and their IDs to place the layer on top of")
 	spawnCmd.Flags().StringArray("var", []string{}, "a map of variables for the layer's Terraform files. I.e. 'foo=bar,baz=qux'")
+	spawnCmd.Flags().Bool("plan", false, "show what terraform will create and ask for approval before applying it")
+	spawnCmd.Flags().Int("parallelism", 4, "how many layers that don't depend on each other to spawn at the same time, --plan spawns one at a time")
 	rootCmd.AddCommand(spawnCmd)
 }
 
@@ -38,6 +41,8 @@ If an instance with the same ID already exists for the layer definition, Layerfo
 			logger.SetLevel(logLevel)
 		}
 		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
 
 		cfg, err := lfconfig.Load("")
 		if err != nil {
@@ -78,7 +83,25 @@ If an instance with the same ID already exists for the layer definition, Layerfo
 			os.Exit(1)
 		}
 
-		err = spawn.Run(ctx, layerName, instanceName, dependenciesInstance, vars)
+		planMode := command.PlanNone
+		if plan, _ := cmd.Flags().GetBool("plan"); plan {
+			planMode = command.PlanApprove
+		}
+
+		parallelism, err := cmd.Flags().GetInt("parallelism")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --parallelism flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		if parallelism < 1 {
+			fmt.Fprintln(os.Stderr, "--parallelism must be at least 1")
+			os.Exit(1)
+			return
+		}
+
+		err = spawn.Run(ctx, layerName, instanceName, dependenciesInstance, vars, planMode, parallelism)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
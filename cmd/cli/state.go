@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+}
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manage the state files of the current context",
+	Long:  `Manage the state files of the current context using subcommands like "layerform state restore-backup"`,
+	Example: `# List available backups
+layerform state restore-backup`,
+}
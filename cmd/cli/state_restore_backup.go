@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command"
+)
+
+func init() {
+	stateCmd.AddCommand(stateRestoreBackupCmd)
+}
+
+var stateRestoreBackupCmd = &cobra.Command{
+	Use:   "restore-backup [backup-id]",
+	Short: "Roll the current context back to a previous backup",
+	Long: `Roll the current context back to a previous backup.
+
+Every time a context of type "local" is written, the previous version of the file is kept as a backup next to it. The number of backups kept is set with the --backups flag of "layerform config set-context".
+
+When called without a backup ID the available backups are listed. When called with a backup ID, definitions, instances and environment variables are all restored to the state they were in right before that backup was taken, files that did not change since then are left as they are. The current state is backed up before being replaced, so a restore can also be undone. Nothing is restored when a file changed since then but its backup was already removed, either because more backups were taken than are kept or by "layerform context rotate-key".`,
+	Example: `# List available backups
+layerform state restore-backup
+
+# Restore the context as it was at a given backup
+layerform state restore-backup 20231017T101112.123456789Z`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+			return
+		}
+
+		storages, err := cfg.GetBackupStorages(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get backup storages"))
+			os.Exit(1)
+			return
+		}
+
+		restore := command.NewRestoreBackup(storages)
+		if len(args) == 0 {
+			err = restore.List(ctx)
+		} else {
+			err = restore.Run(ctx, args[0])
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+	SilenceErrors: true,
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/lfconfig"
+	"github.com/ergomake/layerform/pkg/command/upgrade"
+)
+
+func init() {
+	upgradeCmd.Flags().String("layer", "", "only upgrade the outdated instances of this layer and the outdated instances they depend on")
+	upgradeCmd.Flags().Int("concurrency", 1, "how many instances to upgrade at the same time")
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "upgrades outdated layer instances to the current layer definitions",
+	Long: `The upgrade command upgrades outdated layer instances.
+
+An instance is outdated when the definition of its layer changed after it was spawned, "layerform list instances --outdated" lists them. Upgrading an instance refreshes it with the current definition of its layer. Instances are upgraded after the instances they depend on, and instances whose dependencies fail to upgrade are skipped.
+
+The command exits with status 1 when any instance was not upgraded.`,
+	Example: `# Upgrade every outdated instance, two at a time
+layerform upgrade --concurrency 2
+
+# Upgrade the outdated instances of the kibana layer
+layerform upgrade --layer kibana`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		logger := hclog.Default()
+		logLevel := hclog.LevelFromString(os.Getenv("LF_LOG"))
+		if logLevel != hclog.NoLevel {
+			logger.SetLevel(logLevel)
+		}
+		ctx := hclog.WithContext(context.Background(), logger)
+		ctx, stop := interruptible(ctx)
+		defer stop()
+
+		layerName, err := cmd.Flags().GetString("layer")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --layer flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get --concurrency flag, this is a bug in layerform"))
+			os.Exit(1)
+			return
+		}
+
+		if concurrency < 1 {
+			fmt.Fprintln(os.Stderr, "--concurrency must be at least 1")
+			os.Exit(1)
+			return
+		}
+
+		cfg, err := lfconfig.Load("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to load config"))
+			os.Exit(1)
+			return
+		}
+
+		upgradeCommand, err := cfg.GetUpgradeCommand(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "fail to get upgrade command"))
+			os.Exit(1)
+			return
+		}
+
+		reports, err := upgradeCommand.Run(ctx, layerName, concurrency)
+		if reports != nil {
+			upgrade.Print(os.Stdout, reports)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+			return
+		}
+
+		for _, r := range reports {
+			if r.Err != nil {
+				os.Exit(1)
+				return
+			}
+		}
+	},
+}
@@ -0,0 +1,13 @@
+layer "foo" {
+  files = ["foo.tf"]
+}
+
+layer "bar" {
+  files      = ["bar.tf"]
+  depends_on = ["foo"]
+}
+
+layer "baz" {
+  files      = ["baz.tf"]
+  depends_on = ["foo"]
+}
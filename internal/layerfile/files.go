@@ -0,0 +1,239 @@
+package layerfile
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/pathutils"
+)
+
+const ignoreFileName = ".layerformignore"
+
+// ignorePattern is a gitignore like pattern, used both for entries in the
+// .layerformignore file and for "!" prefixed entries in a layer files list.
+type ignorePattern struct {
+	glob    string
+	dirOnly bool
+}
+
+func parseIgnorePattern(raw string) (ignorePattern, error) {
+	p := ignorePattern{glob: filepath.ToSlash(strings.TrimSpace(raw))}
+
+	if strings.HasSuffix(p.glob, "/") {
+		p.dirOnly = true
+		p.glob = strings.TrimRight(p.glob, "/")
+	}
+
+	if strings.HasPrefix(p.glob, "/") {
+		// anchored to the layerfile directory
+		p.glob = strings.TrimLeft(p.glob, "/")
+	} else if !strings.Contains(p.glob, "/") {
+		// a bare name matches at any depth
+		p.glob = "**/" + p.glob
+	}
+
+	if p.glob == "" || !doublestar.ValidatePattern(p.glob) {
+		return p, errors.Errorf("invalid ignore pattern %q", raw)
+	}
+
+	return p, nil
+}
+
+// matches reports whether rel, or any of its parent directories, is matched
+// by the pattern. rel must be slash separated and relative to the layerfile.
+func (p ignorePattern) matches(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if p.dirOnly && i == len(parts)-1 && !isDir {
+			break
+		}
+
+		prefix := strings.Join(parts[:i+1], "/")
+		if ok, _ := doublestar.Match(p.glob, prefix); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isIgnored(patterns []ignorePattern, rel string, isDir bool) bool {
+	for _, p := range patterns {
+		if p.matches(rel, isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readIgnoreFile(dir string) ([]ignorePattern, error) {
+	fpath := filepath.Join(dir, ignoreFileName)
+	f, err := os.Open(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open %s", fpath)
+	}
+	defer f.Close()
+
+	patterns := []ignorePattern{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse %s", fpath)
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	return patterns, errors.Wrapf(scanner.Err(), "fail to read %s", fpath)
+}
+
+// matchFiles expands the file patterns of a layer into the sorted list of
+// regular files they match, relative to dir and slash separated.
+//
+// Patterns use doublestar semantics so "**" matches any number of
+// directories, patterns prefixed with "!" exclude files and a pattern that
+// matches a directory includes every file inside of it.
+//
+// Include patterns that did not contribute any file are returned as
+// unmatched.
+func matchFiles(dir string, patterns []string, ignored []ignorePattern) ([]string, []unmatchedPattern, error) {
+	includes := []string{}
+	excludes := append([]ignorePattern{}, ignored...)
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			ip, err := parseIgnorePattern(strings.TrimPrefix(p, "!"))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			excludes = append(excludes, ip)
+			continue
+		}
+
+		includes = append(includes, p)
+	}
+
+	found := map[string]struct{}{}
+	matched := false
+	excluded := false
+	addFile := func(fpath string, isDir bool) (bool, error) {
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return false, errors.Wrap(err, "fail to extract relative path")
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." && isIgnored(excludes, rel, isDir) {
+			excluded = true
+			return false, nil
+		}
+
+		if !isDir {
+			found[rel] = struct{}{}
+			matched = true
+		}
+
+		return true, nil
+	}
+
+	unmatched := []unmatchedPattern{}
+	for _, p := range includes {
+		matched = false
+		excluded = false
+		matches, err := doublestar.FilepathGlob(filepath.Join(dir, p))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "fail to apply glob pattern %s", p)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "fail to stat %s", match)
+			}
+
+			if !info.IsDir() {
+				if _, err := addFile(match, false); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(fpath string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return errors.Wrapf(err, "fail to walk %s", match)
+				}
+
+				keep, err := addFile(fpath, d.IsDir())
+				if err != nil {
+					return err
+				}
+
+				if !keep && d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if !matched {
+			unmatched = append(unmatched, unmatchedPattern{p, excluded})
+		}
+	}
+
+	files := make([]string, 0, len(found))
+	for f := range found {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	return files, unmatched, nil
+}
+
+// unmatchedPattern is an include pattern that did not contribute any file,
+// excluded is set when it did match files but every one of them was excluded.
+type unmatchedPattern struct {
+	pattern  string
+	excluded bool
+}
+
+func (u unmatchedPattern) reason() string {
+	if u.excluded {
+		return "matches files but every match is excluded by \"!\" patterns or .layerformignore"
+	}
+
+	return "matches no files"
+}
+
+// checkFile makes sure rel, a file matched in dir, can safely be stored in a
+// definition: it must stay inside of dir, unless allowParents is set and it
+// only goes up with leading "..", and it must not go through symbolic links.
+func checkFile(dir, rel string, allowParents bool) error {
+	err := pathutils.ValidateRelative(rel, allowParents)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Join(dir, strings.Repeat("../", pathutils.ParentSegments(rel)))
+	return pathutils.CheckInside(base, filepath.Join(dir, filepath.FromSlash(rel)))
+}
@@ -0,0 +1,347 @@
+package layerfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+// DefaultFileNames are the layerfiles looked up, in order, when none is
+// given explicitly.
+var DefaultFileNames = []string{"layerform.json", "layerform.yaml", "layerform.yml", "layerform.hcl"}
+
+type format string
+
+const (
+	formatJSON format = "json"
+	formatYAML format = "yaml"
+	formatHCL  format = "hcl"
+)
+
+func detectFormat(fpath string) (format, error) {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".json":
+		return formatJSON, nil
+	case ".yaml", ".yml":
+		return formatYAML, nil
+	case ".hcl":
+		return formatHCL, nil
+	}
+
+	return "", errors.Errorf("unsupported layerfile extension %q, must be .json, .yaml, .yml or .hcl", filepath.Ext(fpath))
+}
+
+// errorAt formats an error pointing to a position of a layerfile the same way
+// compilers do, fpath:line:column: message.
+func errorAt(fpath string, line, column int, format string, args ...any) error {
+	return errors.Errorf("%s:%d:%d: %s", fpath, line, column, fmt.Sprintf(format, args...))
+}
+
+func parseJSON(fpath string, bs []byte) (*layerfile, error) {
+	var lf layerfile
+	err := json.Unmarshal(bs, &lf)
+	if err == nil {
+		return &lf, rejectTerraformPath(&lf)
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := offsetPosition(bs, syntaxErr.Offset)
+		return nil, errorAt(fpath, line, column, "%s", syntaxErr)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		line, column := offsetPosition(bs, typeErr.Offset)
+		return nil, errorAt(fpath, line, column, "%s must be %s but is %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	return nil, errors.Wrapf(err, "fail to decode %s", fpath)
+}
+
+// rejectTerraformPath fails when a JSON layerfile selects a terraform binary,
+// which depends on the machine running the layer so only contexts select it.
+// encoding/json does not report positions of valid keys, unlike the YAML and
+// HCL parsers which reject the path themselves.
+func rejectTerraformPath(lf *layerfile) error {
+	configs := []*data.TerraformConfig{lf.Terraform}
+	for _, l := range lf.Layers {
+		configs = append(configs, l.Terraform)
+	}
+
+	for _, tf := range configs {
+		if tf != nil && tf.Path != "" {
+			return errors.New("terraform path can't be set in layerfiles, set it on the context instead")
+		}
+	}
+
+	return nil
+}
+
+// offsetPosition converts the byte offset reported by encoding/json, which
+// points right after the offending token, into a 1 based line and column.
+func offsetPosition(bs []byte, offset int64) (int, int) {
+	if offset > int64(len(bs)) {
+		offset = int64(len(bs))
+	}
+	if offset > 0 {
+		offset--
+	}
+
+	before := bs[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+func parseYAML(fpath string, bs []byte) (*layerfile, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(bs, &doc)
+	if err != nil {
+		// yaml.v3 only reports the line of syntax errors
+		return nil, errors.Wrapf(err, "fail to parse %s", fpath)
+	}
+
+	lf := &layerfile{}
+	if len(doc.Content) == 0 {
+		return lf, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errorAt(fpath, root.Line, root.Column, "layerfile must be a mapping with a layers key")
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "layers":
+		case "terraform":
+			tf, err := parseYAMLTerraform(fpath, value)
+			if err != nil {
+				return nil, err
+			}
+
+			lf.Terraform = tf
+			continue
+		case "include":
+			include, err := parseYAMLStrings(fpath, "include", value)
+			if err != nil {
+				return nil, err
+			}
+
+			lf.Include = append(lf.Include, include...)
+			continue
+		default:
+			return nil, errorAt(fpath, key.Line, key.Column, "unknown key %q", key.Value)
+		}
+
+		if isYAMLNull(value) {
+			continue
+		}
+
+		if value.Kind != yaml.SequenceNode {
+			return nil, errorAt(fpath, value.Line, value.Column, "layers must be a list")
+		}
+
+		for _, item := range value.Content {
+			layer, err := parseYAMLLayer(fpath, item)
+			if err != nil {
+				return nil, err
+			}
+
+			lf.Layers = append(lf.Layers, layer)
+		}
+	}
+
+	return lf, nil
+}
+
+func parseYAMLLayer(fpath string, node *yaml.Node) (layerfileLayer, error) {
+	var layer layerfileLayer
+	if node.Kind != yaml.MappingNode {
+		return layer, errorAt(fpath, node.Line, node.Column, "layer must be a mapping with name, files, dependencies and modules")
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		var err error
+		switch key.Value {
+		case "name":
+			if value.Kind != yaml.ScalarNode || isYAMLNull(value) {
+				return layer, errorAt(fpath, value.Line, value.Column, "name must be a string")
+			}
+			layer.Name = value.Value
+		case "files":
+			layer.Files, err = parseYAMLStrings(fpath, "files", value)
+		case "dependencies":
+			layer.Dependencies, err = parseYAMLStrings(fpath, "dependencies", value)
+		case "modules":
+			layer.Modules, err = parseYAMLStrings(fpath, "modules", value)
+		case "terraform":
+			layer.Terraform, err = parseYAMLTerraform(fpath, value)
+		default:
+			return layer, errorAt(fpath, key.Line, key.Column, "unknown key %q in layer", key.Value)
+		}
+
+		if err != nil {
+			return layer, err
+		}
+	}
+
+	return layer, nil
+}
+
+func parseYAMLStrings(fpath, name string, node *yaml.Node) ([]string, error) {
+	if isYAMLNull(node) {
+		return nil, nil
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		return nil, errorAt(fpath, node.Line, node.Column, "%s must be a list of strings", name)
+	}
+
+	result := make([]string, len(node.Content))
+	for i, item := range node.Content {
+		if item.Kind != yaml.ScalarNode || isYAMLNull(item) {
+			return nil, errorAt(fpath, item.Line, item.Column, "%s must be a list of strings", name)
+		}
+
+		result[i] = item.Value
+	}
+
+	return result, nil
+}
+
+func parseYAMLTerraform(fpath string, node *yaml.Node) (*data.TerraformConfig, error) {
+	if isYAMLNull(node) {
+		return nil, nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil, errorAt(fpath, node.Line, node.Column, "terraform must be a mapping with engine and version")
+	}
+
+	tf := &data.TerraformConfig{}
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		var field *string
+		switch key.Value {
+		case "engine":
+			field = &tf.Engine
+		case "version":
+			field = &tf.Version
+		case "path":
+			// the binary depends on the machine running the layer, so only
+			// contexts select it
+			return nil, errorAt(fpath, key.Line, key.Column, "terraform path can't be set in layerfiles, set it on the context instead")
+		default:
+			return nil, errorAt(fpath, key.Line, key.Column, "unknown key %q in terraform", key.Value)
+		}
+
+		if value.Kind != yaml.ScalarNode || isYAMLNull(value) {
+			return nil, errorAt(fpath, value.Line, value.Column, "%s must be a string", key.Value)
+		}
+		*field = value.Value
+	}
+
+	return tf, nil
+}
+
+func isYAMLNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+type hclLayerfile struct {
+	Include   []string      `hcl:"include,optional"`
+	Terraform *hclTerraform `hcl:"terraform,block"`
+	Layers    []hclLayer    `hcl:"layer,block"`
+}
+
+type hclLayer struct {
+	Name         string        `hcl:"name,label"`
+	Files        []string      `hcl:"files,optional"`
+	Dependencies []string      `hcl:"depends_on,optional"`
+	Modules      []string      `hcl:"modules,optional"`
+	Terraform    *hclTerraform `hcl:"terraform,block"`
+}
+
+type hclTerraform struct {
+	Engine  string `hcl:"engine,optional"`
+	Version string `hcl:"version,optional"`
+}
+
+func (t *hclTerraform) config() *data.TerraformConfig {
+	if t == nil {
+		return nil
+	}
+
+	return &data.TerraformConfig{Engine: t.Engine, Version: t.Version}
+}
+
+func parseHCL(fpath string, bs []byte) (*layerfile, error) {
+	file, diags := hclparse.NewParser().ParseHCL(bs, fpath)
+	if diags.HasErrors() {
+		return nil, hclDiagnosticsError(fpath, diags)
+	}
+
+	var lf hclLayerfile
+	diags = gohcl.DecodeBody(file.Body, nil, &lf)
+	if diags.HasErrors() {
+		return nil, hclDiagnosticsError(fpath, diags)
+	}
+
+	layers := make([]layerfileLayer, len(lf.Layers))
+	for i, l := range lf.Layers {
+		layers[i] = layerfileLayer{
+			Name:         l.Name,
+			Files:        l.Files,
+			Dependencies: l.Dependencies,
+			Modules:      l.Modules,
+			Terraform:    l.Terraform.config(),
+		}
+	}
+
+	return &layerfile{Include: lf.Include, Layers: layers, Terraform: lf.Terraform.config()}, nil
+}
+
+func hclDiagnosticsError(fpath string, diags hcl.Diagnostics) error {
+	var result *multierror.Error
+	for _, d := range diags {
+		if d.Severity != hcl.DiagError {
+			continue
+		}
+
+		message := d.Summary
+		if d.Detail != "" {
+			message = fmt.Sprintf("%s; %s", d.Summary, d.Detail)
+		}
+
+		if d.Subject == nil {
+			result = multierror.Append(result, errors.Errorf("%s: %s", fpath, message))
+			continue
+		}
+
+		result = multierror.Append(result, errorAt(fpath, d.Subject.Start.Line, d.Subject.Start.Column, "%s", message))
+	}
+
+	if result != nil && len(result.Errors) == 1 {
+		return result.Errors[0]
+	}
+
+	return result.ErrorOrNil()
+}
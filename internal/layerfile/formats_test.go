@@ -0,0 +1,263 @@
+package layerfile
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func TestFromFile_Formats(t *testing.T) {
+	expected := []layerfileLayer{
+		{Name: "eks", Files: []string{"eks.tf", "eks/**"}},
+		{Name: "kibana", Files: []string{"kibana.tf"}, Dependencies: []string{"eks"}},
+	}
+
+	tests := []struct {
+		fname   string
+		content string
+	}{
+		{
+			fname: "layerform.json",
+			content: `{
+  "layers": [
+    {"name": "eks", "files": ["eks.tf", "eks/**"]},
+    {"name": "kibana", "files": ["kibana.tf"], "dependencies": ["eks"]}
+  ]
+}`,
+		},
+		{
+			fname: "layerform.yaml",
+			content: `layers:
+  - name: eks
+    files: [eks.tf, "eks/**"]
+  - name: kibana
+    files:
+      - kibana.tf
+    dependencies:
+      - eks
+`,
+		},
+		{
+			fname: "layerform.hcl",
+			content: `layer "eks" {
+  files = ["eks.tf", "eks/**"]
+}
+
+layer "kibana" {
+  files      = ["kibana.tf"]
+  depends_on = ["eks"]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fname, func(t *testing.T) {
+			fpath := path.Join(t.TempDir(), tt.fname)
+			err := os.WriteFile(fpath, []byte(tt.content), 0644)
+			require.NoError(t, err)
+
+			lf, err := FromFile(fpath)
+			require.NoError(t, err)
+
+			want := make([]layerfileLayer, len(expected))
+			for i, l := range expected {
+				l.sourceFilepath = fpath
+				want[i] = l
+			}
+			assert.Equal(t, want, lf.Layers)
+		})
+	}
+}
+
+func TestFromFile_Terraform(t *testing.T) {
+	tests := []struct {
+		fname   string
+		content string
+	}{
+		{
+			fname: "layerform.json",
+			content: `{
+  "terraform": {"engine": "tofu", "version": ">= 1.6"},
+  "layers": [
+    {"name": "eks", "files": ["eks.tf"]},
+    {"name": "kibana", "files": ["kibana.tf"], "terraform": {"version": "< 2"}}
+  ]
+}`,
+		},
+		{
+			fname: "layerform.yaml",
+			content: `terraform:
+  engine: tofu
+  version: ">= 1.6"
+layers:
+  - name: eks
+    files: [eks.tf]
+  - name: kibana
+    files: [kibana.tf]
+    terraform:
+      version: "< 2"
+`,
+		},
+		{
+			fname: "layerform.hcl",
+			content: `terraform {
+  engine  = "tofu"
+  version = ">= 1.6"
+}
+
+layer "eks" {
+  files = ["eks.tf"]
+}
+
+layer "kibana" {
+  files = ["kibana.tf"]
+
+  terraform {
+    version = "< 2"
+  }
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fname, func(t *testing.T) {
+			fpath := path.Join(t.TempDir(), tt.fname)
+			err := os.WriteFile(fpath, []byte(tt.content), 0644)
+			require.NoError(t, err)
+
+			lf, err := FromFile(fpath)
+			require.NoError(t, err)
+			require.Len(t, lf.Layers, 2)
+
+			assert.Equal(t, &data.TerraformConfig{Engine: "tofu", Version: ">= 1.6"}, lf.Layers[0].Terraform)
+			assert.Equal(
+				t,
+				&data.TerraformConfig{Engine: "tofu", Version: ">= 1.6, < 2"},
+				lf.Layers[1].Terraform,
+				"layers apply their config on top of the one of the layerfile",
+			)
+		})
+	}
+}
+
+func TestFromFile_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		name     string
+		fname    string
+		content  string
+		position string
+		message  string
+	}{
+		{
+			name:     "json syntax error",
+			fname:    "layerform.json",
+			content:  "{\n  \"layers\": [\n    {\"name\": \"eks\",}\n  ]\n}",
+			position: ":3:20: ",
+			message:  "invalid character '}'",
+		},
+		{
+			name:     "json wrong type",
+			fname:    "layerform.json",
+			content:  "{\n  \"layers\": [\n    {\"name\": \"eks\", \"files\": \"eks.tf\"}\n  ]\n}",
+			position: ":3:37: ",
+			message:  "files must be []string but is string",
+		},
+		{
+			name:     "yaml syntax error",
+			fname:    "layerform.yml",
+			content:  "layers:\n  - name: eks\n    files: [eks.tf\n",
+			position: "yaml: line ",
+			message:  "did not find expected",
+		},
+		{
+			name:     "yaml wrong type",
+			fname:    "layerform.yaml",
+			content:  "layers:\n  - name: eks\n    files: eks.tf\n",
+			position: ":3:12: ",
+			message:  "files must be a list of strings",
+		},
+		{
+			name:     "yaml unknown key",
+			fname:    "layerform.yaml",
+			content:  "layers:\n  - name: eks\n    depends_on: [vpc]\n",
+			position: ":3:5: ",
+			message:  `unknown key "depends_on" in layer`,
+		},
+		{
+			name:     "yaml terraform path",
+			fname:    "layerform.yaml",
+			content:  "layers:\n  - name: eks\n    terraform:\n      path: /usr/bin/terraform\n",
+			position: ":4:7: ",
+			message:  "terraform path can't be set in layerfiles",
+		},
+		{
+			name:     "hcl syntax error",
+			fname:    "layerform.hcl",
+			content:  "layer \"eks\" {\n  files = [\"eks.tf\"\n}\n",
+			position: ":3:1: ",
+			message:  "Missing item separator",
+		},
+		{
+			name:     "hcl unknown attribute",
+			fname:    "layerform.hcl",
+			content:  "layer \"eks\" {\n  files = [\"eks.tf\"]\n  dependencies = [\"vpc\"]\n}\n",
+			position: ":3:3: ",
+			message:  `Unsupported argument; An argument named "dependencies" is not expected here`,
+		},
+		{
+			name:     "hcl terraform path",
+			fname:    "layerform.hcl",
+			content:  "layer \"eks\" {\n  terraform {\n    path = \"/usr/bin/terraform\"\n  }\n}\n",
+			position: ":3:5: ",
+			message:  `Unsupported argument; An argument named "path" is not expected here`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fpath := path.Join(t.TempDir(), tt.fname)
+			err := os.WriteFile(fpath, []byte(tt.content), 0644)
+			require.NoError(t, err)
+
+			_, err = FromFile(fpath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.position)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+
+	t.Run("json terraform path", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "layerform.json")
+		content := `{"layers": [{"name": "eks", "terraform": {"path": "/usr/bin/terraform"}}]}`
+		require.NoError(t, os.WriteFile(fpath, []byte(content), 0644))
+
+		_, err := FromFile(fpath)
+		assert.ErrorContains(t, err, fpath)
+		assert.ErrorContains(t, err, "terraform path can't be set in layerfiles")
+	})
+
+	t.Run("unsupported extension", func(t *testing.T) {
+		_, err := FromFile(path.Join(t.TempDir(), "layerform.toml"))
+		assert.ErrorContains(t, err, "unsupported layerfile extension")
+	})
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, path.Join(dir, "layerform.json"), Find(dir))
+
+	err := os.WriteFile(path.Join(dir, "layerform.hcl"), []byte(""), 0644)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "layerform.hcl"), Find(dir))
+
+	err = os.WriteFile(path.Join(dir, "layerform.yaml"), []byte(""), 0644)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "layerform.yaml"), Find(dir))
+}
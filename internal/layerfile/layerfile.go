@@ -1,7 +1,6 @@
 package layerfile
 
 import (
-	"encoding/json"
 	"os"
 	"path"
 	"path/filepath"
@@ -9,6 +8,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/pkg/data"
 )
 
@@ -18,29 +18,165 @@ var alphanumericRegex = regexp.MustCompile("^[A-Za-z0-9][A-Za-z0-9_-]*[A-Za-z0-9
 
 type layerfile struct {
 	sourceFilepath string           `json:"-"`
+	Include        []string         `json:"include"`
 	Layers         []layerfileLayer `json:"layers"`
+	// Terraform is the default of the layers of this layerfile, it does not
+	// apply to the layers of included layerfiles
+	Terraform *data.TerraformConfig `json:"terraform"`
 }
 
 type layerfileLayer struct {
 	Name         string   `json:"name"`
 	Files        []string `json:"files"`
 	Dependencies []string `json:"dependencies"`
+	Modules      []string `json:"modules"`
+	// Terraform overrides the terraform config of the layerfile
+	Terraform *data.TerraformConfig `json:"terraform"`
+
+	// sourceFilepath is the layerfile the layer was read from, its files
+	// are relative to the directory of that layerfile
+	sourceFilepath string
 }
 
+// FromFile reads a layerfile along with every layerfile it includes.
 func FromFile(sourceFilepath string) (*layerfile, error) {
+	return FromFiles([]string{sourceFilepath})
+}
+
+// FromFiles reads the layers of many layerfiles, and of the layerfiles they
+// include, into a single layerfile. Included paths are relative to the
+// layerfile that includes them and a layerfile read more than once only
+// contributes its layers the first time.
+func FromFiles(sourceFilepaths []string) (*layerfile, error) {
+	if len(sourceFilepaths) == 0 {
+		return nil, errors.New("no layerfile given")
+	}
+
+	result := &layerfile{sourceFilepath: sourceFilepaths[0]}
+	seen := map[string]struct{}{}
+
+	var load func(fpath, includedFrom string) error
+	load = func(fpath, includedFrom string) error {
+		abs, err := filepath.Abs(fpath)
+		if err != nil {
+			return errors.Wrapf(err, "fail to get absolute path of %s", fpath)
+		}
+		if _, ok := seen[abs]; ok {
+			return nil
+		}
+		seen[abs] = struct{}{}
+
+		lf, err := readFile(fpath)
+		if err != nil {
+			if includedFrom != "" {
+				return errors.Wrapf(err, "fail to read layerfile included from %s", includedFrom)
+			}
+
+			return err
+		}
+
+		for _, l := range lf.Layers {
+			l.sourceFilepath = fpath
+			l.Terraform = terraform.Merge(lf.Terraform, l.Terraform)
+			result.Layers = append(result.Layers, l)
+		}
+
+		for _, include := range lf.Include {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(fpath), include)
+			}
+
+			err := load(include, fpath)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, fpath := range sourceFilepaths {
+		err := load(fpath, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// readFile reads a single layerfile, its format is detected from the
+// extension which can be .json, .yaml, .yml or .hcl.
+func readFile(sourceFilepath string) (*layerfile, error) {
+	f, err := detectFormat(sourceFilepath)
+	if err != nil {
+		return nil, err
+	}
+
 	bs, err := os.ReadFile(sourceFilepath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to read %s", sourceFilepath)
 	}
 
-	lf := &layerfile{sourceFilepath: sourceFilepath}
-	err = json.Unmarshal(bs, lf)
+	var lf *layerfile
+	switch f {
+	case formatJSON:
+		lf, err = parseJSON(sourceFilepath, bs)
+	case formatYAML:
+		lf, err = parseYAML(sourceFilepath, bs)
+	case formatHCL:
+		lf, err = parseHCL(sourceFilepath, bs)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to decode %s into layerfile", sourceFilepath)
+	}
+
+	lf.sourceFilepath = sourceFilepath
+	return lf, nil
+}
+
+// Find returns the first of DefaultFileNames that exists in dir, or the first
+// of them when none exists so errors mention the most common name.
+func Find(dir string) string {
+	for _, name := range DefaultFileNames {
+		fpath := filepath.Join(dir, name)
+		if _, err := os.Stat(fpath); err == nil {
+			return fpath
+		}
+	}
+
+	return filepath.Join(dir, DefaultFileNames[0])
+}
+
+// dir returns the directory the files of l are relative to.
+func (lf *layerfile) dir(l layerfileLayer) string {
+	if l.sourceFilepath != "" {
+		return path.Dir(l.sourceFilepath)
+	}
+
+	return path.Dir(lf.sourceFilepath)
+}
+
+// ignoreFiles reads the ignore file of a directory once, no matter how many
+// layers are defined in it.
+type ignoreFiles map[string][]ignorePattern
+
+func (i ignoreFiles) get(dir string) ([]ignorePattern, error) {
+	if patterns, ok := i[dir]; ok {
+		return patterns, nil
+	}
+
+	patterns, err := readIgnoreFile(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to read ignore file")
+	}
 
-	return lf, errors.Wrapf(err, "fail to decode %s into layerfile", lf)
+	i[dir] = patterns
+	return patterns, nil
 }
 
 func (lf *layerfile) ToLayers() ([]*data.LayerDefinition, error) {
-	dir := path.Dir(lf.sourceFilepath)
+	ignoreFiles := ignoreFiles{}
 
 	dataLayers := make([]*data.LayerDefinition, len(lf.Layers))
 	for i, l := range lf.Layers {
@@ -48,35 +184,30 @@ func (lf *layerfile) ToLayers() ([]*data.LayerDefinition, error) {
 			return nil, errors.Wrap(ErrInvalidDefinitionName, l.Name)
 		}
 
-		files := []data.LayerDefinitionFile{}
-		for _, f := range l.Files {
-			matches, err := filepath.Glob(path.Join(dir, f))
-			if err != nil {
-				return nil, errors.Wrapf(err, "fail to apply glob pattern %s", f)
-			}
+		dir := lf.dir(l)
+		ignored, err := ignoreFiles.get(dir)
+		if err != nil {
+			return nil, err
+		}
 
-			for _, fpath := range matches {
-				content, err := os.ReadFile(fpath)
-				if err != nil {
-					return nil, errors.Wrapf(err, "could not read %s", fpath)
-				}
-
-				rel, err := filepath.Rel(dir, fpath)
-				if err != nil {
-					return nil, errors.Wrap(err, "fail to extract relative path")
-				}
-
-				files = append(files, data.LayerDefinitionFile{
-					Path:    rel,
-					Content: content,
-				})
-			}
+		files, err := readFiles(dir, l.Files, ignored, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to read files of layer %s", l.Name)
+		}
+
+		modules, err := readFiles(dir, l.Modules, ignored, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to read modules of layer %s", l.Name)
 		}
 
 		layer := &data.LayerDefinition{
 			Name:         l.Name,
 			Files:        files,
 			Dependencies: l.Dependencies,
+			Terraform:    l.Terraform,
+		}
+		if len(modules) > 0 {
+			layer.Modules = modules
 		}
 		sha, err := data.LayerDefinitionSHA(layer)
 		if err != nil {
@@ -89,3 +220,33 @@ func (lf *layerfile) ToLayers() ([]*data.LayerDefinition, error) {
 
 	return dataLayers, nil
 }
+
+// readFiles reads every file matched by patterns, see matchFiles, refusing
+// files that fail checkFile.
+func readFiles(dir string, patterns []string, ignored []ignorePattern, allowParents bool) ([]data.LayerDefinitionFile, error) {
+	matches, _, err := matchFiles(dir, patterns, ignored)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]data.LayerDefinitionFile, len(matches))
+	for i, rel := range matches {
+		err := checkFile(dir, rel, allowParents)
+		if err != nil {
+			return nil, err
+		}
+
+		fpath := filepath.Join(dir, filepath.FromSlash(rel))
+		content, err := os.ReadFile(fpath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", fpath)
+		}
+
+		files[i] = data.LayerDefinitionFile{
+			Path:    rel,
+			Content: content,
+		}
+	}
+
+	return files, nil
+}
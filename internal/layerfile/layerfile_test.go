@@ -5,8 +5,12 @@ import (
 	"path"
 	"testing"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/pathutils"
+	"github.com/ergomake/layerform/pkg/data"
 )
 
 func TestFromFile(t *testing.T) {
@@ -135,3 +139,305 @@ func TestToLayers_ValidateNameOfLayerDefinitions(t *testing.T) {
 		})
 	}
 }
+
+func TestToLayers_Globbing(t *testing.T) {
+	writeFiles := func(t *testing.T, dir string, files map[string]string) {
+		for fpath, content := range files {
+			fpath = path.Join(dir, fpath)
+			err := os.MkdirAll(path.Dir(fpath), 0755)
+			require.NoError(t, err)
+			err = os.WriteFile(fpath, []byte(content), 0644)
+			require.NoError(t, err)
+		}
+	}
+
+	paths := func(l *data.LayerDefinition) []string {
+		result := make([]string, len(l.Files))
+		for i, f := range l.Files {
+			result[i] = f.Path
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		patterns []string
+		expected []string
+	}{
+		{
+			name: "double star matches any depth",
+			files: map[string]string{
+				"layers/eks.tf":             "",
+				"layers/eks/main.tf":        "",
+				"layers/eks/nested/deep.tf": "",
+				"layers/other/main.tf":      "",
+			},
+			patterns: []string{"layers/eks.tf", "layers/eks/**"},
+			expected: []string{"layers/eks.tf", "layers/eks/main.tf", "layers/eks/nested/deep.tf"},
+		},
+		{
+			name: "directory matches include its files",
+			files: map[string]string{
+				"layers/eks/main.tf":     "",
+				"layers/eks/sub/main.tf": "",
+			},
+			patterns: []string{"layers/eks"},
+			expected: []string{"layers/eks/main.tf", "layers/eks/sub/main.tf"},
+		},
+		{
+			name: "exclusion patterns",
+			files: map[string]string{
+				"layers/eks/main.tf":                  "",
+				"layers/eks/README.md":                "",
+				"layers/eks/docs/usage.md":            "",
+				"layers/eks/.terraform/providers/aws": "",
+			},
+			patterns: []string{"layers/eks/**", "!**/*.md", "!.terraform/"},
+			expected: []string{"layers/eks/main.tf"},
+		},
+		{
+			name: "ignore file",
+			files: map[string]string{
+				".layerformignore":              "# comment\n\n*.md\n.terraform/\n/layers/eks/secret.tf\n",
+				"layers/eks/main.tf":            "",
+				"layers/eks/secret.tf":          "",
+				"layers/eks/README.md":          "",
+				"layers/eks/.terraform/foo.txt": "",
+			},
+			patterns: []string{"layers/**"},
+			expected: []string{"layers/eks/main.tf"},
+		},
+		{
+			name: "files are sorted and deduplicated",
+			files: map[string]string{
+				"b.tf":        "",
+				"a.tf":        "",
+				"layers/c.tf": "",
+			},
+			patterns: []string{"layers/*.tf", "*.tf", "b.tf"},
+			expected: []string{"a.tf", "b.tf", "layers/c.tf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeFiles(t, tmpDir, tt.files)
+
+			lf := &layerfile{
+				sourceFilepath: path.Join(tmpDir, "layerform.json"),
+				Layers:         []layerfileLayer{{Name: "layer1", Files: tt.patterns}},
+			}
+
+			layers, err := lf.ToLayers()
+			require.NoError(t, err)
+			require.Len(t, layers, 1)
+			assert.Equal(t, tt.expected, paths(layers[0]))
+		})
+	}
+
+	t.Run("sha does not depend on pattern order", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeFiles(t, tmpDir, map[string]string{"a.tf": "a", "b.tf": "b"})
+
+		lf := &layerfile{
+			sourceFilepath: path.Join(tmpDir, "layerform.json"),
+			Layers: []layerfileLayer{
+				{Name: "layer1", Files: []string{"a.tf", "b.tf"}},
+				{Name: "layer2", Files: []string{"b.tf", "a.tf"}},
+			},
+		}
+
+		layers, err := lf.ToLayers()
+		require.NoError(t, err)
+		assert.Equal(t, layers[0].SHA, layers[1].SHA)
+	})
+
+	t.Run("patterns whose matches are all ignored", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeFiles(t, tmpDir, map[string]string{".layerformignore": "*.md\n", "main.tf": "", "README.md": ""})
+
+		lf := &layerfile{
+			sourceFilepath: path.Join(tmpDir, "layerform.json"),
+			Layers:         []layerfileLayer{{Name: "layer1", Files: []string{"main.tf", "*.md"}}},
+		}
+
+		assert.ErrorContains(t, lf.Validate(nil), `pattern "*.md" of layer layer1 matches files but every match is excluded`)
+	})
+}
+
+func TestFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) string {
+		fpath := path.Join(dir, rel)
+		require.NoError(t, os.MkdirAll(path.Dir(fpath), 0755))
+		require.NoError(t, os.WriteFile(fpath, []byte(content), 0644))
+		return fpath
+	}
+
+	write("infra/vpc.tf", "vpc")
+	write("apps/app.tf", "app")
+	write("apps/shared/monitoring.tf", "monitoring")
+	infra := write("infra/layerform.json", `{"layers": [{"name": "vpc", "files": ["vpc.tf"]}]}`)
+	apps := write("apps/layerform.yaml", `include:
+  - shared/layerform.hcl
+  - ../infra/layerform.json
+layers:
+  - name: app
+    files: [app.tf]
+    dependencies: [vpc, monitoring]
+`)
+	write("apps/shared/layerform.hcl", `layer "monitoring" {
+  files      = ["monitoring.tf"]
+  depends_on = ["vpc"]
+}
+`)
+
+	lf, err := FromFiles([]string{infra, apps})
+	require.NoError(t, err)
+	require.NoError(t, lf.Validate(nil), "dependencies can cross files")
+
+	layers, err := lf.ToLayers()
+	require.NoError(t, err)
+
+	files := map[string][]data.LayerDefinitionFile{}
+	for _, l := range layers {
+		files[l.Name] = l.Files
+	}
+	assert.Equal(t, map[string][]data.LayerDefinitionFile{
+		"vpc":        {{Path: "vpc.tf", Content: []byte("vpc")}},
+		"app":        {{Path: "app.tf", Content: []byte("app")}},
+		"monitoring": {{Path: "monitoring.tf", Content: []byte("monitoring")}},
+	}, files, "files are relative to their own layerfile and files read twice are only loaded once")
+
+	t.Run("duplicate names across files", func(t *testing.T) {
+		other := write("other/layerform.json", `{"layers": [{"name": "vpc", "files": ["../infra/vpc.tf"]}]}`)
+
+		lf, err := FromFiles([]string{infra, other})
+		require.NoError(t, err)
+
+		err = lf.Validate(nil)
+		assert.ErrorContains(t, err, "layer vpc is defined more than once, in "+infra+" and "+other)
+	})
+
+	t.Run("same file name in layers spawned together", func(t *testing.T) {
+		write("network/main.tf", "network")
+		write("services/main.tf", "services")
+		write("services/extra/main.tf", "services")
+		network := write("network/layerform.json", `{"layers": [{"name": "network", "files": ["main.tf"]}]}`)
+		services := write("services/layerform.json", `{
+  "include": ["extra/layerform.json"],
+  "layers": [{"name": "services", "files": ["main.tf"], "dependencies": ["network"]}]
+}`)
+		write("services/extra/layerform.json", `{"layers": [{"name": "extra", "files": ["main.tf"], "dependencies": ["services"]}]}`)
+
+		lf, err := FromFiles([]string{network, services})
+		require.NoError(t, err)
+
+		var merr *multierror.Error
+		require.ErrorAs(t, lf.Validate(nil), &merr)
+		require.Len(t, merr.Errors, 2, "files with the same content do not collide")
+		assert.EqualError(t, merr.Errors[0], "file main.tf is different in layers network and services, which are spawned together")
+		assert.EqualError(t, merr.Errors[1], "file main.tf is different in layers network and extra, which are spawned together")
+	})
+
+	t.Run("missing include", func(t *testing.T) {
+		broken := write("broken/layerform.json", `{"include": ["missing.json"]}`)
+
+		_, err := FromFiles([]string{broken})
+		assert.ErrorContains(t, err, "included from "+broken)
+	})
+}
+
+func TestToLayers_Modules(t *testing.T) {
+	root := t.TempDir()
+	dir := path.Join(root, "infra")
+	require.NoError(t, os.MkdirAll(path.Join(root, "modules", "vpc"), 0755))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(path.Join(root, "modules", "vpc", "main.tf"), []byte("module"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "vpc.tf"), []byte(`module "vpc" { source = "../modules/vpc" }`), 0644))
+
+	lf := &layerfile{
+		sourceFilepath: path.Join(dir, "layerform.json"),
+		Layers: []layerfileLayer{
+			{Name: "vpc", Files: []string{"vpc.tf"}, Modules: []string{"../modules/vpc"}},
+			{Name: "plain", Files: []string{"vpc.tf"}},
+		},
+	}
+	require.NoError(t, lf.Validate(nil))
+
+	layers, err := lf.ToLayers()
+	require.NoError(t, err)
+	assert.Equal(t, []data.LayerDefinitionFile{{Path: "../modules/vpc/main.tf", Content: []byte("module")}}, layers[0].Modules)
+	assert.Nil(t, layers[1].Modules)
+	assert.NotEqual(t, layers[0].SHA, layers[1].SHA, "modules are part of the sha")
+
+	require.NoError(t, os.WriteFile(path.Join(root, "modules", "vpc", "main.tf"), []byte("changed"), 0644))
+	changed, err := lf.ToLayers()
+	require.NoError(t, err)
+	assert.NotEqual(t, layers[0].SHA, changed[0].SHA, "changing a module changes the sha")
+	assert.Equal(t, layers[1].SHA, changed[1].SHA)
+
+	t.Run("modules that match nothing", func(t *testing.T) {
+		lf := &layerfile{
+			sourceFilepath: path.Join(dir, "layerform.json"),
+			Layers:         []layerfileLayer{{Name: "vpc", Files: []string{"vpc.tf"}, Modules: []string{"../modules/missing"}}},
+		}
+
+		assert.ErrorContains(t, lf.Validate(nil), `module "../modules/missing" of layer vpc matches no files`)
+	})
+}
+
+func TestToLayers_UnsafeFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := path.Join(root, "layers")
+	outside := t.TempDir()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(path.Join(root, "secret.tf"), []byte("secret"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(outside, "main.tf"), []byte("outside"), 0644))
+	require.NoError(t, os.Symlink(path.Join(outside, "main.tf"), path.Join(dir, "link.tf")))
+	require.NoError(t, os.Symlink(outside, path.Join(dir, "linkdir")))
+
+	tests := []struct {
+		name    string
+		layer   layerfileLayer
+		message string
+	}{
+		{
+			name:    "files above the layerfile",
+			layer:   layerfileLayer{Name: "layer1", Files: []string{"../secret.tf"}},
+			message: "goes outside of its directory",
+		},
+		{
+			name:    "symlinked file",
+			layer:   layerfileLayer{Name: "layer1", Files: []string{"link.tf"}},
+			message: "is a symbolic link",
+		},
+		{
+			name:    "symlinked directory",
+			layer:   layerfileLayer{Name: "layer1", Files: []string{"linkdir/main.tf"}},
+			message: "is a symbolic link",
+		},
+		{
+			name:    "symlinked module",
+			layer:   layerfileLayer{Name: "layer1", Modules: []string{"linkdir"}},
+			message: "is a symbolic link",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := &layerfile{
+				sourceFilepath: path.Join(dir, "layerform.json"),
+				Layers:         []layerfileLayer{tt.layer},
+			}
+
+			_, err := lf.ToLayers()
+			assert.ErrorIs(t, err, pathutils.ErrUnsafePath)
+			assert.ErrorContains(t, err, tt.message)
+
+			assert.ErrorContains(t, lf.Validate(nil), tt.message)
+		})
+	}
+}
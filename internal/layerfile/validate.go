@@ -0,0 +1,295 @@
+package layerfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/terraform"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+// Validate statically checks the layers of the layerfile without running
+// terraform. It reports invalid and duplicated names, dependencies on layers
+// that do not exist, dependency cycles, layers without files, file or module
+// patterns that match nothing, files that overwrite each other when spawned
+// together and invalid terraform configs, all at once.
+//
+// existing are definitions the layers are merged into, they are valid
+// dependencies and are taken into account when looking for cycles, unless
+// the layerfile redefines them.
+func (lf *layerfile) Validate(existing []*data.LayerDefinition) error {
+	var result *multierror.Error
+
+	byName := map[string]layerfileLayer{}
+	for _, l := range lf.Layers {
+		if !alphanumericRegex.MatchString(l.Name) {
+			result = multierror.Append(result, errors.Wrapf(ErrInvalidDefinitionName, "%q", l.Name))
+		}
+
+		err := terraform.Validate(l.Terraform)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid terraform config of layer %s", l.Name))
+		}
+
+		if first, ok := byName[l.Name]; ok {
+			if first.sourceFilepath != l.sourceFilepath {
+				result = multierror.Append(result, errors.Errorf(
+					"layer %s is defined more than once, in %s and %s",
+					l.Name,
+					first.sourceFilepath,
+					l.sourceFilepath,
+				))
+			} else {
+				result = multierror.Append(result, errors.Errorf("layer %s is defined more than once", l.Name))
+			}
+			continue
+		}
+		byName[l.Name] = l
+	}
+
+	graph := map[string]layerfileLayer{}
+	for _, l := range existing {
+		graph[l.Name] = layerfileLayer{Name: l.Name, Dependencies: l.Dependencies}
+	}
+	for name, l := range byName {
+		graph[name] = l
+	}
+
+	for _, l := range lf.Layers {
+		for _, d := range l.Dependencies {
+			if d == l.Name {
+				result = multierror.Append(result, errors.Errorf("layer %s depends on itself", l.Name))
+				continue
+			}
+
+			if _, ok := graph[d]; !ok {
+				result = multierror.Append(result, errors.Errorf("layer %s depends on %s which is not defined", l.Name, d))
+			}
+		}
+	}
+
+	for _, cycle := range findCycles(lf.Layers, graph) {
+		result = multierror.Append(result, errors.Errorf("dependency cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	contents := map[string]map[string][]byte{}
+	for _, l := range existing {
+		if _, ok := byName[l.Name]; ok {
+			continue
+		}
+
+		contents[l.Name] = map[string][]byte{}
+		for _, f := range l.Files {
+			contents[l.Name][f.Path] = f.Content
+		}
+	}
+
+	ignoreFiles := ignoreFiles{}
+	for _, l := range lf.Layers {
+		ignored, err := ignoreFiles.get(lf.dir(l))
+		if err != nil {
+			return err
+		}
+
+		files, unmatched, err := matchFiles(lf.dir(l), l.Files, ignored)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "fail to match files of layer %s", l.Name))
+			continue
+		}
+
+		for _, u := range unmatched {
+			result = multierror.Append(result, errors.Errorf("pattern %q of layer %s %s", u.pattern, l.Name, u.reason()))
+		}
+
+		layerContents := map[string][]byte{}
+		for _, f := range files {
+			err := checkFile(lf.dir(l), f, false)
+			if err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid file of layer %s", l.Name))
+				continue
+			}
+
+			content, err := os.ReadFile(filepath.Join(lf.dir(l), filepath.FromSlash(f)))
+			if err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "fail to read file of layer %s", l.Name))
+				continue
+			}
+			layerContents[f] = content
+		}
+		if _, ok := contents[l.Name]; !ok {
+			contents[l.Name] = layerContents
+		}
+
+		if len(files) == 0 {
+			result = multierror.Append(result, errors.Errorf("layer %s has no files", l.Name))
+		}
+
+		modules, unmatched, err := matchFiles(lf.dir(l), l.Modules, ignored)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "fail to match modules of layer %s", l.Name))
+			continue
+		}
+
+		for _, f := range modules {
+			err := checkFile(lf.dir(l), f, true)
+			if err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid module file of layer %s", l.Name))
+			}
+		}
+
+		for _, u := range unmatched {
+			result = multierror.Append(result, errors.Errorf("module %q of layer %s %s", u.pattern, l.Name, u.reason()))
+		}
+	}
+
+	for _, err := range findCollisions(lf.Layers, graph, contents) {
+		result = multierror.Append(result, err)
+	}
+
+	return result.ErrorOrNil()
+}
+
+// findCollisions reports files that have the same path but different content
+// in layers that are spawned together, a layer and its dependencies are all
+// written to the same directory so one would overwrite the other.
+func findCollisions(
+	layers []layerfileLayer,
+	byName map[string]layerfileLayer,
+	contents map[string]map[string][]byte,
+) []error {
+	errs := []error{}
+	seen := map[string]struct{}{}
+
+	for _, l := range layers {
+		chain := []string{}
+		visited := map[string]struct{}{}
+
+		var visit func(name string)
+		visit = func(name string) {
+			if _, ok := visited[name]; ok {
+				return
+			}
+			visited[name] = struct{}{}
+
+			for _, d := range byName[name].Dependencies {
+				if _, ok := byName[d]; ok {
+					visit(d)
+				}
+			}
+			chain = append(chain, name)
+		}
+		visit(l.Name)
+
+		owners := map[string]string{}
+		for _, name := range chain {
+			paths := make([]string, 0, len(contents[name]))
+			for p := range contents[name] {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+
+			for _, p := range paths {
+				owner, ok := owners[p]
+				if !ok {
+					owners[p] = name
+					continue
+				}
+
+				if bytes.Equal(contents[owner][p], contents[name][p]) {
+					continue
+				}
+
+				key := strings.Join([]string{p, owner, name}, "\x00")
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+
+				errs = append(errs, errors.Errorf(
+					"file %s is different in layers %s and %s, which are spawned together",
+					p,
+					owner,
+					name,
+				))
+			}
+		}
+	}
+
+	return errs
+}
+
+// findCycles returns every dependency cycle reachable from layers as the
+// path of names that goes around it, starting and ending at the same layer.
+// Self dependencies are reported separately so they are left out.
+func findCycles(layers []layerfileLayer, byName map[string]layerfileLayer) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[string]int{}
+	stack := []string{}
+	seen := map[string]struct{}{}
+	cycles := [][]string{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, d := range byName[name].Dependencies {
+			if _, ok := byName[d]; !ok || d == name {
+				continue
+			}
+
+			switch state[d] {
+			case unvisited:
+				visit(d)
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != d {
+					start--
+				}
+
+				cycle := append(append([]string{}, stack[start:]...), d)
+				key := cycleKey(cycle)
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for _, l := range layers {
+		if state[l.Name] == unvisited {
+			visit(l.Name)
+		}
+	}
+
+	return cycles
+}
+
+// cycleKey identifies a cycle regardless of the layer it starts at.
+func cycleKey(cycle []string) string {
+	nodes := cycle[:len(cycle)-1]
+	smallest := 0
+	for i, n := range nodes {
+		if n < nodes[smallest] {
+			smallest = i
+		}
+	}
+
+	rotated := append(append([]string{}, nodes[smallest:]...), nodes[:smallest]...)
+	return strings.Join(rotated, "\x00")
+}
@@ -0,0 +1,148 @@
+package layerfile
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		layers   []layerfileLayer
+		expected []string
+	}{
+		{
+			name: "valid graph",
+			layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf"}},
+				{Name: "beta", Files: []string{"b.tf"}, Dependencies: []string{"alpha"}},
+				{Name: "gamma", Files: []string{"*.tf"}, Dependencies: []string{"alpha", "beta"}},
+			},
+		},
+		{
+			name: "unknown dependencies",
+			layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf"}, Dependencies: []string{"vpc"}},
+			},
+			expected: []string{"layer alpha depends on vpc which is not defined"},
+		},
+		{
+			name: "duplicated names",
+			layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf"}},
+				{Name: "alpha", Files: []string{"b.tf"}},
+			},
+			expected: []string{"layer alpha is defined more than once"},
+		},
+		{
+			name: "cycles",
+			layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf"}, Dependencies: []string{"gamma"}},
+				{Name: "beta", Files: []string{"b.tf"}, Dependencies: []string{"alpha"}},
+				{Name: "gamma", Files: []string{"b.tf"}, Dependencies: []string{"beta"}},
+				{Name: "delta", Files: []string{"a.tf"}, Dependencies: []string{"delta"}},
+			},
+			expected: []string{
+				"layer delta depends on itself",
+				"dependency cycle: alpha -> gamma -> beta -> alpha",
+			},
+		},
+		{
+			name: "files",
+			layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf", "missing.tf", "modules/**"}},
+				{Name: "beta"},
+				{Name: "gamma", Files: []string{"b.tf", "!b.tf"}},
+			},
+			expected: []string{
+				`pattern "missing.tf" of layer alpha matches no files`,
+				`pattern "modules/**" of layer alpha matches no files`,
+				"layer beta has no files",
+				`pattern "b.tf" of layer gamma matches files but every match is excluded by "!" patterns or .layerformignore`,
+				"layer gamma has no files",
+			},
+		},
+		{
+			name: "everything at once",
+			layers: []layerfileLayer{
+				{Name: "invalid name", Files: []string{"a.tf"}},
+				{Name: "alpha", Files: []string{"a.tf"}, Dependencies: []string{"beta", "vpc"}},
+				{Name: "beta", Dependencies: []string{"alpha"}},
+			},
+			expected: []string{
+				`"invalid name": invalid layer definition name`,
+				"layer alpha depends on vpc which is not defined",
+				"dependency cycle: alpha -> beta -> alpha",
+				"layer beta has no files",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range []string{"a.tf", "b.tf"} {
+				err := os.WriteFile(path.Join(dir, f), []byte(f), 0644)
+				require.NoError(t, err)
+			}
+
+			lf := &layerfile{
+				sourceFilepath: path.Join(dir, "layerform.json"),
+				Layers:         tt.layers,
+			}
+
+			err := lf.Validate(nil)
+			if len(tt.expected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var merr *multierror.Error
+			require.ErrorAs(t, err, &merr)
+
+			messages := make([]string, len(merr.Errors))
+			for i, e := range merr.Errors {
+				messages[i] = e.Error()
+			}
+			assert.Equal(t, tt.expected, messages)
+		})
+	}
+
+	t.Run("existing definitions", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(path.Join(dir, "a.tf"), []byte("a.tf"), 0644)
+		require.NoError(t, err)
+
+		existing := []*data.LayerDefinition{
+			{Name: "base"},
+			{Name: "alpha", Dependencies: []string{"vpc"}},
+			{Name: "beta", Dependencies: []string{"gamma"}},
+		}
+		lf := &layerfile{
+			sourceFilepath: path.Join(dir, "layerform.json"),
+			Layers: []layerfileLayer{
+				{Name: "alpha", Files: []string{"a.tf"}, Dependencies: []string{"base"}},
+				{Name: "gamma", Files: []string{"a.tf"}, Dependencies: []string{"beta"}},
+			},
+		}
+
+		err = lf.Validate(existing)
+		assert.EqualError(t, err, "1 error occurred:\n\t* dependency cycle: gamma -> beta -> gamma\n\n")
+	})
+
+	t.Run("invalid names are still detectable", func(t *testing.T) {
+		lf := &layerfile{
+			sourceFilepath: path.Join(t.TempDir(), "layerform.json"),
+			Layers:         []layerfileLayer{{Name: "invalid!"}},
+		}
+
+		assert.ErrorIs(t, lf.Validate(nil), ErrInvalidDefinitionName)
+	})
+}
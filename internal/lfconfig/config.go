@@ -2,6 +2,7 @@ package lfconfig
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"os"
 	"path"
@@ -11,10 +12,16 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/ergomake/layerform/internal/cloud"
+	"github.com/ergomake/layerform/internal/signing"
+	"github.com/ergomake/layerform/internal/sqlite"
 	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/command/drift"
 	"github.com/ergomake/layerform/pkg/command/kill"
 	"github.com/ergomake/layerform/pkg/command/refresh"
 	"github.com/ergomake/layerform/pkg/command/spawn"
+	"github.com/ergomake/layerform/pkg/command/upgrade"
+	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/envvars"
 	"github.com/ergomake/layerform/pkg/layerdefinitions"
 	"github.com/ergomake/layerform/pkg/layerinstances"
@@ -26,13 +33,60 @@ type configFile struct {
 }
 
 type ConfigContext struct {
-	Type     string `yaml:"type"`
-	Dir      string `yaml:"dir,omitempty"`
-	Bucket   string `yaml:"bucket,omitempty"`
-	Region   string `yaml:"region,omitempty"`
-	URL      string `yaml:"url,omitempty"`
-	Email    string `yaml:"email,omitempty"`
-	Password string `yaml:"password,omitempty"`
+	Type           string `yaml:"type"`
+	Dir            string `yaml:"dir,omitempty"`
+	File           string `yaml:"file,omitempty"`
+	Bucket         string `yaml:"bucket,omitempty"`
+	Region         string `yaml:"region,omitempty"`
+	Endpoint       string `yaml:"endpoint,omitempty"`
+	ForcePathStyle bool   `yaml:"forcePathStyle,omitempty"`
+	Profile        string `yaml:"profile,omitempty"`
+	KeyPrefix      string `yaml:"keyPrefix,omitempty"`
+	Credentials    string `yaml:"credentials,omitempty"`
+	URL            string `yaml:"url,omitempty"`
+	Email          string `yaml:"email,omitempty"`
+	Password       string `yaml:"password,omitempty"`
+	Backups        *int   `yaml:"backups,omitempty"`
+
+	Encryption *EncryptionConfig `yaml:"encryption,omitempty"`
+
+	// SigningKey signs the definitions saved by configure
+	SigningKey *SigningKeyConfig `yaml:"signingKey,omitempty"`
+	// TrustedKeys verify the definitions used by spawn, kill and refresh
+	TrustedKeys              []string `yaml:"trustedKeys,omitempty"`
+	RequireSignedDefinitions bool     `yaml:"requireSignedDefinitions,omitempty"`
+
+	// Terraform is the default terraform config of layers, the config of
+	// each layer is applied on top of it
+	Terraform *data.TerraformConfig `yaml:"terraform,omitempty"`
+
+	// Prefix is what KeyPrefix was called on gcs contexts, it is only read
+	// and moved to KeyPrefix when loading
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// EncryptionConfig enables encryption at rest of the files of local, s3 and
+// gcs contexts, exactly one key source must be set.
+type EncryptionConfig struct {
+	KeyEnv     string `yaml:"keyEnv,omitempty"`
+	KeyFile    string `yaml:"keyFile,omitempty"`
+	KeyCommand string `yaml:"keyCommand,omitempty"`
+}
+
+func (ec *EncryptionConfig) KeySource() storage.KeySource {
+	return storage.KeySource{Env: ec.KeyEnv, File: ec.KeyFile, Command: ec.KeyCommand}
+}
+
+// SigningKeyConfig tells where to read the ed25519 private key that signs
+// definitions from, exactly one key source must be set.
+type SigningKeyConfig struct {
+	KeyEnv     string `yaml:"keyEnv,omitempty"`
+	KeyFile    string `yaml:"keyFile,omitempty"`
+	KeyCommand string `yaml:"keyCommand,omitempty"`
+}
+
+func (sc *SigningKeyConfig) KeySource() storage.KeySource {
+	return storage.KeySource{Env: sc.KeyEnv, File: sc.KeyFile, Command: sc.KeyCommand}
 }
 
 func (cfg *ConfigContext) Location() string {
@@ -40,7 +94,17 @@ func (cfg *ConfigContext) Location() string {
 	case "local":
 		return fmt.Sprintf("dir://%s", cfg.Dir)
 	case "s3":
-		return fmt.Sprintf("s3://%s", cfg.Bucket)
+		location := fmt.Sprintf("s3://%s", path.Join(cfg.Bucket, cfg.KeyPrefix))
+		if cfg.Endpoint != "" {
+			location = fmt.Sprintf("%s (%s)", location, cfg.Endpoint)
+		}
+		return location
+	case "gcs":
+		return fmt.Sprintf("gs://%s", path.Join(cfg.Bucket, cfg.KeyPrefix))
+	case "sqlite":
+		return fmt.Sprintf("sqlite://%s", cfg.File)
+	case "git":
+		return fmt.Sprintf("git+dir://%s", cfg.Dir)
 	case "cloud":
 		return cfg.URL
 	}
@@ -68,6 +132,14 @@ func getDefaultPaths() ([]string, error) {
 type config struct {
 	*configFile
 	path string
+
+	// loaded once since key commands may prompt the user
+	encryptionKey *storage.EncryptionKey
+	signer        *signing.Signer
+
+	// set for configs returned by WithContext, they ignore the LF_CLOUD_*
+	// environment variables
+	pinned bool
 }
 
 func Init(name string, ctx ConfigContext, path string) (*config, error) {
@@ -86,8 +158,8 @@ func Init(name string, ctx ConfigContext, path string) (*config, error) {
 	}
 
 	return &config{
-		cfgFile,
-		path,
+		configFile: cfgFile,
+		path:       path,
 	}, nil
 }
 
@@ -129,6 +201,16 @@ func Load(path string) (*config, error) {
 			continue
 		}
 
+		for name, c := range cfg.Contexts {
+			if c.Prefix != "" {
+				if c.KeyPrefix == "" {
+					c.KeyPrefix = c.Prefix
+				}
+				c.Prefix = ""
+				cfg.Contexts[name] = c
+			}
+		}
+
 		return &config{configFile: &cfg, path: path}, nil
 	}
 
@@ -150,7 +232,25 @@ func (cfg *config) Save() error {
 	return errors.Wrap(err, "fail to write config file")
 }
 
+// WithContext returns a copy of the config with name as the current context,
+// allowing backends of more than one context to be used at the same time.
+func (c *config) WithContext(name string) (*config, error) {
+	if _, ok := c.Contexts[name]; !ok {
+		return nil, errors.Errorf("context %s not found", name)
+	}
+
+	return &config{
+		configFile: &configFile{CurrentContext: name, Contexts: c.Contexts},
+		path:       c.path,
+		pinned:     true,
+	}, nil
+}
+
 func (c *config) GetCurrent() ConfigContext {
+	if c.pinned {
+		return c.Contexts[c.CurrentContext]
+	}
+
 	url := strings.TrimSpace(os.Getenv("LF_CLOUD_URL"))
 	email := strings.TrimSpace(os.Getenv("LF_CLOUD_EMAIL"))
 	password := strings.TrimSpace(os.Getenv("LF_CLOUD_PASSWORD"))
@@ -176,6 +276,176 @@ func (c *config) getDir() string {
 	return dir
 }
 
+func (c *config) getSQLiteFile() string {
+	file := c.GetCurrent().File
+	if !path.IsAbs(file) {
+		file = path.Join(path.Dir(c.path), file)
+	}
+
+	return file
+}
+
+func (c *config) openSQLite(ctx context.Context) (*sql.DB, error) {
+	db, err := sqlite.Open(ctx, c.getSQLiteFile())
+	return db, errors.Wrap(err, "fail to initialize sqlite backend")
+}
+
+// GetEncryptionKey returns the key of the current context, or nil when the
+// context is not encrypted.
+func (c *config) GetEncryptionKey(ctx context.Context) (*storage.EncryptionKey, error) {
+	enc := c.GetCurrent().Encryption
+	if enc == nil {
+		return nil, nil
+	}
+
+	if c.encryptionKey == nil {
+		key, err := storage.LoadEncryptionKey(ctx, enc.KeySource())
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to load encryption key")
+		}
+
+		c.encryptionKey = key
+	}
+
+	return c.encryptionKey, nil
+}
+
+// GetSigner returns the signer of the current context, or nil when
+// definitions are not signed.
+func (c *config) GetSigner(ctx context.Context) (*signing.Signer, error) {
+	key := c.GetCurrent().SigningKey
+	if key == nil {
+		return nil, nil
+	}
+
+	if c.signer == nil {
+		signer, err := signing.LoadSigner(ctx, key.KeySource())
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to load signing key")
+		}
+
+		c.signer = signer
+	}
+
+	return c.signer, nil
+}
+
+// getVerifiedDefinitionsBackend returns the definitions backend used to run
+// terraform, it refuses definitions that fail the signature checks of the
+// current context.
+func (c *config) getVerifiedDefinitionsBackend(ctx context.Context) (layerdefinitions.Backend, error) {
+	backend, err := c.GetDefinitionsBackend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := c.GetCurrent()
+	if len(current.TrustedKeys) == 0 && !current.RequireSignedDefinitions {
+		return backend, nil
+	}
+
+	verifier, err := signing.NewVerifier(current.TrustedKeys, current.RequireSignedDefinitions)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to load trusted keys")
+	}
+
+	return layerdefinitions.NewVerifiedBackend(backend, verifier), nil
+}
+
+// encrypt wraps blob with the encryption key of the current context, blobs of
+// contexts without encryption are wrapped too so encrypted content is never
+// mistaken for an empty file.
+func (c *config) encrypt(ctx context.Context, blob storage.FileLike) (storage.FileLike, error) {
+	key, err := c.GetEncryptionKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.NewEncryptedStorage(blob, key), nil
+}
+
+// GetRawStorages returns the unencrypted storages of every file of the
+// current context, only available for contexts backed by files. They never
+// take backups, backups would keep the content being replaced.
+func (c *config) GetRawStorages(ctx context.Context) ([]storage.FileLike, error) {
+	current := c.GetCurrent()
+	fnames := []string{definitionsFileName, stateFileName, envVarsFileName}
+	blobs := make([]storage.FileLike, len(fnames))
+	for i, fname := range fnames {
+		switch current.Type {
+		case "local":
+			blobs[i] = storage.NewFileStorage(path.Join(c.getDir(), fname), 0)
+		case "s3":
+			b, err := c.newS3Storage(fname)
+			if err != nil {
+				return nil, errors.Wrap(err, "fail to initialize s3 backend")
+			}
+			blobs[i] = b
+		case "gcs":
+			b, err := c.newGCSStorage(ctx, fname)
+			if err != nil {
+				return nil, errors.Wrap(err, "fail to initialize gcs backend")
+			}
+			blobs[i] = b
+		case "git":
+			b, err := c.newGitStorage(ctx, fname)
+			if err != nil {
+				return nil, errors.Wrap(err, "fail to initialize git backend")
+			}
+			blobs[i] = b
+		default:
+			return nil, errors.Errorf("contexts of type \"%s\" are not backed by files", current.Type)
+		}
+	}
+
+	return blobs, nil
+}
+
+const defaultBackups = 5
+
+func (c *config) newFileStorage(fname string) storage.BackupStorage {
+	backups := defaultBackups
+	if b := c.GetCurrent().Backups; b != nil {
+		backups = *b
+	}
+
+	return storage.NewFileStorage(path.Join(c.getDir(), fname), backups)
+}
+
+// GetBackupStorages returns the storages of every file of the current
+// context, only contexts of type "local" keep backups.
+func (c *config) GetBackupStorages(ctx context.Context) ([]storage.BackupStorage, error) {
+	current := c.GetCurrent()
+	if current.Type != "local" {
+		return nil, errors.Errorf("backups are only available for contexts of type \"local\" but current has type \"%s\"", current.Type)
+	}
+
+	return []storage.BackupStorage{
+		c.newFileStorage(definitionsFileName),
+		c.newFileStorage(stateFileName),
+		c.newFileStorage(envVarsFileName),
+	}, nil
+}
+
+func (c *config) newS3Storage(fname string) (storage.FileLike, error) {
+	current := c.GetCurrent()
+	return storage.NewS3Backend(current.Bucket, path.Join(current.KeyPrefix, fname), storage.S3Options{
+		Region:         current.Region,
+		Endpoint:       current.Endpoint,
+		ForcePathStyle: current.ForcePathStyle,
+		Profile:        current.Profile,
+	})
+}
+
+func (c *config) newGitStorage(ctx context.Context, fname string) (storage.FileLike, error) {
+	return storage.NewGitStorage(ctx, c.getDir(), fname)
+}
+
+func (c *config) newGCSStorage(ctx context.Context, fname string) (storage.FileLike, error) {
+	current := c.GetCurrent()
+	return storage.NewGCSBackend(ctx, current.Bucket, path.Join(current.KeyPrefix, fname), current.Credentials)
+}
+
 const stateFileName = "layerform.lfstate"
 
 func (c *config) GetInstancesBackend(ctx context.Context) (layerinstances.Backend, error) {
@@ -183,7 +453,7 @@ func (c *config) GetInstancesBackend(ctx context.Context) (layerinstances.Backen
 	var blob storage.FileLike
 	switch current.Type {
 	case "local":
-		blob = storage.NewFileStorage(path.Join(c.getDir(), stateFileName))
+		blob = c.newFileStorage(stateFileName)
 	case "cloud":
 		cloudClient, err := c.GetCloudClient(ctx)
 		if err != nil {
@@ -192,11 +462,35 @@ func (c *config) GetInstancesBackend(ctx context.Context) (layerinstances.Backen
 
 		return layerinstances.NewCloud(cloudClient), nil
 	case "s3":
-		b, err := storage.NewS3Backend(current.Bucket, stateFileName, current.Region)
+		b, err := c.newS3Storage(stateFileName)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to initialize s3 backend")
 		}
 		blob = b
+	case "gcs":
+		b, err := c.newGCSStorage(ctx, stateFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize gcs backend")
+		}
+		blob = b
+	case "git":
+		b, err := c.newGitStorage(ctx, stateFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize git backend")
+		}
+		blob = b
+	case "sqlite":
+		db, err := c.openSQLite(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return layerinstances.NewSQLiteBackend(db), nil
+	}
+
+	blob, err := c.encrypt(ctx, blob)
+	if err != nil {
+		return nil, err
 	}
 
 	return layerinstances.NewFileLikeBackend(ctx, blob)
@@ -221,13 +515,37 @@ func (c *config) GetDefinitionsBackend(ctx context.Context) (layerdefinitions.Ba
 
 		return layerdefinitions.NewCloud(cloudClient), nil
 	case "local":
-		blob = storage.NewFileStorage(path.Join(c.getDir(), definitionsFileName))
+		blob = c.newFileStorage(definitionsFileName)
 	case "s3":
-		b, err := storage.NewS3Backend(current.Bucket, definitionsFileName, current.Region)
+		b, err := c.newS3Storage(definitionsFileName)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to initialize s3 backend")
 		}
 		blob = b
+	case "gcs":
+		b, err := c.newGCSStorage(ctx, definitionsFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize gcs backend")
+		}
+		blob = b
+	case "git":
+		b, err := c.newGitStorage(ctx, definitionsFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize git backend")
+		}
+		blob = b
+	case "sqlite":
+		db, err := c.openSQLite(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return layerdefinitions.NewSQLiteBackend(db, current.Location()), nil
+	}
+
+	blob, err := c.encrypt(ctx, blob)
+	if err != nil {
+		return nil, err
 	}
 
 	return layerdefinitions.NewFileLikeBackend(ctx, blob)
@@ -246,8 +564,14 @@ func (c *config) GetSpawnCommand(ctx context.Context) (spawn.Spawn, error) {
 		return spawn.NewCloud(cloudClient), nil
 	case "s3":
 		fallthrough
+	case "gcs":
+		fallthrough
+	case "sqlite":
+		fallthrough
+	case "git":
+		fallthrough
 	case "local":
-		layersBackend, err := c.GetDefinitionsBackend(ctx)
+		layersBackend, err := c.getVerifiedDefinitionsBackend(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to get layers backend")
 		}
@@ -262,7 +586,7 @@ func (c *config) GetSpawnCommand(ctx context.Context) (spawn.Spawn, error) {
 			return nil, errors.Wrap(err, "fail to get env vars backend")
 		}
 
-		return spawn.NewLocal(layersBackend, instancesBackend, envVarsBackend), nil
+		return spawn.NewLocal(layersBackend, instancesBackend, envVarsBackend, c.GetCurrent().Terraform), nil
 	}
 
 	return nil, errors.Errorf("fail to get spawn command unexpected context type %s", current.Type)
@@ -281,8 +605,14 @@ func (c *config) GetKillCommand(ctx context.Context) (kill.Kill, error) {
 		return kill.NewCloud(cloudClient), nil
 	case "s3":
 		fallthrough
+	case "gcs":
+		fallthrough
+	case "sqlite":
+		fallthrough
+	case "git":
+		fallthrough
 	case "local":
-		layersBackend, err := c.GetDefinitionsBackend(ctx)
+		layersBackend, err := c.getVerifiedDefinitionsBackend(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to get layers backend")
 		}
@@ -297,7 +627,7 @@ func (c *config) GetKillCommand(ctx context.Context) (kill.Kill, error) {
 			return nil, errors.Wrap(err, "fail to get env vars backend")
 		}
 
-		return kill.NewLocal(layersBackend, instancesBackend, envVarsBackend), nil
+		return kill.NewLocal(layersBackend, instancesBackend, envVarsBackend, c.GetCurrent().Terraform), nil
 	}
 
 	return nil, errors.Errorf("fail to get kill command unexpected context type %s", current.Type)
@@ -316,8 +646,14 @@ func (c *config) GetRefreshCommand(ctx context.Context) (refresh.Refresh, error)
 		return refresh.NewCloud(cloudClient), nil
 	case "s3":
 		fallthrough
+	case "gcs":
+		fallthrough
+	case "sqlite":
+		fallthrough
+	case "git":
+		fallthrough
 	case "local":
-		layersBackend, err := c.GetDefinitionsBackend(ctx)
+		layersBackend, err := c.getVerifiedDefinitionsBackend(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to get layers backend")
 		}
@@ -332,17 +668,109 @@ func (c *config) GetRefreshCommand(ctx context.Context) (refresh.Refresh, error)
 			return nil, errors.Wrap(err, "fail to get env vars backend")
 		}
 
-		return refresh.NewLocal(layersBackend, instancesBackend, envVarsBackend), nil
+		return refresh.NewLocal(layersBackend, instancesBackend, envVarsBackend, c.GetCurrent().Terraform), nil
 	}
 
 	return nil, errors.Errorf("fail to get spawn command unexpected context type %s", current.Type)
 }
 
+func (c *config) GetDriftCommand(ctx context.Context) (drift.Drift, error) {
+	current := c.GetCurrent()
+
+	switch current.Type {
+	case "cloud":
+		return nil, errors.New("drift detection is not supported by contexts of type cloud")
+	case "s3":
+		fallthrough
+	case "gcs":
+		fallthrough
+	case "sqlite":
+		fallthrough
+	case "git":
+		fallthrough
+	case "local":
+		layersBackend, err := c.getVerifiedDefinitionsBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get layers backend")
+		}
+
+		instancesBackend, err := c.GetInstancesBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get instance backend")
+		}
+
+		envVarsBackend, err := c.GetEnvVarsBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get env vars backend")
+		}
+
+		return drift.NewLocal(layersBackend, instancesBackend, envVarsBackend, c.GetCurrent().Terraform), nil
+	}
+
+	return nil, errors.Errorf("fail to get drift command unexpected context type %s", current.Type)
+}
+
+func (c *config) GetUpgradeCommand(ctx context.Context) (upgrade.Upgrade, error) {
+	current := c.GetCurrent()
+
+	switch current.Type {
+	case "cloud":
+		return nil, errors.New("upgrade is not supported by contexts of type cloud")
+	case "s3":
+		fallthrough
+	case "gcs":
+		fallthrough
+	case "sqlite":
+		fallthrough
+	case "git":
+		fallthrough
+	case "local":
+		layersBackend, err := c.getVerifiedDefinitionsBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get layers backend")
+		}
+
+		instancesBackend, err := c.GetInstancesBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get instance backend")
+		}
+
+		envVarsBackend, err := c.GetEnvVarsBackend(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to get env vars backend")
+		}
+
+		return upgrade.NewLocal(layersBackend, instancesBackend, envVarsBackend, c.GetCurrent().Terraform), nil
+	}
+
+	return nil, errors.Errorf("fail to get upgrade command unexpected context type %s", current.Type)
+}
+
+// GetContextBackends returns every backend of the current context.
+func (c *config) GetContextBackends(ctx context.Context) (command.ContextBackends, error) {
+	definitions, err := c.GetDefinitionsBackend(ctx)
+	if err != nil {
+		return command.ContextBackends{}, errors.Wrap(err, "fail to get definitions backend")
+	}
+
+	instances, err := c.GetInstancesBackend(ctx)
+	if err != nil {
+		return command.ContextBackends{}, errors.Wrap(err, "fail to get instances backend")
+	}
+
+	envVars, err := c.GetEnvVarsBackend(ctx)
+	if err != nil {
+		return command.ContextBackends{}, errors.Wrap(err, "fail to get env vars backend")
+	}
+
+	return command.ContextBackends{Definitions: definitions, Instances: instances, EnvVars: envVars}, nil
+}
+
 const envVarsFileName = "layerform.env"
 
 func (c *config) GetEnvVarsBackend(ctx context.Context) (envvars.Backend, error) {
 	current := c.GetCurrent()
-
+	var blob storage.FileLike
 	switch current.Type {
 	case "cloud":
 		cloudClient, err := c.GetCloudClient(ctx)
@@ -352,16 +780,40 @@ func (c *config) GetEnvVarsBackend(ctx context.Context) (envvars.Backend, error)
 
 		return envvars.NewCloud(cloudClient), nil
 	case "s3":
-		s3, err := storage.NewS3Backend(current.Bucket, envVarsFileName, current.Region)
+		s3, err := c.newS3Storage(envVarsFileName)
 		if err != nil {
 			return nil, errors.Wrap(err, "fail to initialize s3 backend")
 		}
+		blob = s3
+	case "gcs":
+		gcs, err := c.newGCSStorage(ctx, envVarsFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize gcs backend")
+		}
+		blob = gcs
+	case "git":
+		git, err := c.newGitStorage(ctx, envVarsFileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to initialize git backend")
+		}
+		blob = git
+	case "sqlite":
+		db, err := c.openSQLite(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-		return envvars.NewFileLikeBackend(ctx, s3)
+		return envvars.NewSQLiteBackend(db), nil
 	case "local":
-		fileStorage := storage.NewFileStorage(path.Join(c.getDir(), envVarsFileName))
-		return envvars.NewFileLikeBackend(ctx, fileStorage)
+		blob = c.newFileStorage(envVarsFileName)
+	default:
+		return nil, errors.Errorf("fail to get set-env command unexpected context type %s", current.Type)
+	}
+
+	blob, err := c.encrypt(ctx, blob)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.Errorf("fail to get set-env command unexpected context type %s", current.Type)
+	return envvars.NewFileLikeBackend(ctx, blob)
 }
@@ -54,4 +54,23 @@ contexts:
 		assert.Equal(t, "context", cfg.CurrentContext)
 		assert.Equal(t, map[string]ConfigContext{"context": {Type: "local", Dir: "test-dir"}}, cfg.Contexts)
 	})
+
+	t.Run("reads the prefix of gcs contexts as key prefix", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		fpath := path.Join(tmpDir, "config")
+		raw := `currentContext: context
+contexts:
+  context:
+    type: gcs
+    bucket: bucket
+    prefix: team-a`
+
+		err := os.WriteFile(fpath, []byte(raw), 0644)
+		require.NoError(t, err)
+
+		cfg, err := Load(fpath)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]ConfigContext{"context": {Type: "gcs", Bucket: "bucket", KeyPrefix: "team-a"}}, cfg.Contexts)
+	})
 }
@@ -1,9 +1,13 @@
 package lfconfig
 
 import (
+	"os/exec"
+
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 
+	"github.com/ergomake/layerform/internal/signing"
+	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/validation"
 )
 
@@ -17,6 +21,10 @@ func Validate(ctx ConfigContext) error {
 		} else if !validation.IsValidDirectory(ctx.Dir) {
 			result = multierror.Append(result, errors.Errorf("invalid directory path: %s", ctx.Dir))
 		}
+
+		if ctx.Backups != nil && *ctx.Backups < 0 {
+			result = multierror.Append(result, errors.Errorf("number of backups cannot be negative: %d", *ctx.Backups))
+		}
 	case "s3":
 		if ctx.Bucket == "" {
 			result = multierror.Append(result, errors.New("S3 bucket name cannot be empty"))
@@ -24,11 +32,43 @@ func Validate(ctx ConfigContext) error {
 			result = multierror.Append(result, errors.Errorf("invalid S3 bucket name: %s", ctx.Bucket))
 		}
 
+		// S3 compatible stores usually don't care about the region and
+		// profiles may define their own
 		if ctx.Region == "" {
-			result = multierror.Append(result, errors.New("S3 bucket region cannot be empty"))
+			if ctx.Endpoint == "" && ctx.Profile == "" {
+				result = multierror.Append(result, errors.New("S3 bucket region cannot be empty"))
+			}
 		} else if !validation.IsValidS3Region(ctx.Region) {
 			result = multierror.Append(result, errors.Errorf("invalid S3 bucket region: %s", ctx.Region))
 		}
+
+		if ctx.Endpoint != "" && !validation.IsValidS3Endpoint(ctx.Endpoint) {
+			result = multierror.Append(result, errors.Errorf("invalid S3 endpoint, must be an http or https URL: %s", ctx.Endpoint))
+		}
+	case "gcs":
+		if ctx.Bucket == "" {
+			result = multierror.Append(result, errors.New("GCS bucket name cannot be empty"))
+		} else if !validation.IsValidGCSBucket(ctx.Bucket) {
+			result = multierror.Append(result, errors.Errorf("invalid GCS bucket name: %s", ctx.Bucket))
+		}
+
+		if ctx.Credentials != "" && !validation.IsValidFile(ctx.Credentials) {
+			result = multierror.Append(result, errors.Errorf("GCS credentials file not found: %s", ctx.Credentials))
+		}
+	case "git":
+		if ctx.Dir == "" {
+			result = multierror.Append(result, errors.New("repository directory path cannot be empty"))
+		} else if !validation.IsValidDirectory(ctx.Dir) {
+			result = multierror.Append(result, errors.Errorf("invalid repository directory path: %s", ctx.Dir))
+		}
+
+		if _, err := exec.LookPath("git"); err != nil {
+			result = multierror.Append(result, errors.New("git must be installed to use contexts of type git"))
+		}
+	case "sqlite":
+		if ctx.File == "" {
+			result = multierror.Append(result, errors.New("sqlite database file path cannot be empty"))
+		}
 	case "cloud":
 		if ctx.Email == "" {
 			result = multierror.Append(result, errors.New("email cannot be empty"))
@@ -47,5 +87,84 @@ func Validate(ctx ConfigContext) error {
 		return errors.New("invalid context type")
 	}
 
+	if ctx.Encryption != nil {
+		switch ctx.Type {
+		case "local", "s3", "gcs", "git":
+			err := ValidateEncryption(*ctx.Encryption)
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+		default:
+			result = multierror.Append(result, errors.Errorf("encryption is not supported by contexts of type %s", ctx.Type))
+		}
+	}
+
+	if ctx.SigningKey != nil || len(ctx.TrustedKeys) > 0 || ctx.RequireSignedDefinitions {
+		if ctx.Type == "cloud" {
+			result = multierror.Append(result, errors.New("signed definitions are not supported by contexts of type cloud"))
+		}
+	}
+
+	if ctx.SigningKey != nil {
+		err := ValidateSigningKey(*ctx.SigningKey)
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	for _, k := range ctx.TrustedKeys {
+		_, err := signing.ParsePublicKey(k)
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	err := terraform.Validate(ctx.Terraform)
+	if err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if ctx.RequireSignedDefinitions && len(ctx.TrustedKeys) == 0 {
+		result = multierror.Append(result, errors.New("requiring signed definitions needs at least one trusted key"))
+	}
+
 	return result.ErrorOrNil()
 }
+
+func ValidateSigningKey(key SigningKeyConfig) error {
+	sources := 0
+	for _, s := range []string{key.KeyEnv, key.KeyFile, key.KeyCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return errors.New("signing requires exactly one of key env, key file or key command")
+	}
+
+	if key.KeyFile != "" && !validation.IsValidFile(key.KeyFile) {
+		return errors.Errorf("signing key file not found: %s", key.KeyFile)
+	}
+
+	return nil
+}
+
+func ValidateEncryption(enc EncryptionConfig) error {
+	sources := 0
+	for _, s := range []string{enc.KeyEnv, enc.KeyFile, enc.KeyCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return errors.New("encryption requires exactly one of key env, key file or key command")
+	}
+
+	if enc.KeyFile != "" && !validation.IsValidFile(enc.KeyFile) {
+		return errors.Errorf("encryption key file not found: %s", enc.KeyFile)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package migrations upgrades versioned documents and database schemas one
+// version at a time.
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// JSONMigration upgrades a document from version N to version N+1.
+type JSONMigration func(b []byte) ([]byte, error)
+
+type version struct {
+	Version uint `json:"version"`
+}
+
+// UpgradeJSON applies to b every migration from the document "version" field
+// onwards, migrations[i] upgrading version i to i+1 so the latest version is
+// len(migrations). The returned document does not have its "version" field
+// updated, callers should decode it and set the version themselves.
+func UpgradeJSON(b []byte, migrations []JSONMigration, kind string) ([]byte, error) {
+	var v version
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := uint(len(migrations))
+	if v.Version > latest {
+		return nil, errors.Errorf("%s was created using a newer version of layerform", kind)
+	}
+
+	for i := v.Version; i < latest; i++ {
+		b, err = migrations[i](b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to migrate %s from version %d to %d", kind, i, i+1)
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestUpgradeJSON(t *testing.T) {
+	migrations := []JSONMigration{
+		func(b []byte) ([]byte, error) { return []byte(`{"version":1,"steps":"a"}`), nil },
+		func(b []byte) ([]byte, error) { return append(b[:len(b)-2], []byte(`b"}`)...), nil },
+	}
+
+	t.Run("applies every pending migration in order", func(t *testing.T) {
+		b, err := UpgradeJSON([]byte(`{"old":true}`), migrations, "doc")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"version":1,"steps":"ab"}`, string(b))
+	})
+
+	t.Run("skips applied migrations", func(t *testing.T) {
+		b, err := UpgradeJSON([]byte(`{"version":2,"steps":"x"}`), migrations, "doc")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"version":2,"steps":"x"}`, string(b))
+	})
+
+	t.Run("refuses newer versions", func(t *testing.T) {
+		_, err := UpgradeJSON([]byte(`{"version":3}`), migrations, "doc")
+		assert.ErrorContains(t, err, "doc was created using a newer version of layerform")
+	})
+}
+
+func TestMigrateSQL(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	v1 := []SQLMigration{{Name: "create", Statements: []string{"CREATE TABLE t (a TEXT)"}}}
+	require.NoError(t, MigrateSQL(ctx, db, v1))
+	require.NoError(t, MigrateSQL(ctx, db, v1), "applied migrations are not applied again")
+
+	v2 := append(v1, SQLMigration{Name: "add column", Statements: []string{"ALTER TABLE t ADD COLUMN b TEXT"}})
+	require.NoError(t, MigrateSQL(ctx, db, v2))
+
+	_, err = db.Exec("INSERT INTO t (a, b) VALUES ('a', 'b')")
+	require.NoError(t, err)
+
+	err = MigrateSQL(ctx, db, v1)
+	assert.ErrorContains(t, err, "newer version of layerform")
+
+	t.Run("failed migrations are rolled back", func(t *testing.T) {
+		v3 := append(v2, SQLMigration{Name: "broken", Statements: []string{
+			"CREATE TABLE u (a TEXT)",
+			"NOT SQL",
+		}})
+		err := MigrateSQL(ctx, db, v3)
+		assert.ErrorContains(t, err, "fail to apply migration 3 broken")
+
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'u'").Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+// SQLMigration is a named set of statements that upgrade a schema from
+// version N to version N+1.
+type SQLMigration struct {
+	Name       string
+	Statements []string
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// MigrateSQL applies the pending migrations to db, each one in its own
+// transaction, and records them in the schema_migrations table. migrations[i]
+// upgrades the schema to version i+1.
+func MigrateSQL(ctx context.Context, db *sql.DB, migrations []SQLMigration) error {
+	logger := hclog.FromContext(ctx)
+
+	_, err := db.ExecContext(ctx, createMigrationsTable)
+	if err != nil {
+		return errors.Wrap(err, "fail to create schema_migrations table")
+	}
+
+	for i, m := range migrations {
+		version := i + 1
+		applied, err := applySQLMigration(ctx, db, version, m)
+		if err != nil {
+			return errors.Wrapf(err, "fail to apply migration %d %s", version, m.Name)
+		}
+
+		if applied {
+			logger.Debug("Applied schema migration", "version", version, "name", m.Name)
+		}
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return errors.Wrap(err, "fail to read schema version")
+	}
+
+	if current > len(migrations) {
+		return errors.New("database was created using a newer version of layerform")
+	}
+
+	return nil
+}
+
+func applySQLMigration(ctx context.Context, db *sql.DB, version int, m SQLMigration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	// checked inside the transaction so concurrent processes apply each
+	// migration only once
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?", version).Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "fail to check if migration was applied")
+	}
+
+	if count > 0 {
+		return false, nil
+	}
+
+	for _, stmt := range m.Statements {
+		_, err := tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", version, m.Name)
+	if err != nil {
+		return false, errors.Wrap(err, "fail to record migration")
+	}
+
+	return true, errors.Wrap(tx.Commit(), "fail to commit migration")
+}
@@ -0,0 +1,98 @@
+package pathutils
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnsafePath = errors.New("unsafe path")
+
+// ValidateRelative checks that p, a slash separated path taken from a layer
+// definition, is relative and stays inside of the directory it is relative
+// to. With allowParents it may go up with leading ".." segments, like the
+// paths of modules do, but it must not go up again after going down.
+func ValidateRelative(p string, allowParents bool) error {
+	if p == "" {
+		return errors.Wrap(ErrUnsafePath, "path is empty")
+	}
+
+	if strings.ContainsRune(p, 0) {
+		return errors.Wrapf(ErrUnsafePath, "%q contains a null byte", p)
+	}
+
+	if path.IsAbs(p) || filepath.IsAbs(p) || strings.HasPrefix(p, `\`) || filepath.VolumeName(p) != "" {
+		return errors.Wrapf(ErrUnsafePath, "%q is absolute", p)
+	}
+
+	if strings.Contains(p, `\`) {
+		return errors.Wrapf(ErrUnsafePath, "%q contains a backslash", p)
+	}
+
+	rest := path.Clean(p)
+	parents := ParentSegments(rest)
+	if parents > 0 && !allowParents {
+		return errors.Wrapf(ErrUnsafePath, "%q goes outside of its directory", p)
+	}
+
+	for i := 0; i < parents; i++ {
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, ".."), "/")
+	}
+
+	if rest == "" || rest == "." {
+		return errors.Wrapf(ErrUnsafePath, "%q is not a file", p)
+	}
+
+	return nil
+}
+
+// ParentSegments counts how many directories p goes up before going down.
+func ParentSegments(p string) int {
+	n := 0
+	for _, segment := range strings.Split(path.Clean(p), "/") {
+		if segment != ".." {
+			break
+		}
+		n++
+	}
+
+	return n
+}
+
+// CheckInside makes sure target is base or is inside of it, and that no
+// existing element of target below base is a symbolic link.
+func CheckInside(base, target string) error {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get %s relative to %s", target, base)
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return errors.Wrapf(ErrUnsafePath, "%s is outside of %s", target, base)
+	}
+
+	current := base
+	for _, segment := range strings.Split(rel, string(filepath.Separator)) {
+		if segment == "." {
+			continue
+		}
+
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to stat %s", current)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Wrapf(ErrUnsafePath, "%s is a symbolic link", current)
+		}
+	}
+
+	return nil
+}
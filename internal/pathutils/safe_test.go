@@ -0,0 +1,57 @@
+package pathutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRelative(t *testing.T) {
+	tests := []struct {
+		path         string
+		allowParents bool
+		valid        bool
+	}{
+		{"main.tf", false, true},
+		{"layers/eks/main.tf", false, true},
+		{"layers/../main.tf", false, true},
+		{"../../.bashrc", false, false},
+		{"layers/../../main.tf", false, false},
+		{"/etc/passwd", false, false},
+		{`C:\Windows\win.ini`, false, false},
+		{`..\..\.bashrc`, false, false},
+		{"main.tf\x00", false, false},
+		{"", false, false},
+		{".", false, false},
+		{"../modules/vpc/main.tf", true, true},
+		{"modules/../../modules/vpc/main.tf", true, true},
+		{"..", true, false},
+		{"/etc/passwd", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := ValidateRelative(tt.path, tt.allowParents)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrUnsafePath)
+			}
+		})
+	}
+}
+
+func TestCheckInside(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(base, "dir"), 0755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(base, "link")))
+
+	assert.NoError(t, CheckInside(base, filepath.Join(base, "dir", "main.tf")))
+	assert.NoError(t, CheckInside(base, filepath.Join(base, "new", "main.tf")), "missing elements are fine")
+	assert.ErrorIs(t, CheckInside(base, filepath.Join(base, "..", "main.tf")), ErrUnsafePath)
+	assert.ErrorIs(t, CheckInside(base, filepath.Join(base, "link", "main.tf")), ErrUnsafePath)
+}
@@ -0,0 +1,202 @@
+// Package signing signs layer definitions with ed25519 keys and verifies
+// them against a set of trusted public keys.
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+var (
+	ErrUnsigned         = errors.New("layer definition is not signed")
+	ErrUntrustedKey     = errors.New("layer definition is signed by an untrusted key")
+	ErrInvalidSignature = errors.New("invalid layer definition signature")
+)
+
+// KeyID identifies a public key by the first bytes of its sha256.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// payload is what gets signed. It covers the same content as the SHA of the
+// layer, hashed with sha256 since sha1 collisions can be crafted, and the
+// name of the layer, which no hash covers.
+func payload(layer *data.LayerDefinition) ([]byte, error) {
+	sum, err := data.LayerDefinitionSHA256(layer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to compute sha256 of layer %s", layer.Name)
+	}
+
+	return []byte(fmt.Sprintf("layerform-definition-v2\nname:%s\nsha256:%x\n", layer.Name, sum)), nil
+}
+
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key}
+}
+
+// LoadSigner reads the private key pointed by src. Keys are either 32 random
+// bytes encoded in base64, e.g. the output of "openssl rand -base64 32", or
+// PEM encoded PKCS #8 keys like the ones generated by
+// "openssl genpkey -algorithm ed25519".
+func LoadSigner(ctx context.Context, src storage.KeySource) (*Signer, error) {
+	raw, err := storage.ReadKey(ctx, src, "signing key")
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to parse PEM signing key")
+		}
+
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("signing key must be an ed25519 key but is %T", key)
+		}
+
+		return NewSigner(edKey), nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to decode signing key, it must be PEM or base64 encoded")
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.Errorf("signing key must have %d bytes but has %d", ed25519.SeedSize, len(seed))
+	}
+
+	return NewSigner(ed25519.NewKeyFromSeed(seed)), nil
+}
+
+// PublicKey returns the public key of the signer encoded in base64, the way
+// it is listed in the trusted keys of a context.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+func (s *Signer) KeyID() string {
+	return KeyID(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign sets the signature of layer.
+func (s *Signer) Sign(layer *data.LayerDefinition) error {
+	p, err := payload(layer)
+	if err != nil {
+		return err
+	}
+
+	layer.Signature = &data.LayerDefinitionSignature{
+		KeyID:     s.KeyID(),
+		Signature: ed25519.Sign(s.key, p),
+	}
+
+	return nil
+}
+
+type Verifier struct {
+	keys    map[string]ed25519.PublicKey
+	require bool
+}
+
+// NewVerifier trusts every key of trustedKeys, encoded in base64 or as PEM
+// public keys. With requireSigned, unsigned definitions are refused.
+func NewVerifier(trustedKeys []string, requireSigned bool) (*Verifier, error) {
+	keys := map[string]ed25519.PublicKey{}
+	for _, k := range trustedKeys {
+		pub, err := ParsePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[KeyID(pub)] = pub
+	}
+
+	return &Verifier{keys, requireSigned}, nil
+}
+
+func ParsePublicKey(raw string) (ed25519.PublicKey, error) {
+	raw = strings.TrimSpace(raw)
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to parse PEM public key")
+		}
+
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("trusted key must be an ed25519 key but is %T", key)
+		}
+
+		return pub, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to decode trusted key %q, it must be PEM or base64 encoded", raw)
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("trusted key %q must have %d bytes but has %d", raw, ed25519.PublicKeySize, len(b))
+	}
+
+	return ed25519.PublicKey(b), nil
+}
+
+// Verify checks that layer was signed by a trusted key and that its files
+// were not changed after signing. Unsigned layers are only accepted when
+// signatures are not required.
+func (v *Verifier) Verify(layer *data.LayerDefinition) error {
+	if layer.Signature == nil {
+		if v.require {
+			return errors.Wrapf(ErrUnsigned, "layer %s", layer.Name)
+		}
+
+		return nil
+	}
+
+	pub, ok := v.keys[layer.Signature.KeyID]
+	if !ok {
+		return errors.Wrapf(ErrUntrustedKey, "layer %s is signed by key %s", layer.Name, layer.Signature.KeyID)
+	}
+
+	// the sha is not signed but versions are looked up by it
+	sha, err := data.LayerDefinitionSHA(layer)
+	if err != nil {
+		return errors.Wrapf(err, "fail to compute sha1 of layer %s", layer.Name)
+	}
+
+	if !bytes.Equal(sha, layer.SHA) {
+		return errors.Wrapf(ErrInvalidSignature, "content of layer %s does not match its sha", layer.Name)
+	}
+
+	p, err := payload(layer)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, p, layer.Signature.Signature) {
+		return errors.Wrapf(ErrInvalidSignature, "layer %s", layer.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func newTestLayer(t *testing.T, name, content string) *data.LayerDefinition {
+	layer := &data.LayerDefinition{
+		Name:         name,
+		Files:        []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte(content)}},
+		Dependencies: []string{},
+	}
+
+	sha, err := data.LayerDefinitionSHA(layer)
+	require.NoError(t, err)
+	layer.SHA = sha
+
+	return layer
+}
+
+func newTestSigner(b byte) *Signer {
+	return NewSigner(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{b}, ed25519.SeedSize)))
+}
+
+func TestVerifier(t *testing.T) {
+	signer := newTestSigner(1)
+	other := newTestSigner(2)
+
+	verifier, err := NewVerifier([]string{signer.PublicKey()}, false)
+	require.NoError(t, err)
+	requireSigned, err := NewVerifier([]string{signer.PublicKey()}, true)
+	require.NoError(t, err)
+
+	t.Run("signed layers are verified", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+		require.NoError(t, signer.Sign(layer))
+
+		assert.Equal(t, signer.KeyID(), layer.Signature.KeyID)
+		assert.NoError(t, verifier.Verify(layer))
+		assert.NoError(t, requireSigned.Verify(layer))
+	})
+
+	t.Run("unsigned layers are only refused when signatures are required", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+
+		assert.NoError(t, verifier.Verify(layer))
+		assert.ErrorIs(t, requireSigned.Verify(layer), ErrUnsigned)
+	})
+
+	t.Run("untrusted keys are refused", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+		require.NoError(t, other.Sign(layer))
+
+		assert.ErrorIs(t, verifier.Verify(layer), ErrUntrustedKey)
+	})
+
+	t.Run("changed content is refused", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+		require.NoError(t, signer.Sign(layer))
+		layer.Files[0].Content = []byte("changed")
+
+		assert.ErrorIs(t, verifier.Verify(layer), ErrInvalidSignature)
+
+		sha, err := data.LayerDefinitionSHA(layer)
+		require.NoError(t, err)
+		layer.SHA = sha
+		assert.ErrorIs(t, verifier.Verify(layer), ErrInvalidSignature, "content is signed, not the sha")
+	})
+
+	t.Run("sha must match the content", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+		require.NoError(t, signer.Sign(layer))
+		layer.SHA = []byte("other version")
+
+		assert.ErrorIs(t, verifier.Verify(layer), ErrInvalidSignature)
+	})
+
+	t.Run("renamed layers are refused", func(t *testing.T) {
+		layer := newTestLayer(t, "base", "content")
+		require.NoError(t, signer.Sign(layer))
+		layer.Name = "other"
+
+		assert.ErrorIs(t, verifier.Verify(layer), ErrInvalidSignature)
+	})
+}
+
+func TestLoadSigner(t *testing.T) {
+	ctx := context.Background()
+	seed := bytes.Repeat([]byte{1}, ed25519.SeedSize)
+	expected := newTestSigner(1).PublicKey()
+
+	t.Run("base64 seed", func(t *testing.T) {
+		t.Setenv("LF_TEST_SIGNING_KEY", base64.StdEncoding.EncodeToString(seed)+"\n")
+
+		signer, err := LoadSigner(ctx, storage.KeySource{Env: "LF_TEST_SIGNING_KEY"})
+		require.NoError(t, err)
+		assert.Equal(t, expected, signer.PublicKey())
+	})
+
+	t.Run("PEM private key", func(t *testing.T) {
+		der, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed(seed))
+		require.NoError(t, err)
+
+		fpath := filepath.Join(t.TempDir(), "signing.pem")
+		err = os.WriteFile(fpath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+		require.NoError(t, err)
+
+		signer, err := LoadSigner(ctx, storage.KeySource{File: fpath})
+		require.NoError(t, err)
+		assert.Equal(t, expected, signer.PublicKey())
+	})
+
+	t.Run("keys of the wrong size are refused", func(t *testing.T) {
+		t.Setenv("LF_TEST_SIGNING_KEY", base64.StdEncoding.EncodeToString(seed[:16]))
+
+		_, err := LoadSigner(ctx, storage.KeySource{Env: "LF_TEST_SIGNING_KEY"})
+		assert.Error(t, err)
+	})
+}
+
+func TestParsePublicKey(t *testing.T) {
+	signer := newTestSigner(1)
+	pub := signer.key.Public().(ed25519.PublicKey)
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	fromPEM, err := ParsePublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	require.NoError(t, err)
+	assert.Equal(t, pub, fromPEM)
+
+	fromBase64, err := ParsePublicKey(signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, pub, fromBase64)
+
+	_, err = ParsePublicKey("not a key")
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package sqlite opens the database used by contexts of type "sqlite" and
+// keeps its schema up to date.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+
+	"github.com/ergomake/layerform/internal/migrations"
+)
+
+// schema must only ever be appended to, databases already migrated to a
+// version are never migrated again.
+var schema = []migrations.SQLMigration{
+	{
+		Name: "initial",
+		Statements: []string{
+			`CREATE TABLE layer_definitions (
+				name TEXT PRIMARY KEY,
+				sha BLOB NOT NULL
+			)`,
+			`CREATE TABLE layer_definition_files (
+				layer_name TEXT NOT NULL REFERENCES layer_definitions (name) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				content BLOB NOT NULL,
+				PRIMARY KEY (layer_name, path)
+			)`,
+			`CREATE TABLE layer_definition_dependencies (
+				layer_name TEXT NOT NULL REFERENCES layer_definitions (name) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				dependency TEXT NOT NULL,
+				PRIMARY KEY (layer_name, dependency)
+			)`,
+			`CREATE TABLE layer_instances (
+				definition_name TEXT NOT NULL,
+				instance_name TEXT NOT NULL,
+				definition_sha BLOB,
+				bytes BLOB,
+				status TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				PRIMARY KEY (definition_name, instance_name)
+			)`,
+			`CREATE TABLE layer_instance_dependencies (
+				definition_name TEXT NOT NULL,
+				instance_name TEXT NOT NULL,
+				dependency TEXT NOT NULL,
+				dependency_instance TEXT NOT NULL,
+				PRIMARY KEY (definition_name, instance_name, dependency),
+				FOREIGN KEY (definition_name, instance_name)
+					REFERENCES layer_instances (definition_name, instance_name) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE env_vars (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		Name: "layer definition history",
+		Statements: []string{
+			// versions are immutable snapshots so the whole definition is
+			// kept as a single json document
+			`CREATE TABLE layer_definition_versions (
+				name TEXT NOT NULL,
+				sha BLOB NOT NULL,
+				definition BLOB NOT NULL,
+				configured_at INTEGER NOT NULL,
+				PRIMARY KEY (name, sha)
+			)`,
+		},
+	},
+	{
+		Name: "layer definition modules",
+		Statements: []string{
+			`CREATE TABLE layer_definition_modules (
+				layer_name TEXT NOT NULL REFERENCES layer_definitions (name) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				content BLOB NOT NULL,
+				PRIMARY KEY (layer_name, path)
+			)`,
+		},
+	},
+	{
+		Name: "layer definition signatures",
+		Statements: []string{
+			`ALTER TABLE layer_definitions ADD COLUMN signature_key_id TEXT`,
+			`ALTER TABLE layer_definitions ADD COLUMN signature BLOB`,
+		},
+	},
+	{
+		Name: "layer definition terraform",
+		Statements: []string{
+			// json encoded data.TerraformConfig, NULL when the layer uses
+			// the terraform of the context
+			`ALTER TABLE layer_definitions ADD COLUMN terraform BLOB`,
+		},
+	},
+}
+
+// Open opens the database at fpath, creating it when needed, and applies
+// every pending schema migration.
+func Open(ctx context.Context, fpath string) (*sql.DB, error) {
+	err := os.MkdirAll(filepath.Dir(fpath), 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create directory of sqlite database %s", fpath)
+	}
+
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(10000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	// take the write lock when the transaction starts so concurrent
+	// read-modify-write transactions wait for each other instead of failing
+	q.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", fpath, q.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open sqlite database %s", fpath)
+	}
+
+	err = migrations.MigrateSQL(ctx, db, schema)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "fail to migrate sqlite database %s", fpath)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+const (
+	backupSuffix     = ".bak"
+	backupTimeLayout = "20060102T150405.000000000Z"
+	// prunedSuffix is the file holding the ID of the newest backup that was
+	// removed, the content the file had before it is lost
+	prunedSuffix = ".pruned"
+)
+
+var (
+	ErrBackupNotFound = errors.New("backup not found")
+	ErrBackupPruned   = errors.New("backup was pruned")
+)
+
+// Backup is a previous version of a FileLike, ID is a sortable timestamp of
+// when that version was replaced.
+type Backup struct {
+	ID   string
+	Path string
+	Time time.Time
+}
+
+type BackupStorage interface {
+	FileLike
+	ListBackups(ctx context.Context) ([]Backup, error)
+	// FindBackup returns the backup RestoreBackup would restore without
+	// restoring it.
+	FindBackup(ctx context.Context, id string) (Backup, error)
+	RestoreBackup(ctx context.Context, id string) (Backup, error)
+	// DeleteBackups removes every backup, returning how many there were.
+	DeleteBackups(ctx context.Context) (int, error)
+}
+
+func (fls *fileStorage) backupPath(t time.Time) string {
+	return fls.fpath + "." + t.UTC().Format(backupTimeLayout) + backupSuffix
+}
+
+// ListBackups returns the backups of the file sorted from oldest to newest.
+func (fls *fileStorage) ListBackups(ctx context.Context) ([]Backup, error) {
+	hclog.FromContext(ctx).Debug("Listing backups", "path", fls.fpath)
+
+	matches, err := filepath.Glob(fls.fpath + ".*" + backupSuffix)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list backups")
+	}
+
+	backups := make([]Backup, 0, len(matches))
+	for _, m := range matches {
+		id := strings.TrimSuffix(strings.TrimPrefix(m, fls.fpath+"."), backupSuffix)
+		t, err := time.Parse(backupTimeLayout, id)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{ID: id, Path: m, Time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID < backups[j].ID
+	})
+
+	return backups, nil
+}
+
+// FindBackup returns the backup holding the content the file had at id, which
+// is the oldest backup taken at or after id since backups are taken when
+// content gets replaced. When no backup was taken since id the file already
+// has that content and ErrBackupNotFound is returned. When that backup was
+// pruned ErrBackupPruned is returned instead of a newer one.
+func (fls *fileStorage) FindBackup(ctx context.Context, id string) (Backup, error) {
+	pruned, err := fls.prunedUntil()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if id <= pruned {
+		return Backup{}, errors.Wrapf(ErrBackupPruned, "backups of %s up to %s were removed", fls.fpath, pruned)
+	}
+
+	backups, err := fls.ListBackups(ctx)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	for _, b := range backups {
+		if b.ID >= id {
+			return b, nil
+		}
+	}
+
+	return Backup{}, errors.Wrapf(ErrBackupNotFound, "no backup of %s at or after %s", fls.fpath, id)
+}
+
+// RestoreBackup replaces the file with the content it had at id, see
+// FindBackup. The current content is backed up first so a restore can be
+// undone.
+func (fls *fileStorage) RestoreBackup(ctx context.Context, id string) (Backup, error) {
+	unlock, err := fls.lock(ctx)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer unlock()
+
+	found, err := fls.FindBackup(ctx, id)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	hclog.FromContext(ctx).Debug("Restoring backup", "path", fls.fpath, "backup", found.Path)
+
+	data, err := os.ReadFile(found.Path)
+	if err != nil {
+		return Backup{}, errors.Wrapf(err, "fail to read backup %s", found.Path)
+	}
+
+	return found, fls.writeRaw(ctx, data)
+}
+
+func (fls *fileStorage) DeleteBackups(ctx context.Context) (int, error) {
+	unlock, err := fls.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	backups, err := fls.ListBackups(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// previous content is gone even if there were no backups, it may have
+	// been replaced without taking one
+	if err := fls.recordPruned(time.Now().UTC().Format(backupTimeLayout)); err != nil {
+		return 0, err
+	}
+
+	for i, b := range backups {
+		hclog.FromContext(ctx).Debug("Deleting backup", "path", b.Path)
+		if err := os.Remove(b.Path); err != nil {
+			return i, errors.Wrapf(err, "fail to remove backup %s", b.Path)
+		}
+	}
+
+	return len(backups), nil
+}
+
+// backup preserves the current version of the file before it gets replaced
+// and prunes the oldest backups, it must be called while holding the lock.
+func (fls *fileStorage) backup(ctx context.Context) error {
+	if fls.backups <= 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(fls.fpath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	dest := fls.backupPath(time.Now())
+
+	// the file is about to be replaced by a rename, so a hard link is enough
+	// to keep the old content around
+	if err := os.Link(fls.fpath, dest); err != nil {
+		if err := copyFile(fls.fpath, dest); err != nil {
+			return errors.Wrapf(err, "fail to create backup %s", dest)
+		}
+	}
+
+	backups, err := fls.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > fls.backups {
+		if err := fls.recordPruned(backups[0].ID); err != nil {
+			return err
+		}
+
+		if err := os.Remove(backups[0].Path); err != nil {
+			return errors.Wrapf(err, "fail to remove old backup %s", backups[0].Path)
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// prunedUntil returns the ID of the newest backup removed, empty when none
+// was.
+func (fls *fileStorage) prunedUntil() (string, error) {
+	b, err := os.ReadFile(fls.fpath + prunedSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "fail to read pruned backups marker")
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// recordPruned remembers that the backup id was removed, it must be called
+// before removing it and while holding the lock.
+func (fls *fileStorage) recordPruned(id string) error {
+	current, err := fls.prunedUntil()
+	if err != nil || id <= current {
+		return err
+	}
+
+	err = os.WriteFile(fls.fpath+prunedSuffix, []byte(id+"\n"), 0644)
+	return errors.Wrap(err, "fail to write pruned backups marker")
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Backups(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("keeps at most the configured number of backups", func(t *testing.T) {
+		dir := t.TempDir()
+		fls := NewFileStorage(path.Join(dir, "state.json"), 2)
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, fls.Save(ctx, []int{i}))
+		}
+
+		backups, err := fls.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+
+		items := []int{}
+		require.NoError(t, fls.Load(ctx, &items))
+		assert.Equal(t, []int{4}, items)
+
+		raw, err := os.ReadFile(backups[0].Path)
+		require.NoError(t, err)
+		assert.Equal(t, "[2]", string(raw))
+
+		raw, err = os.ReadFile(backups[1].Path)
+		require.NoError(t, err)
+		assert.Equal(t, "[3]", string(raw))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, e := range entries {
+			assert.NotContains(t, e.Name(), ".tmp-", "temporary file left behind")
+		}
+	})
+
+	t.Run("no backups when disabled", func(t *testing.T) {
+		fls := NewFileStorage(path.Join(t.TempDir(), "state.json"), 0)
+
+		require.NoError(t, fls.Save(ctx, []int{1}))
+		require.NoError(t, fls.Save(ctx, []int{2}))
+
+		backups, err := fls.ListBackups(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, backups)
+	})
+
+	t.Run("restores the content the file had at id", func(t *testing.T) {
+		fls := NewFileStorage(path.Join(t.TempDir(), "state.json"), 10)
+
+		require.NoError(t, fls.Save(ctx, []int{1}))
+		require.NoError(t, fls.Save(ctx, []int{2}))
+		require.NoError(t, fls.Save(ctx, []int{3}))
+
+		backups, err := fls.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+
+		restored, err := fls.RestoreBackup(ctx, backups[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, backups[0].ID, restored.ID)
+
+		items := []int{}
+		require.NoError(t, fls.Load(ctx, &items))
+		assert.Equal(t, []int{1}, items)
+
+		// the restore itself can be undone
+		backups, err = fls.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 3)
+
+		_, err = fls.RestoreBackup(ctx, backups[2].ID)
+		require.NoError(t, err)
+		require.NoError(t, fls.Load(ctx, &items))
+		assert.Equal(t, []int{3}, items)
+	})
+
+	t.Run("leaves files that did not change since id", func(t *testing.T) {
+		fls := NewFileStorage(path.Join(t.TempDir(), "state.json"), 10)
+		require.NoError(t, fls.Save(ctx, []int{1}))
+		require.NoError(t, fls.Save(ctx, []int{2}))
+
+		_, err := fls.RestoreBackup(ctx, "99991231T000000.000000000Z")
+		assert.ErrorIs(t, err, ErrBackupNotFound)
+
+		items := []int{}
+		require.NoError(t, fls.Load(ctx, &items))
+		assert.Equal(t, []int{2}, items)
+	})
+
+	t.Run("restores files written at different times to the same moment", func(t *testing.T) {
+		dir := t.TempDir()
+		definitions := NewFileStorage(path.Join(dir, "definitions.json"), 10)
+		state := NewFileStorage(path.Join(dir, "state.json"), 10)
+		env := NewFileStorage(path.Join(dir, "env.json"), 10)
+
+		require.NoError(t, definitions.Save(ctx, []string{"definitions-1"}))
+		require.NoError(t, env.Save(ctx, []string{"env-1"}))
+		require.NoError(t, state.Save(ctx, []string{"state-1"}))
+		require.NoError(t, definitions.Save(ctx, []string{"definitions-2"}))
+		require.NoError(t, env.Save(ctx, []string{"env-2"}))
+
+		// replacing state-1 is the moment to go back to
+		require.NoError(t, state.Save(ctx, []string{"state-2"}))
+		backups, err := state.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		id := backups[0].ID
+
+		require.NoError(t, definitions.Save(ctx, []string{"definitions-3"}))
+		require.NoError(t, state.Save(ctx, []string{"state-3"}))
+
+		_, err = definitions.RestoreBackup(ctx, id)
+		require.NoError(t, err)
+		_, err = state.RestoreBackup(ctx, id)
+		require.NoError(t, err)
+		_, err = env.RestoreBackup(ctx, id)
+		assert.ErrorIs(t, err, ErrBackupNotFound)
+
+		for fls, expected := range map[*fileStorage]string{
+			definitions: "definitions-2",
+			state:       "state-1",
+			env:         "env-2",
+		} {
+			items := []string{}
+			require.NoError(t, fls.Load(ctx, &items))
+			assert.Equal(t, []string{expected}, items)
+		}
+	})
+
+	t.Run("refuses to restore a newer backup when the one of id was pruned", func(t *testing.T) {
+		fls := NewFileStorage(path.Join(t.TempDir(), "state.json"), 2)
+		require.NoError(t, fls.Save(ctx, []int{1}))
+		require.NoError(t, fls.Save(ctx, []int{2}))
+
+		backups, err := fls.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		id := backups[0].ID
+
+		for i := 3; i <= 5; i++ {
+			require.NoError(t, fls.Save(ctx, []int{i}))
+		}
+
+		_, err = fls.RestoreBackup(ctx, id)
+		assert.ErrorIs(t, err, ErrBackupPruned)
+
+		items := []int{}
+		require.NoError(t, fls.Load(ctx, &items))
+		assert.Equal(t, []int{5}, items, "nothing is restored")
+
+		backups, err = fls.ListBackups(ctx)
+		require.NoError(t, err)
+		_, err = fls.FindBackup(ctx, backups[0].ID)
+		assert.NoError(t, err, "backups still kept can be restored")
+
+		_, err = fls.DeleteBackups(ctx)
+		require.NoError(t, err)
+		_, err = fls.FindBackup(ctx, backups[1].ID)
+		assert.ErrorIs(t, err, ErrBackupPruned, "deleted backups count as pruned")
+	})
+}
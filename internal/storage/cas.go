@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+const casMaxAttempts = 10
+
+// compareAndSwap implements FileLike.Update for object stores that support
+// conditional writes. get returns the current content along with a version
+// token and put must fail with ErrConflict when the object no longer has that
+// version, in which case the whole update is retried.
+func compareAndSwap[V any](
+	ctx context.Context,
+	fn UpdateFunc,
+	get func(ctx context.Context) ([]byte, V, error),
+	decode func(data []byte, v any) error,
+	put func(ctx context.Context, v any, version V) error,
+) error {
+	logger := hclog.FromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		data, version, err := get(ctx)
+		if err != nil {
+			return err
+		}
+
+		next, err := fn(func(v any) error {
+			return decode(data, v)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = put(ctx, next, version)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+
+		if attempt >= casMaxAttempts {
+			return errors.Wrapf(err, "fail to update object after %d attempts", attempt)
+		}
+
+		backoff := time.Duration(attempt*50+rand.Intn(100)) * time.Millisecond
+		logger.Debug("Concurrent modification detected, retrying", "attempt", attempt, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
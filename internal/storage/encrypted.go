@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownEncryptionKey = errors.New("content was encrypted with an unknown key")
+	ErrNotEncrypted         = errors.New("content is not encrypted")
+)
+
+// KeySource tells where to read an encryption key from, exactly one of the
+// fields must be set. Keys are 32 random bytes encoded in base64, e.g. the
+// output of "openssl rand -base64 32".
+type KeySource struct {
+	Env     string
+	File    string
+	Command string
+}
+
+// EncryptionKey is an AES-256 key encryption key, it never encrypts content
+// directly but the random data key generated for every write.
+type EncryptionKey struct {
+	ID  string
+	key []byte
+}
+
+// NewEncryptionKey validates that key has the size of an AES-256 key.
+func NewEncryptionKey(key []byte) (*EncryptionKey, error) {
+	if len(key) != 32 {
+		return nil, errors.Errorf("encryption key must have 32 bytes but has %d", len(key))
+	}
+
+	sum := sha256.Sum256(key)
+	return &EncryptionKey{ID: hex.EncodeToString(sum[:8]), key: key}, nil
+}
+
+// LoadEncryptionKey reads and decodes the key pointed by src.
+func LoadEncryptionKey(ctx context.Context, src KeySource) (*EncryptionKey, error) {
+	raw, err := ReadKey(ctx, src, "encryption key")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to decode encryption key, it must be base64 encoded")
+	}
+
+	return NewEncryptionKey(key)
+}
+
+// ReadKey returns the trimmed content pointed by src, what names the key in
+// error messages.
+func ReadKey(ctx context.Context, src KeySource, what string) (string, error) {
+	var raw string
+	switch {
+	case src.Env != "":
+		raw = os.Getenv(src.Env)
+		if raw == "" {
+			return "", errors.Errorf("%s environment variable %s is not set", what, src.Env)
+		}
+	case src.File != "":
+		b, err := os.ReadFile(src.File)
+		if err != nil {
+			return "", errors.Wrapf(err, "fail to read %s file", what)
+		}
+		raw = string(b)
+	case src.Command != "":
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, shell, flag, src.Command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", errors.Wrapf(err, "fail to run %s command: %s", what, strings.TrimSpace(stderr.String()))
+		}
+		raw = string(out)
+	default:
+		return "", errors.Errorf("no %s source configured", what)
+	}
+
+	return strings.TrimSpace(raw), nil
+}
+
+const envelopeVersion = 1
+
+// envelope is what gets stored in place of the content when encryption is
+// enabled. The content is encrypted with a random data key which is then
+// encrypted with the key encryption key identified by KeyID.
+type envelope struct {
+	Version    uint   `json:"version"`
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"keyId"`
+	DataKey    []byte `json:"dataKey"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type envelopeFile struct {
+	Encryption *envelope `json:"layerformEncryption"`
+}
+
+type encryptedStorage struct {
+	inner          FileLike
+	key            *EncryptionKey
+	keys           map[string]*EncryptionKey
+	allowPlaintext bool
+}
+
+var _ FileLike = &encryptedStorage{}
+
+// NewEncryptedStorage wraps inner so everything saved is encrypted with key.
+// Content can be decrypted with key or any of the extra decryptKeys, which
+// is how keys get rotated. Content that was never encrypted fails with
+// ErrNotEncrypted, see AllowPlaintext. Ciphertexts are bound to the base name
+// of the path of inner, so files of a context can't be swapped.
+//
+// A nil key saves content unencrypted, but still fails loudly when reading
+// encrypted content instead of silently treating it as empty.
+func NewEncryptedStorage(inner FileLike, key *EncryptionKey, decryptKeys ...*EncryptionKey) *encryptedStorage {
+	keys := map[string]*EncryptionKey{}
+	for _, k := range append([]*EncryptionKey{key}, decryptKeys...) {
+		if k != nil {
+			keys[k.ID] = k
+		}
+	}
+
+	return &encryptedStorage{inner: inner, key: key, keys: keys}
+}
+
+// AllowPlaintext makes es read content that was never encrypted as is, which
+// is only meant for enabling encryption on an existing context. Otherwise
+// anyone able to write to the storage could replace encrypted content with
+// content of their choice.
+func (es *encryptedStorage) AllowPlaintext() *encryptedStorage {
+	es.allowPlaintext = true
+	return es
+}
+
+func (es *encryptedStorage) Path(ctx context.Context) (string, error) {
+	return es.inner.Path(ctx)
+}
+
+func (es *encryptedStorage) Load(ctx context.Context, v any) error {
+	var raw json.RawMessage
+	err := es.inner.Load(ctx, &raw)
+	if err != nil {
+		return err
+	}
+
+	return es.decode(ctx, raw, v)
+}
+
+func (es *encryptedStorage) Save(ctx context.Context, v any) error {
+	env, err := es.encrypt(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	return es.inner.Save(ctx, env)
+}
+
+func (es *encryptedStorage) Update(ctx context.Context, fn UpdateFunc) error {
+	return es.inner.Update(ctx, func(load LoadFunc) (any, error) {
+		var raw json.RawMessage
+		err := load(&raw)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := fn(func(v any) error {
+			return es.decode(ctx, raw, v)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return es.encrypt(ctx, next)
+	})
+}
+
+func (es *encryptedStorage) decode(ctx context.Context, raw json.RawMessage, v any) error {
+	plain, err := es.decrypt(ctx, raw)
+	if err != nil {
+		return err
+	}
+
+	if plain == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.Unmarshal(plain, v), "fail to decode decrypted content")
+}
+
+// name is the associated data of the ciphertexts of es.
+func (es *encryptedStorage) name(ctx context.Context) ([]byte, error) {
+	fpath, err := es.inner.Path(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get storage path")
+	}
+
+	return []byte(filepath.Base(fpath)), nil
+}
+
+// decrypt returns raw itself when it is empty or, if allowed, when it is not
+// an encrypted envelope.
+func (es *encryptedStorage) decrypt(ctx context.Context, raw json.RawMessage) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return raw, nil
+	}
+
+	var f envelopeFile
+	if trimmed[0] == '{' {
+		_ = json.Unmarshal(trimmed, &f)
+	}
+	if f.Encryption == nil {
+		if es.key != nil && !es.allowPlaintext {
+			fpath, _ := es.inner.Path(ctx)
+			return nil, errors.Wrapf(
+				ErrNotEncrypted,
+				"%s should be encrypted, it may have been replaced by someone without the key",
+				fpath,
+			)
+		}
+
+		return raw, nil
+	}
+
+	env := f.Encryption
+	if env.Version != envelopeVersion {
+		return nil, errors.Errorf("unsupported encryption envelope version %d", env.Version)
+	}
+
+	if len(es.keys) == 0 {
+		return nil, errors.Wrap(ErrUnknownEncryptionKey, "content is encrypted but no encryption key is configured")
+	}
+
+	key, ok := es.keys[env.KeyID]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownEncryptionKey, "key id %s", env.KeyID)
+	}
+
+	name, err := es.name(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(key.key, env.DataKey, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to decrypt data key")
+	}
+
+	plain, err := open(dataKey, env.Ciphertext, name)
+	return plain, errors.Wrapf(err, "fail to decrypt content, it may have been moved from another file than %s", name)
+}
+
+func (es *encryptedStorage) encrypt(ctx context.Context, v any) (any, error) {
+	if es.key == nil {
+		return v, nil
+	}
+
+	name, err := es.name(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to marshal content to json")
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, errors.Wrap(err, "fail to generate data key")
+	}
+
+	ciphertext, err := seal(dataKey, plain, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to encrypt content")
+	}
+
+	wrappedKey, err := seal(es.key.key, dataKey, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to encrypt data key")
+	}
+
+	return &envelopeFile{&envelope{
+		Version:    envelopeVersion,
+		Algorithm:  "AES-256-GCM",
+		KeyID:      es.key.ID,
+		DataKey:    wrappedKey,
+		Ciphertext: ciphertext,
+	}}, nil
+}
+
+// seal encrypts plain with AES-GCM authenticating ad too, and returns the
+// nonce followed by the ciphertext.
+func seal(key, plain, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plain, ad), nil
+}
+
+func open(key, sealed, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, ad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type secret struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func newTestKey(t *testing.T, b byte) *EncryptionKey {
+	key, err := NewEncryptionKey(bytes.Repeat([]byte{b}, 32))
+	require.NoError(t, err)
+
+	return key
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	key := newTestKey(t, 1)
+
+	t.Run("content is encrypted at rest", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "layerform.env")
+		es := NewEncryptedStorage(NewFileStorage(fpath, 0), key)
+
+		err := es.Save(ctx, []secret{{"AWS_SECRET_ACCESS_KEY", "hunter2"}})
+		require.NoError(t, err)
+
+		raw, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "hunter2")
+		assert.Contains(t, string(raw), key.ID)
+
+		err = es.Update(ctx, func(load LoadFunc) (any, error) {
+			secrets := []secret{}
+			err := load(&secrets)
+			return append(secrets, secret{"OTHER", "value"}), err
+		})
+		require.NoError(t, err)
+
+		secrets := []secret{}
+		require.NoError(t, es.Load(ctx, &secrets))
+		assert.Equal(t, []secret{{"AWS_SECRET_ACCESS_KEY", "hunter2"}, {"OTHER", "value"}}, secrets)
+	})
+
+	t.Run("plain content is only read when allowed", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "layerform.env")
+		require.NoError(t, NewFileStorage(fpath, 0).Save(ctx, []secret{{"A", "b"}}))
+
+		secrets := []secret{}
+		err := NewEncryptedStorage(NewFileStorage(fpath, 0), key).Load(ctx, &secrets)
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+		assert.Empty(t, secrets)
+
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(fpath, 0), key).AllowPlaintext().Load(ctx, &secrets))
+		assert.Equal(t, []secret{{"A", "b"}}, secrets)
+
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(fpath, 0), nil).Load(ctx, &secrets), "contexts without key read plain content")
+	})
+
+	t.Run("files can't be swapped", func(t *testing.T) {
+		dir := t.TempDir()
+		envPath := path.Join(dir, "layerform.env")
+		statePath := path.Join(dir, "layerform.lfstate")
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(envPath, 0), key).Save(ctx, []secret{{"A", "b"}}))
+
+		raw, err := os.ReadFile(envPath)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(statePath, raw, 0644))
+
+		secrets := []secret{}
+		err = NewEncryptedStorage(NewFileStorage(statePath, 0), key).Load(ctx, &secrets)
+		assert.ErrorContains(t, err, "fail to decrypt")
+		assert.Empty(t, secrets)
+	})
+
+	t.Run("encrypted content is never read without the key", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "layerform.env")
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(fpath, 0), key).Save(ctx, []secret{{"A", "b"}}))
+
+		secrets := []secret{}
+		err := NewEncryptedStorage(NewFileStorage(fpath, 0), newTestKey(t, 2)).Load(ctx, &secrets)
+		assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+
+		err = NewEncryptedStorage(NewFileStorage(fpath, 0), nil).Load(ctx, &secrets)
+		assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+		assert.Empty(t, secrets)
+	})
+
+	t.Run("decrypt keys allow rotation", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "layerform.env")
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(fpath, 0), key).Save(ctx, []secret{{"A", "b"}}))
+
+		newKey := newTestKey(t, 2)
+		rotated := NewEncryptedStorage(NewFileStorage(fpath, 0), newKey, key)
+		err := rotated.Update(ctx, func(load LoadFunc) (any, error) {
+			secrets := []secret{}
+			err := load(&secrets)
+			return secrets, err
+		})
+		require.NoError(t, err)
+
+		secrets := []secret{}
+		require.NoError(t, NewEncryptedStorage(NewFileStorage(fpath, 0), newKey).Load(ctx, &secrets))
+		assert.Equal(t, []secret{{"A", "b"}}, secrets)
+
+		err = NewEncryptedStorage(NewFileStorage(fpath, 0), key).Load(ctx, &secrets)
+		assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+	})
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+	encoded := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	expected, err := NewEncryptionKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	t.Setenv("LF_TEST_KEY", encoded)
+	key, err := LoadEncryptionKey(ctx, KeySource{Env: "LF_TEST_KEY"})
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+
+	fpath := path.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(fpath, []byte(encoded+"\n"), 0600))
+	key, err = LoadEncryptionKey(ctx, KeySource{File: fpath})
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+
+	key, err = LoadEncryptionKey(ctx, KeySource{Command: "echo " + encoded})
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+
+	_, err = LoadEncryptionKey(ctx, KeySource{Command: "echo c2hvcnQ="})
+	assert.ErrorContains(t, err, "must have 32 bytes")
+}
@@ -5,19 +5,26 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
 )
 
+const lockRetryInterval = 50 * time.Millisecond
+
 type fileStorage struct {
-	fpath string
+	fpath   string
+	backups int
 }
 
 var _ FileLike = &fileStorage{}
+var _ BackupStorage = &fileStorage{}
 
-func NewFileStorage(fpath string) *fileStorage {
-	return &fileStorage{fpath}
+// NewFileStorage creates a FileLike backed by fpath, keeping up to backups
+// previous versions of the file next to it.
+func NewFileStorage(fpath string, backups int) *fileStorage {
+	return &fileStorage{fpath, backups}
 }
 
 func (fls *fileStorage) Path(_ context.Context) (string, error) {
@@ -27,32 +34,165 @@ func (fls *fileStorage) Path(_ context.Context) (string, error) {
 func (fls *fileStorage) Load(ctx context.Context, v any) error {
 	hclog.FromContext(ctx).Debug("Reading layers file", "path", fls.fpath)
 
+	raw, err := fls.read()
+	if err != nil {
+		return err
+	}
+
+	return fls.decode(raw, v)
+}
+
+func (fls *fileStorage) Save(ctx context.Context, v any) error {
+	unlock, err := fls.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fls.write(ctx, v)
+}
+
+func (fls *fileStorage) Update(ctx context.Context, fn UpdateFunc) error {
+	unlock, err := fls.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	hclog.FromContext(ctx).Debug("Reading layers file for update", "path", fls.fpath)
+	raw, err := fls.read()
+	if err != nil {
+		return err
+	}
+
+	next, err := fn(func(v any) error {
+		return fls.decode(raw, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return fls.write(ctx, next)
+}
+
+func (fls *fileStorage) read() ([]byte, error) {
 	raw, err := os.ReadFile(fls.fpath)
 	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return raw, errors.Wrapf(err, "fail to read %s", fls.fpath)
+}
+
+func (fls *fileStorage) decode(raw []byte, v any) error {
+	if raw == nil {
 		return nil
 	}
 
+	err := json.Unmarshal(raw, &v)
+	return errors.Wrapf(err, "fail to parse layers out of %s", fls.fpath)
+}
+
+func (fls *fileStorage) write(ctx context.Context, v any) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return errors.Wrapf(err, "fail to read %s", fls.fpath)
+		return errors.Wrap(err, "fail to marshal filelayers")
 	}
 
-	err = json.Unmarshal(raw, &v)
-	return errors.Wrapf(err, "fail to parse layers out of %s", fls.fpath)
+	return fls.writeRaw(ctx, data)
+}
+
+// writeRaw replaces the file atomically by writing to a temporary file in the
+// same directory and renaming it over the original, so a crash mid-write never
+// leaves a truncated file behind.
+func (fls *fileStorage) writeRaw(ctx context.Context, data []byte) error {
+	logger := hclog.FromContext(ctx)
+	logger.Debug("Writting layers to file", "path", fls.fpath)
+
+	dir := filepath.Dir(fls.fpath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fls.fpath)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "fail to create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "fail to write temporary file")
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "fail to chmod temporary file")
+	}
 
+	if err := fls.backup(ctx); err != nil {
+		return errors.Wrap(err, "fail to backup file")
+	}
+
+	if err := os.Rename(tmp.Name(), fls.fpath); err != nil {
+		return errors.Wrap(err, "fail to write file")
+	}
+
+	// persist the rename itself, not supported everywhere so errors are ignored
+	if d, err := os.Open(dir); err == nil {
+		if err := d.Sync(); err != nil {
+			logger.Debug("Fail to sync directory", "dir", dir, "err", err)
+		}
+		d.Close()
+	}
+
+	return nil
 }
 
-func (fls *fileStorage) Save(ctx context.Context, v any) error {
-	hclog.FromContext(ctx).Debug("Writting layers to file", "path", fls.fpath)
+// lock takes an exclusive lock on a sibling .lock file so that layerform
+// processes sharing the same directory do not overwrite each other.
+func (fls *fileStorage) lock(ctx context.Context) (func(), error) {
+	return lockPath(ctx, fls.fpath+".lock")
+}
 
-	if err := os.MkdirAll(filepath.Dir(fls.fpath), 0755); err != nil {
-		return errors.Wrap(err, "fail to create directory")
+// lockPath blocks until it gets an exclusive lock on the file at fpath,
+// creating it when needed, or ctx is done.
+func lockPath(ctx context.Context, fpath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return nil, errors.Wrap(err, "fail to create directory")
 	}
 
-	data, err := json.Marshal(v)
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return errors.Wrap(err, "fail to marshal filelayers")
+		return nil, errors.Wrapf(err, "fail to open lock file %s", fpath)
+	}
+
+	logger := hclog.FromContext(ctx)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "fail to lock %s", fpath)
+		}
+
+		if ok {
+			break
+		}
+
+		logger.Debug("Waiting for lock", "path", fpath)
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, errors.Wrapf(ctx.Err(), "fail to lock %s", fpath)
+		case <-time.After(lockRetryInterval):
+		}
 	}
 
-	err = os.WriteFile(fls.fpath, data, 0644)
-	return errors.Wrap(err, "fail to write file")
+	return func() {
+		if err := unlockFile(f); err != nil {
+			logger.Warn("Fail to unlock file", "path", fpath, "err", err)
+		}
+		f.Close()
+	}, nil
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Update(t *testing.T) {
+	t.Run("concurrent updates do not lose writes", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "nested", "state.json")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				// a new storage per goroutine simulates separate processes
+				fls := NewFileStorage(fpath, 0)
+				err := fls.Update(context.Background(), func(load LoadFunc) (any, error) {
+					items := []int{}
+					if err := load(&items); err != nil {
+						return nil, err
+					}
+
+					return append(items, i), nil
+				})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		items := []int{}
+		err := NewFileStorage(fpath, 0).Load(context.Background(), &items)
+		require.NoError(t, err)
+		assert.Len(t, items, 20)
+	})
+
+	t.Run("does not write when update fails", func(t *testing.T) {
+		fpath := path.Join(t.TempDir(), "state.json")
+		fls := NewFileStorage(fpath, 0)
+		require.NoError(t, fls.Save(context.Background(), []int{1}))
+
+		expectedErr := assert.AnError
+		err := fls.Update(context.Background(), func(load LoadFunc) (any, error) {
+			return nil, expectedErr
+		})
+		assert.ErrorIs(t, err, expectedErr)
+
+		items := []int{}
+		require.NoError(t, fls.Load(context.Background(), &items))
+		assert.Equal(t, []int{1}, items)
+	})
+}
@@ -2,10 +2,44 @@ package storage
 
 import (
 	"context"
+
+	"github.com/pkg/errors"
 )
 
+var ErrConflict = errors.New("file was concurrently modified")
+
+// LoadFunc decodes the current content of a FileLike into v, leaving v
+// untouched when there is no content yet.
+type LoadFunc func(v any) error
+
+// UpdateFunc receives a LoadFunc for the current content and returns the
+// value that should replace it. It may be called more than once when a
+// concurrent modification is detected.
+type UpdateFunc func(load LoadFunc) (any, error)
+
 type FileLike interface {
 	Path(ctx context.Context) (string, error)
 	Load(ctx context.Context, v any) error
 	Save(ctx context.Context, v any) error
+	Update(ctx context.Context, fn UpdateFunc) error
+}
+
+// HistoryStorage is a FileLike that keeps every previous version of the file
+// where layerform can't delete them.
+type HistoryStorage interface {
+	FileLike
+	HasHistory(ctx context.Context) (bool, error)
+}
+
+type changeDescriptionKey struct{}
+
+// WithChangeDescription attaches a human readable description of the change
+// about to be saved to ctx, storages that keep history record it.
+func WithChangeDescription(ctx context.Context, description string) context.Context {
+	return context.WithValue(ctx, changeDescriptionKey{}, description)
+}
+
+func changeDescription(ctx context.Context) string {
+	description, _ := ctx.Value(changeDescriptionKey{}).(string)
+	return description
 }
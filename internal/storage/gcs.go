@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+type gcsStorage struct {
+	client *gcs.Client
+	bucket string
+	key    string
+}
+
+var _ FileLike = &gcsStorage{}
+
+// NewGCSBackend creates a FileLike backed by a Google Cloud Storage object.
+// When credentials is empty, Application Default Credentials are used. The
+// STORAGE_EMULATOR_HOST environment variable can be used to point it to a
+// local fake GCS server.
+func NewGCSBackend(ctx context.Context, bucket, key, credentials string) (*gcsStorage, error) {
+	opts := []option.ClientOption{}
+	if credentials != "" {
+		opts = append(opts, option.WithCredentialsFile(credentials))
+	}
+
+	client, err := gcs.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GCS client")
+	}
+
+	return &gcsStorage{
+		client: client,
+		bucket: bucket,
+		key:    key,
+	}, nil
+}
+
+func (g *gcsStorage) Path(_ context.Context) (string, error) {
+	return fmt.Sprintf("gs://%s/%s", g.bucket, g.key), nil
+}
+
+func (g *gcsStorage) Load(ctx context.Context, v any) error {
+	data, _, err := g.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	return g.decode(data, v)
+}
+
+func (g *gcsStorage) Save(ctx context.Context, v any) error {
+	return g.put(ctx, v, nil)
+}
+
+// Update performs a compare-and-swap write using the generation of the object.
+func (g *gcsStorage) Update(ctx context.Context, fn UpdateFunc) error {
+	return compareAndSwap(ctx, fn, g.get, g.decode, func(ctx context.Context, v any, generation int64) error {
+		return g.put(ctx, v, &generation)
+	})
+}
+
+// get returns the object data and its generation, both are empty when the
+// object does not exist yet.
+func (g *gcsStorage) get(ctx context.Context) ([]byte, int64, error) {
+	r, err := g.client.Bucket(g.bucket).Object(g.key).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return nil, 0, nil
+		}
+
+		return nil, 0, errors.Wrap(err, "fail to load layers from gcs")
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "fail to read data from bucket object")
+	}
+
+	return data, r.Attrs.Generation, nil
+}
+
+func (g *gcsStorage) decode(data []byte, v any) error {
+	if data == nil {
+		return nil
+	}
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return errors.Wrap(err, "fail to decode layers definitions from bucket object data")
+	}
+
+	return nil
+}
+
+// put writes v to the object, when generation is not nil the write only
+// succeeds if the object still has that generation, zero meaning it must not
+// exist.
+func (g *gcsStorage) put(ctx context.Context, v any, generation *int64) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "fail to marshal layers to json")
+	}
+
+	obj := g.client.Bucket(g.bucket).Object(g.key)
+	if generation != nil {
+		if *generation == 0 {
+			obj = obj.If(gcs.Conditions{DoesNotExist: true})
+		} else {
+			obj = obj.If(gcs.Conditions{GenerationMatch: *generation})
+		}
+	}
+
+	w := obj.NewWriter(ctx)
+	w.ContentType = "application/json"
+	// upload in a single request, the files are small
+	w.ChunkSize = 0
+
+	_, err = w.Write(data)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return errors.Wrap(ErrConflict, apiErr.Error())
+	}
+
+	return errors.Wrap(err, "fail to save layers to gcs")
+}
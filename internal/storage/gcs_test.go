@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+type fakeGCSObject struct {
+	data       []byte
+	generation int64
+}
+
+// fakeGCS implements the subset of the GCS JSON API used by gcsStorage,
+// including generation preconditions
+type fakeGCS struct {
+	mu             sync.Mutex
+	objects        map[string]*fakeGCSObject
+	lastGeneration int64
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/"):
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"), "/o/", 2)
+		obj, ok := f.objects[parts[0]+"/"+parts[1]]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Goog-Generation", strconv.FormatInt(obj.generation, 10))
+		_, _ = w.Write(obj.data)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/upload/storage/v1/b/"), "/o")
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metaPart, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var meta struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(metaPart).Decode(&meta); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dataPart, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(dataPart)
+
+		key := bucket + "/" + meta.Name
+		current, exists := f.objects[key]
+		if match := r.URL.Query().Get("ifGenerationMatch"); match != "" {
+			expected, _ := strconv.ParseInt(match, 10, 64)
+			if (expected == 0 && exists) || (expected != 0 && (!exists || current.generation != expected)) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				fmt.Fprint(w, `{"error":{"code":412,"message":"precondition failed"}}`)
+				return
+			}
+		}
+
+		f.lastGeneration++
+		f.objects[key] = &fakeGCSObject{data: data, generation: f.lastGeneration}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"bucket":%q,"name":%q,"generation":"%d"}`, bucket, meta.Name, f.lastGeneration)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+func newTestGCSStorage(t *testing.T, fake *fakeGCS, key string) *gcsStorage {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := gcs.NewClient(
+		context.Background(),
+		option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication(),
+		gcs.WithJSONReads(),
+	)
+	require.NoError(t, err)
+
+	return &gcsStorage{client: client, bucket: "bucket", key: key}
+}
+
+func TestGCSStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("load of missing object leaves value untouched", func(t *testing.T) {
+		g := newTestGCSStorage(t, &fakeGCS{objects: map[string]*fakeGCSObject{}}, "prefix/state.json")
+
+		items := []int{42}
+		require.NoError(t, g.Load(ctx, &items))
+		assert.Equal(t, []int{42}, items)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		fake := &fakeGCS{objects: map[string]*fakeGCSObject{}}
+		g := newTestGCSStorage(t, fake, "prefix/state.json")
+
+		require.NoError(t, g.Save(ctx, []int{1, 2}))
+
+		items := []int{}
+		require.NoError(t, g.Load(ctx, &items))
+		assert.Equal(t, []int{1, 2}, items)
+		assert.Contains(t, fake.objects, "bucket/prefix/state.json")
+	})
+
+	t.Run("concurrent updates do not lose writes", func(t *testing.T) {
+		g := newTestGCSStorage(t, &fakeGCS{objects: map[string]*fakeGCSObject{}}, "state.json")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				err := g.Update(ctx, func(load LoadFunc) (any, error) {
+					items := []int{}
+					if err := load(&items); err != nil {
+						return nil, err
+					}
+
+					return append(items, i), nil
+				})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		items := []int{}
+		require.NoError(t, g.Load(ctx, &items))
+		assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, items)
+	})
+}
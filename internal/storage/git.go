@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+// gitExcludes keep the lock and temporary files of fileStorage out of git
+var gitExcludes = []string{"*.lock", "*.tmp-*"}
+
+type gitStorage struct {
+	repo  string
+	fname string
+	file  *fileStorage
+}
+
+var _ HistoryStorage = &gitStorage{}
+
+// NewGitStorage creates a FileLike backed by the file fname of the git
+// working tree at repo, initializing the repository when needed. Every write
+// is committed using the description attached with WithChangeDescription as
+// the commit message.
+func NewGitStorage(ctx context.Context, repo, fname string) (*gitStorage, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.Wrap(err, "git is required by contexts of type git")
+	}
+
+	gs := &gitStorage{repo: repo, fname: fname, file: NewFileStorage(filepath.Join(repo, fname), 0)}
+
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		return nil, errors.Wrap(err, "fail to create repository directory")
+	}
+
+	gitDir, err := gs.git(ctx, nil, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		hclog.FromContext(ctx).Debug("Initializing git repository", "path", repo)
+		if _, err := gs.git(ctx, nil, "init"); err != nil {
+			return nil, errors.Wrap(err, "fail to initialize git repository")
+		}
+
+		gitDir, err = gs.git(ctx, nil, "rev-parse", "--absolute-git-dir")
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to find git directory")
+		}
+	}
+
+	err = ensureGitExcludes(filepath.Join(gitDir, "info", "exclude"))
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to update git excludes")
+	}
+
+	return gs, nil
+}
+
+func ensureGitExcludes(fpath string) error {
+	current, err := os.ReadFile(fpath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	lines := map[string]struct{}{}
+	for _, l := range strings.Split(string(current), "\n") {
+		lines[strings.TrimSpace(l)] = struct{}{}
+	}
+
+	missing := []string{}
+	for _, e := range gitExcludes {
+		if _, ok := lines[e]; !ok {
+			missing = append(missing, e)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(current) > 0 && !bytes.HasSuffix(current, []byte("\n")) {
+		missing = append([]string{""}, missing...)
+	}
+
+	_, err = f.WriteString(strings.Join(missing, "\n") + "\n")
+	return err
+}
+
+func (gs *gitStorage) Path(ctx context.Context) (string, error) {
+	return gs.file.Path(ctx)
+}
+
+func (gs *gitStorage) Load(ctx context.Context, v any) error {
+	return gs.file.Load(ctx, v)
+}
+
+func (gs *gitStorage) Save(ctx context.Context, v any) error {
+	unlock, err := gs.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = gs.file.Save(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	return gs.commit(ctx)
+}
+
+func (gs *gitStorage) Update(ctx context.Context, fn UpdateFunc) error {
+	unlock, err := gs.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = gs.file.Update(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	return gs.commit(ctx)
+}
+
+// HasHistory tells whether any commit of the repository has the file. Those
+// versions can't be replaced without rewriting the history.
+func (gs *gitStorage) HasHistory(ctx context.Context) (bool, error) {
+	out, err := gs.git(ctx, nil, "rev-list", "--all", "-1", "--", gs.fname)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to look for commits of %s", gs.fname)
+	}
+
+	return out != "", nil
+}
+
+// lock serializes writes to the whole repository so that commits of
+// different processes never race for the git index.
+func (gs *gitStorage) lock(ctx context.Context) (func(), error) {
+	return lockPath(ctx, filepath.Join(gs.repo, ".layerform.lock"))
+}
+
+func (gs *gitStorage) commit(ctx context.Context) error {
+	_, err := gs.git(ctx, nil, "add", "--", gs.fname)
+	if err != nil {
+		return errors.Wrapf(err, "fail to stage %s", gs.fname)
+	}
+
+	// exits with 0 when there is nothing to commit
+	if _, err := gs.git(ctx, nil, "diff", "--cached", "--quiet", "--", gs.fname); err == nil {
+		hclog.FromContext(ctx).Debug("Nothing to commit", "path", gs.fname)
+		return nil
+	}
+
+	who := currentUser()
+	message := changeDescription(ctx)
+	if message == "" {
+		message = fmt.Sprintf("Update %s", gs.fname)
+	}
+	message = fmt.Sprintf("%s\n\nLayerform-User: %s", message, who)
+
+	var env []string
+	if name, _ := gs.git(ctx, nil, "config", "user.name"); name == "" {
+		env = append(env, "GIT_AUTHOR_NAME="+who, "GIT_COMMITTER_NAME="+who)
+	}
+	if email, _ := gs.git(ctx, nil, "config", "user.email"); email == "" {
+		env = append(env, "GIT_AUTHOR_EMAIL="+who, "GIT_COMMITTER_EMAIL="+who)
+	}
+
+	// only commits fname, leaving anything else staged in the repository alone
+	_, err = gs.git(ctx, env, "commit", "--quiet", "--no-verify", "-m", message, "--", gs.fname)
+	return errors.Wrapf(err, "fail to commit %s", gs.fname)
+}
+
+func (gs *gitStorage) git(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", gs.repo}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// currentUser identifies who made a change as user@host
+func currentUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return name
+	}
+
+	return name + "@" + host
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gitLog(t *testing.T, repo string) []string {
+	t.Helper()
+
+	out, err := exec.Command("git", "-C", repo, "log", "--format=%B%x00").Output()
+	require.NoError(t, err)
+
+	messages := []string{}
+	for _, m := range strings.Split(string(out), "\x00") {
+		if m = strings.TrimSpace(m); m != "" {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages
+}
+
+func TestGitStorage(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Run("commits every change with its description", func(t *testing.T) {
+		repo := path.Join(t.TempDir(), "repo")
+		ctx := context.Background()
+
+		gs, err := NewGitStorage(ctx, repo, "state.json")
+		require.NoError(t, err)
+
+		err = gs.Save(WithChangeDescription(ctx, "Save first"), []int{1})
+		require.NoError(t, err)
+
+		err = gs.Update(WithChangeDescription(ctx, "Append second"), func(load LoadFunc) (any, error) {
+			items := []int{}
+			if err := load(&items); err != nil {
+				return nil, err
+			}
+
+			return append(items, 2), nil
+		})
+		require.NoError(t, err)
+
+		err = gs.Save(ctx, []int{1, 2, 3})
+		require.NoError(t, err)
+
+		messages := gitLog(t, repo)
+		require.Len(t, messages, 3)
+		assert.True(t, strings.HasPrefix(messages[0], "Update state.json\n"))
+		assert.True(t, strings.HasPrefix(messages[1], "Append second\n"))
+		assert.True(t, strings.HasPrefix(messages[2], "Save first\n"))
+		for _, m := range messages {
+			assert.Contains(t, m, "Layerform-User: ")
+		}
+
+		items := []int{}
+		err = gs.Load(ctx, &items)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, items)
+	})
+
+	t.Run("does not commit when nothing changed", func(t *testing.T) {
+		repo := t.TempDir()
+		ctx := context.Background()
+
+		gs, err := NewGitStorage(ctx, repo, "state.json")
+		require.NoError(t, err)
+
+		require.NoError(t, gs.Save(ctx, map[string]string{"a": "b"}))
+		require.NoError(t, gs.Save(ctx, map[string]string{"a": "b"}))
+
+		assert.Len(t, gitLog(t, repo), 1)
+	})
+
+	t.Run("keeps lock files out of the repository", func(t *testing.T) {
+		repo := t.TempDir()
+		ctx := context.Background()
+
+		gs, err := NewGitStorage(ctx, repo, "state.json")
+		require.NoError(t, err)
+		require.NoError(t, gs.Save(ctx, []int{1}))
+
+		out, err := exec.Command("git", "-C", repo, "status", "--porcelain").Output()
+		require.NoError(t, err)
+		assert.Empty(t, strings.TrimSpace(string(out)))
+	})
+
+	t.Run("tells whether the file has history", func(t *testing.T) {
+		repo := t.TempDir()
+		ctx := context.Background()
+
+		gs, err := NewGitStorage(ctx, repo, "state.json")
+		require.NoError(t, err)
+
+		hasHistory, err := gs.HasHistory(ctx)
+		require.NoError(t, err)
+		assert.False(t, hasHistory, "repository without commits")
+
+		other, err := NewGitStorage(ctx, repo, "other.json")
+		require.NoError(t, err)
+		require.NoError(t, other.Save(ctx, []int{1}))
+
+		hasHistory, err = gs.HasHistory(ctx)
+		require.NoError(t, err)
+		assert.False(t, hasHistory, "only other files were committed")
+
+		require.NoError(t, gs.Save(ctx, []int{1}))
+		hasHistory, err = gs.HasHistory(ctx)
+		require.NoError(t, err)
+		assert.True(t, hasHistory)
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package storage
+
+import (
+	"os"
+)
+
+// file locking is not supported on this platform
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
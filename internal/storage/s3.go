@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -22,8 +23,49 @@ type s3Storage struct {
 
 var _ FileLike = &s3Storage{}
 
-func NewS3Backend(bucket, key, region string) (*s3Storage, error) {
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+// S3Options configures how the s3 client reaches the bucket, the zero value
+// talks to AWS using the default credentials chain.
+type S3Options struct {
+	Region string
+
+	// Endpoint overrides the AWS endpoint, used for S3 compatible stores such
+	// as MinIO, Ceph or R2.
+	Endpoint string
+
+	// ForcePathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key, most S3 compatible stores require it.
+	ForcePathStyle bool
+
+	// Profile selects a profile from the AWS shared config and credentials
+	// files.
+	Profile string
+}
+
+// defaultS3CompatibleRegion is used to sign requests to custom endpoints when
+// no region is given, S3 compatible stores usually ignore it.
+const defaultS3CompatibleRegion = "us-east-1"
+
+func NewS3Backend(bucket, key string, opts S3Options) (*s3Storage, error) {
+	cfg := aws.Config{}
+	if opts.Region != "" {
+		cfg.Region = aws.String(opts.Region)
+	} else if opts.Endpoint != "" {
+		cfg.Region = aws.String(defaultS3CompatibleRegion)
+	}
+
+	if opts.Endpoint != "" {
+		cfg.Endpoint = aws.String(opts.Endpoint)
+	}
+
+	if opts.ForcePathStyle {
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           opts.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create AWS session")
 	}
@@ -42,6 +84,28 @@ func (s3b *s3Storage) Path(_ context.Context) (string, error) {
 }
 
 func (s3b *s3Storage) Load(ctx context.Context, v any) error {
+	data, _, err := s3b.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s3b.decode(data, v)
+}
+
+func (s3b *s3Storage) Save(ctx context.Context, v any) error {
+	return s3b.put(ctx, v, nil)
+}
+
+// Update performs a compare-and-swap write using the ETag of the object.
+func (s3b *s3Storage) Update(ctx context.Context, fn UpdateFunc) error {
+	return compareAndSwap(ctx, fn, s3b.get, s3b.decode, func(ctx context.Context, v any, etag string) error {
+		return s3b.put(ctx, v, &etag)
+	})
+}
+
+// get returns the object data and its ETag, both are empty when the object
+// does not exist yet.
+func (s3b *s3Storage) get(ctx context.Context) ([]byte, string, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s3b.bucket),
 		Key:    aws.String(s3b.key),
@@ -49,20 +113,28 @@ func (s3b *s3Storage) Load(ctx context.Context, v any) error {
 	output, err := s3b.svc.GetObjectWithContext(ctx, input)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
-			return nil
+			return nil, "", nil
 		}
 
-		return errors.Wrap(err, "fail to load layers from s3")
+		return nil, "", errors.Wrap(err, "fail to load layers from s3")
 	}
 
 	defer output.Body.Close()
 
 	data, err := io.ReadAll(output.Body)
 	if err != nil {
-		return errors.Wrap(err, "fail to read data from bucket object")
+		return nil, "", errors.Wrap(err, "fail to read data from bucket object")
+	}
+
+	return data, aws.StringValue(output.ETag), nil
+}
+
+func (s3b *s3Storage) decode(data []byte, v any) error {
+	if data == nil {
+		return nil
 	}
 
-	err = json.Unmarshal(data, &v)
+	err := json.Unmarshal(data, &v)
 	if err != nil {
 		return errors.Wrap(err, "fail to decode layers definitions from bucket object data")
 	}
@@ -70,7 +142,9 @@ func (s3b *s3Storage) Load(ctx context.Context, v any) error {
 	return nil
 }
 
-func (s3b *s3Storage) Save(ctx context.Context, v any) error {
+// put writes v to the object, when etag is not nil the write only succeeds if
+// the object still has that ETag, an empty etag meaning it must not exist.
+func (s3b *s3Storage) put(ctx context.Context, v any, etag *string) error {
 	data, err := json.Marshal(v)
 	if err != nil {
 		return errors.Wrap(err, "fail to marshal layers to json")
@@ -82,6 +156,25 @@ func (s3b *s3Storage) Save(ctx context.Context, v any) error {
 		Key:    aws.String(s3b.key),
 	}
 
-	_, err = s3b.svc.PutObject(input)
+	req, _ := s3b.svc.PutObjectRequest(input)
+	req.SetContext(ctx)
+	if etag != nil {
+		// aws-sdk-go does not model conditional writes, but S3 and most S3
+		// compatible stores honor these headers on PutObject
+		if *etag == "" {
+			req.HTTPRequest.Header.Set("If-None-Match", "*")
+		} else {
+			req.HTTPRequest.Header.Set("If-Match", *etag)
+		}
+	}
+
+	err = req.Send()
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusPreconditionFailed, http.StatusConflict:
+			return errors.Wrap(ErrConflict, reqErr.Error())
+		}
+	}
+
 	return errors.Wrap(err, "fail to save layers to s3")
 }
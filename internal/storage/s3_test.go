@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a single object S3 server that honors conditional writes
+type fakeS3 struct {
+	mu   sync.Mutex
+	data []byte
+	etag string
+	puts int
+	path string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.path = r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		if f.data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+
+		w.Header().Set("ETag", f.etag)
+		_, _ = w.Write(f.data)
+	case http.MethodPut:
+		ifMatch := r.Header.Get("If-Match")
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if (ifMatch != "" && ifMatch != f.etag) || (ifNoneMatch == "*" && f.data != nil) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code></Error>`)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		f.data = body
+		f.etag = fmt.Sprintf("\"%x\"", md5.Sum(append(body, byte(f.puts))))
+		f.puts++
+		w.Header().Set("ETag", f.etag)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Storage(t *testing.T, handler http.Handler) *s3Storage {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	return &s3Storage{svc: s3.New(sess), bucket: "bucket", key: "state.json"}
+}
+
+func TestS3Storage_Update(t *testing.T) {
+	t.Run("concurrent updates do not lose writes", func(t *testing.T) {
+		fake := &fakeS3{}
+		s3b := newTestS3Storage(t, fake)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				err := s3b.Update(context.Background(), func(load LoadFunc) (any, error) {
+					items := []int{}
+					if err := load(&items); err != nil {
+						return nil, err
+					}
+
+					return append(items, i), nil
+				})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		items := []int{}
+		err := s3b.Load(context.Background(), &items)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, items)
+	})
+
+	t.Run("retries when object changes between load and save", func(t *testing.T) {
+		fake := &fakeS3{}
+		s3b := newTestS3Storage(t, fake)
+		require.NoError(t, s3b.Save(context.Background(), []int{1}))
+
+		calls := 0
+		err := s3b.Update(context.Background(), func(load LoadFunc) (any, error) {
+			calls++
+
+			items := []int{}
+			if err := load(&items); err != nil {
+				return nil, err
+			}
+
+			if calls == 1 {
+				// someone else writes while we are computing the next value
+				require.NoError(t, s3b.Save(context.Background(), append(items, 2)))
+			}
+
+			return append(items, 3), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+
+		items := []int{}
+		require.NoError(t, s3b.Load(context.Background(), &items))
+		assert.Equal(t, []int{1, 2, 3}, items)
+	})
+}
+
+func TestNewS3Backend_CustomEndpoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s3b, err := NewS3Backend("bucket", "team-a/state.json", S3Options{
+		Endpoint:       server.URL,
+		ForcePathStyle: true,
+	})
+	require.NoError(t, err)
+
+	err = s3b.Save(context.Background(), []int{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, "/bucket/team-a/state.json", fake.path)
+
+	items := []int{}
+	err = s3b.Load(context.Background(), &items)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, items)
+}
@@ -2,6 +2,13 @@ package terraform
 
 import (
 	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-version"
@@ -9,23 +16,211 @@ import (
 	"github.com/hashicorp/hc-install/fs"
 	"github.com/hashicorp/hc-install/product"
 	"github.com/hashicorp/hc-install/src"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+const (
+	EngineTerraform = "terraform"
+	EngineTofu      = "tofu"
 )
 
+// defaultTerraformConstraint is used when terraform is not given a version
+// constraint, it is the newest terraform layerform is tested with.
+const defaultTerraformConstraint = "<=1.5.5"
+
+var tofuVersionOutputRe = regexp.MustCompile(`OpenTofu v?([0-9]+(?:\.[0-9]+)*(?:-[A-Za-z0-9\.]+)?)`)
+
+var tofu = product.Product{
+	Name: EngineTofu,
+	BinaryName: func() string {
+		if runtime.GOOS == "windows" {
+			return "tofu.exe"
+		}
+		return "tofu"
+	},
+	GetVersion: func(ctx context.Context, path string) (*version.Version, error) {
+		out, err := exec.CommandContext(ctx, path, "version").Output()
+		if err != nil {
+			return nil, err
+		}
+
+		stdout := strings.TrimSpace(string(out))
+		submatches := tofuVersionOutputRe.FindStringSubmatch(stdout)
+		if len(submatches) != 2 {
+			return nil, fmt.Errorf("unexpected version output %s", stdout)
+		}
+
+		return version.NewVersion(submatches[1])
+	},
+}
+
 func GetTFPath(ctx context.Context) (string, error) {
+	return Resolve(ctx, nil)
+}
+
+// Merge applies override, the config of a layer, on top of base, the one of
+// the context. The engine of override replaces the one of base, dropping the
+// path of base when it changes. The path of override is ignored, only
+// contexts select binaries, even when base is nil. Version constraints of
+// both must be satisfied.
+func Merge(base, override *data.TerraformConfig) *data.TerraformConfig {
+	if override == nil {
+		return base
+	}
+	if base == nil {
+		// definitions come from shared backends, anyone able to write them
+		// must not be able to pick a binary to run
+		result := *override
+		result.Path = ""
+		return &result
+	}
+
+	result := *base
+	if override.Engine != "" && override.Engine != engine(base) {
+		result.Engine = override.Engine
+		result.Path = ""
+	}
+
+	switch {
+	case result.Version == "":
+		result.Version = override.Version
+	case override.Version != "":
+		result.Version = result.Version + ", " + override.Version
+	}
+
+	return &result
+}
+
+func Validate(cfg *data.TerraformConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	if cfg.Engine != "" && cfg.Engine != EngineTerraform && cfg.Engine != EngineTofu {
+		return errors.Errorf("terraform engine must be %q or %q but is %q", EngineTerraform, EngineTofu, cfg.Engine)
+	}
+
+	if cfg.Version != "" {
+		_, err := version.NewConstraint(cfg.Version)
+		if err != nil {
+			return errors.Wrapf(err, "invalid terraform version constraint %q", cfg.Version)
+		}
+	}
+
+	if cfg.Path != "" && !filepath.IsAbs(cfg.Path) {
+		return errors.Errorf("terraform path %q must be absolute", cfg.Path)
+	}
+
+	return nil
+}
+
+func engine(cfg *data.TerraformConfig) string {
+	if cfg == nil || cfg.Engine == "" {
+		return EngineTerraform
+	}
+
+	return cfg.Engine
+}
+
+var (
+	resolvedMu sync.Mutex
+	resolved   = map[data.TerraformConfig]string{}
+)
+
+// Resolve finds the binary selected by cfg. Binaries are looked up in the
+// PATH unless cfg has an explicit path, either way their version must satisfy
+// the constraint of cfg. A nil cfg selects terraform.
+func Resolve(ctx context.Context, cfg *data.TerraformConfig) (string, error) {
 	logger := hclog.FromContext(ctx)
 
-	logger.Debug("Geting tfpath")
+	err := Validate(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	key := data.TerraformConfig{}
+	if cfg != nil {
+		key = *cfg
+	}
+	key.Engine = engine(cfg)
+
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	if tfpath, ok := resolved[key]; ok {
+		return tfpath, nil
+	}
+
+	p := product.Terraform
+	if key.Engine == EngineTofu {
+		p = tofu
+	}
+
+	constraint := key.Version
+	if constraint == "" && key.Engine == EngineTerraform {
+		constraint = defaultTerraformConstraint
+	}
+
+	logger.Debug("Resolving terraform binary", "engine", key.Engine, "version", constraint, "path", key.Path)
+
+	var tfpath string
+	if key.Path != "" {
+		tfpath, err = checkBinary(ctx, p, key.Path, constraint)
+	} else {
+		tfpath, err = findBinary(ctx, logger, p, constraint)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resolved[key] = tfpath
+	return tfpath, nil
+}
+
+func checkBinary(ctx context.Context, p product.Product, path, constraint string) (string, error) {
+	v, err := p.GetVersion(ctx, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to get version of %s", path)
+	}
+
+	if constraint != "" {
+		c, err := version.NewConstraint(constraint)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid terraform version constraint %q", constraint)
+		}
+
+		if !c.Check(v) {
+			return "", errors.Errorf("%s is %s %s which does not satisfy %q", path, p.Name, v, constraint)
+		}
+	}
+
+	return path, nil
+}
+
+func findBinary(ctx context.Context, logger hclog.Logger, p product.Product, constraint string) (string, error) {
+	var source src.Source = &fs.AnyVersion{Product: &p}
+	if constraint != "" {
+		c, err := version.NewConstraint(constraint)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid terraform version constraint %q", constraint)
+		}
+
+		source = &fs.Version{Product: p, Constraints: c}
+	}
 
 	i := install.NewInstaller()
 	i.SetLogger(logger.StandardLogger(&hclog.StandardLoggerOptions{
 		ForceLevel: hclog.Debug,
 	}))
-	tfpath, err := i.Ensure(ctx, []src.Source{
-		&fs.Version{
-			Product:     product.Terraform,
-			Constraints: version.MustConstraints(version.NewConstraint("<=1.5.5")),
-		},
-	})
-
-	return tfpath, err
+	tfpath, err := i.Ensure(ctx, []src.Source{source})
+	if err != nil {
+		if constraint == "" {
+			return "", errors.Wrapf(err, "fail to find %s", p.Name)
+		}
+
+		return "", errors.Wrapf(err, "fail to find %s matching %q", p.Name, constraint)
+	}
+
+	return tfpath, nil
 }
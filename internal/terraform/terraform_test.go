@@ -0,0 +1,121 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+// fakeBinary writes an executable named name to dir that prints output when
+// asked for its version.
+func fakeBinary(t *testing.T, dir, name, output string) string {
+	fpath := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\necho '%s'\n", output)
+	err := os.WriteFile(fpath, []byte(script), 0755)
+	require.NoError(t, err)
+
+	return fpath
+}
+
+func resetResolved(t *testing.T) {
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	resolved = map[data.TerraformConfig]string{}
+}
+
+func TestMerge(t *testing.T) {
+	base := &data.TerraformConfig{Engine: "terraform", Version: ">= 1.4", Path: "/usr/bin/terraform"}
+
+	assert.Equal(t, base, Merge(base, nil))
+	assert.Equal(t, &data.TerraformConfig{Engine: "terraform", Version: ">= 1.4"}, Merge(nil, base), "layers never select a binary")
+	assert.Equal(t, &data.TerraformConfig{}, Merge(nil, &data.TerraformConfig{Path: "/tmp/x"}))
+
+	assert.Equal(
+		t,
+		&data.TerraformConfig{Engine: "terraform", Version: ">= 1.4, < 1.6", Path: "/usr/bin/terraform"},
+		Merge(base, &data.TerraformConfig{Version: "< 1.6"}),
+	)
+
+	assert.Equal(
+		t,
+		&data.TerraformConfig{Engine: "tofu", Version: ">= 1.4"},
+		Merge(base, &data.TerraformConfig{Engine: "tofu"}),
+		"path of another engine is dropped",
+	)
+
+	assert.Equal(
+		t,
+		base,
+		Merge(base, &data.TerraformConfig{Engine: "terraform", Path: "/opt/terraform"}),
+		"the path of the context wins",
+	)
+
+	assert.Equal(
+		t,
+		&data.TerraformConfig{Engine: "tofu"},
+		Merge(&data.TerraformConfig{}, &data.TerraformConfig{Engine: "tofu", Path: "/opt/tofu"}),
+		"layers never select a binary",
+	)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(&data.TerraformConfig{Engine: "tofu", Version: ">= 1.6", Path: "/usr/bin/tofu"}))
+	assert.Error(t, Validate(&data.TerraformConfig{Engine: "pulumi"}))
+	assert.Error(t, Validate(&data.TerraformConfig{Version: "latest"}))
+	assert.Error(t, Validate(&data.TerraformConfig{Path: "bin/terraform"}))
+}
+
+func TestResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	terraform := fakeBinary(t, dir, "terraform", "Terraform v1.5.5\non linux_amd64")
+	tofu := fakeBinary(t, dir, "tofu", "OpenTofu v1.6.2\non linux_amd64")
+	t.Setenv("PATH", dir)
+
+	t.Run("binaries are looked up in the PATH", func(t *testing.T) {
+		resetResolved(t)
+
+		tfpath, err := Resolve(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, terraform, tfpath)
+
+		tfpath, err = Resolve(ctx, &data.TerraformConfig{Engine: "tofu", Version: "~> 1.6"})
+		require.NoError(t, err)
+		assert.Equal(t, tofu, tfpath)
+	})
+
+	t.Run("unsatisfiable constraints fail", func(t *testing.T) {
+		resetResolved(t)
+
+		_, err := Resolve(ctx, &data.TerraformConfig{Version: ">= 1.6"})
+		assert.ErrorContains(t, err, `fail to find terraform matching ">= 1.6"`)
+	})
+
+	t.Run("explicit paths must satisfy the constraint", func(t *testing.T) {
+		resetResolved(t)
+
+		other := fakeBinary(t, t.TempDir(), "terraform-1.4", "Terraform v1.4.0")
+		tfpath, err := Resolve(ctx, &data.TerraformConfig{Path: other, Version: "~> 1.4.0"})
+		require.NoError(t, err)
+		assert.Equal(t, other, tfpath)
+
+		_, err = Resolve(ctx, &data.TerraformConfig{Path: other, Version: ">= 1.5"})
+		assert.ErrorContains(t, err, "does not satisfy")
+
+		_, err = Resolve(ctx, &data.TerraformConfig{Engine: "tofu", Path: other})
+		assert.Error(t, err, "version output of terraform is not the one of tofu")
+	})
+}
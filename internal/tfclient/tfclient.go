@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/terraform-exec/tfexec"
@@ -45,6 +46,10 @@ func (c *client) Destroy(ctx context.Context, opts ...tfexec.DestroyOption) erro
 	return c.tf.Destroy(ctx, opts...)
 }
 
+// initLocks serializes inits that share a cache key, so instances of the same
+// layer can be initialized concurrently without reading a half written cache.
+var initLocks sync.Map
+
 func (c *client) Init(ctx context.Context, cacheKey []byte) error {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Running terraform init")
@@ -55,6 +60,10 @@ func (c *client) Init(ctx context.Context, cacheKey []byte) error {
 
 	hexCacheKey := fmt.Sprintf("%x", cacheKey)
 
+	lock, _ := initLocks.LoadOrStore(hexCacheKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
 	homedir, err := os.UserHomeDir()
 	if err != nil {
 		return errors.Wrap(err, "fail to get user home dir")
@@ -121,6 +130,20 @@ func (c *client) Apply(ctx context.Context, opts ...tfexec.ApplyOption) error {
 	return c.tf.Apply(ctx, opts...)
 }
 
+// Plan saves the plan to the path given with tfexec.Out, it returns whether
+// the plan has changes.
+func (c *client) Plan(ctx context.Context, opts ...tfexec.PlanOption) (bool, error) {
+	hclog.FromContext(ctx).Debug("Running terraform plan")
+
+	return c.tf.Plan(ctx, opts...)
+}
+
+func (c *client) ShowPlanFile(ctx context.Context, planPath string) (*tfjson.Plan, error) {
+	hclog.FromContext(ctx).Debug("Running terraform show on plan file")
+
+	return c.tf.ShowPlanFile(ctx, planPath)
+}
+
 func (c *client) Validate(ctx context.Context) (*tfjson.ValidateOutput, error) {
 	hclog.FromContext(ctx).Debug("Running terraform validate")
 
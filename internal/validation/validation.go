@@ -2,6 +2,7 @@ package validation
 
 import (
 	"net/url"
+	"os"
 	"regexp"
 )
 
@@ -20,6 +21,22 @@ func IsValidS3Region(region string) bool {
 	return true
 }
 
+func IsValidS3Endpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var gcsBucketRegex = regexp.MustCompile("^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$")
+
+func IsValidGCSBucket(bucketName string) bool {
+	return gcsBucketRegex.MatchString(bucketName)
+}
+
+func IsValidFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
 func IsValidEmail(email string) bool {
 	pattern := "^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\\.[a-zA-Z]{2,}$"
 	match, _ := regexp.MatchString(pattern, email)
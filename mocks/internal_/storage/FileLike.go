@@ -5,6 +5,7 @@ package mocks
 import (
 	context "context"
 
+	storage "github.com/ergomake/layerform/internal/storage"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -159,6 +160,49 @@ func (_c *FileLike_Save_Call) RunAndReturn(run func(context.Context, interface{}
 	return _c
 }
 
+// Update provides a mock function with given fields: ctx, fn
+func (_m *FileLike) Update(ctx context.Context, fn storage.UpdateFunc) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.UpdateFunc) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FileLike_Update_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Update'
+type FileLike_Update_Call struct {
+	*mock.Call
+}
+
+// Update is a helper method to define mock.On call
+//   - ctx context.Context
+//   - fn storage.UpdateFunc
+func (_e *FileLike_Expecter) Update(ctx interface{}, fn interface{}) *FileLike_Update_Call {
+	return &FileLike_Update_Call{Call: _e.mock.On("Update", ctx, fn)}
+}
+
+func (_c *FileLike_Update_Call) Run(run func(ctx context.Context, fn storage.UpdateFunc)) *FileLike_Update_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(storage.UpdateFunc))
+	})
+	return _c
+}
+
+func (_c *FileLike_Update_Call) Return(_a0 error) *FileLike_Update_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *FileLike_Update_Call) RunAndReturn(run func(context.Context, storage.UpdateFunc) error) *FileLike_Update_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewFileLike creates a new instance of FileLike. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewFileLike(t interface {
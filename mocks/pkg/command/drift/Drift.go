@@ -0,0 +1,94 @@
+// Code generated by mockery v2.32.2. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	drift "github.com/ergomake/layerform/pkg/command/drift"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Drift is an autogenerated mock type for the Drift type
+type Drift struct {
+	mock.Mock
+}
+
+type Drift_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *Drift) EXPECT() *Drift_Expecter {
+	return &Drift_Expecter{mock: &_m.Mock}
+}
+
+// Run provides a mock function with given fields: ctx, definitionName, instanceName, vars
+func (_m *Drift) Run(ctx context.Context, definitionName string, instanceName string, vars []string) ([]*drift.Report, error) {
+	ret := _m.Called(ctx, definitionName, instanceName, vars)
+
+	var r0 []*drift.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) ([]*drift.Report, error)); ok {
+		return rf(ctx, definitionName, instanceName, vars)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) []*drift.Report); ok {
+		r0 = rf(ctx, definitionName, instanceName, vars)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*drift.Report)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []string) error); ok {
+		r1 = rf(ctx, definitionName, instanceName, vars)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Drift_Run_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Run'
+type Drift_Run_Call struct {
+	*mock.Call
+}
+
+// Run is a helper method to define mock.On call
+//   - ctx context.Context
+//   - definitionName string
+//   - instanceName string
+//   - vars []string
+func (_e *Drift_Expecter) Run(ctx interface{}, definitionName interface{}, instanceName interface{}, vars interface{}) *Drift_Run_Call {
+	return &Drift_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, instanceName, vars)}
+}
+
+func (_c *Drift_Run_Call) Run(run func(ctx context.Context, definitionName string, instanceName string, vars []string)) *Drift_Run_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].([]string))
+	})
+	return _c
+}
+
+func (_c *Drift_Run_Call) Return(_a0 []*drift.Report, _a1 error) *Drift_Run_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Drift_Run_Call) RunAndReturn(run func(context.Context, string, string, []string) ([]*drift.Report, error)) *Drift_Run_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewDrift creates a new instance of Drift. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewDrift(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Drift {
+	mock := &Drift{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
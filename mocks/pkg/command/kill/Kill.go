@@ -21,13 +21,13 @@ func (_m *Kill) EXPECT() *Kill_Expecter {
 	return &Kill_Expecter{mock: &_m.Mock}
 }
 
-// Run provides a mock function with given fields: ctx, definitionName, instanceName, autoApprove, vars
-func (_m *Kill) Run(ctx context.Context, definitionName string, instanceName string, autoApprove bool, vars []string) error {
-	ret := _m.Called(ctx, definitionName, instanceName, autoApprove, vars)
+// Run provides a mock function with given fields: ctx, definitionName, instanceName, autoApprove, vars, force, useCurrentDefinition
+func (_m *Kill) Run(ctx context.Context, definitionName string, instanceName string, autoApprove bool, vars []string, force bool, useCurrentDefinition bool) error {
+	ret := _m.Called(ctx, definitionName, instanceName, autoApprove, vars, force, useCurrentDefinition)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool, []string) error); ok {
-		r0 = rf(ctx, definitionName, instanceName, autoApprove, vars)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool, []string, bool, bool) error); ok {
+		r0 = rf(ctx, definitionName, instanceName, autoApprove, vars, force, useCurrentDefinition)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -46,13 +46,15 @@ type Kill_Run_Call struct {
 //   - instanceName string
 //   - autoApprove bool
 //   - vars []string
-func (_e *Kill_Expecter) Run(ctx interface{}, definitionName interface{}, instanceName interface{}, autoApprove interface{}, vars interface{}) *Kill_Run_Call {
-	return &Kill_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, instanceName, autoApprove, vars)}
+//   - force bool
+//   - useCurrentDefinition bool
+func (_e *Kill_Expecter) Run(ctx interface{}, definitionName interface{}, instanceName interface{}, autoApprove interface{}, vars interface{}, force interface{}, useCurrentDefinition interface{}) *Kill_Run_Call {
+	return &Kill_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, instanceName, autoApprove, vars, force, useCurrentDefinition)}
 }
 
-func (_c *Kill_Run_Call) Run(run func(ctx context.Context, definitionName string, instanceName string, autoApprove bool, vars []string)) *Kill_Run_Call {
+func (_c *Kill_Run_Call) Run(run func(ctx context.Context, definitionName string, instanceName string, autoApprove bool, vars []string, force bool, useCurrentDefinition bool)) *Kill_Run_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool), args[4].([]string))
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool), args[4].([]string), args[5].(bool), args[6].(bool))
 	})
 	return _c
 }
@@ -62,7 +64,7 @@ func (_c *Kill_Run_Call) Return(_a0 error) *Kill_Run_Call {
 	return _c
 }
 
-func (_c *Kill_Run_Call) RunAndReturn(run func(context.Context, string, string, bool, []string) error) *Kill_Run_Call {
+func (_c *Kill_Run_Call) RunAndReturn(run func(context.Context, string, string, bool, []string, bool, bool) error) *Kill_Run_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -5,6 +5,8 @@ package mocks
 import (
 	context "context"
 
+	command "github.com/ergomake/layerform/pkg/command"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -21,13 +23,13 @@ func (_m *Spawn) EXPECT() *Spawn_Expecter {
 	return &Spawn_Expecter{mock: &_m.Mock}
 }
 
-// Run provides a mock function with given fields: ctx, definitionName, instanceName, dependenciesInstance, vars
-func (_m *Spawn) Run(ctx context.Context, definitionName string, instanceName string, dependenciesInstance map[string]string, vars []string) error {
-	ret := _m.Called(ctx, definitionName, instanceName, dependenciesInstance, vars)
+// Run provides a mock function with given fields: ctx, definitionName, instanceName, dependenciesInstance, vars, planMode, parallelism
+func (_m *Spawn) Run(ctx context.Context, definitionName string, instanceName string, dependenciesInstance map[string]string, vars []string, planMode command.PlanMode, parallelism int) error {
+	ret := _m.Called(ctx, definitionName, instanceName, dependenciesInstance, vars, planMode, parallelism)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, map[string]string, []string) error); ok {
-		r0 = rf(ctx, definitionName, instanceName, dependenciesInstance, vars)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, map[string]string, []string, command.PlanMode, int) error); ok {
+		r0 = rf(ctx, definitionName, instanceName, dependenciesInstance, vars, planMode, parallelism)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -46,13 +48,15 @@ type Spawn_Run_Call struct {
 //   - instanceName string
 //   - dependenciesInstance map[string]string
 //   - vars []string
-func (_e *Spawn_Expecter) Run(ctx interface{}, definitionName interface{}, instanceName interface{}, dependenciesInstance interface{}, vars interface{}) *Spawn_Run_Call {
-	return &Spawn_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, instanceName, dependenciesInstance, vars)}
+//   - planMode command.PlanMode
+//   - parallelism int
+func (_e *Spawn_Expecter) Run(ctx interface{}, definitionName interface{}, instanceName interface{}, dependenciesInstance interface{}, vars interface{}, planMode interface{}, parallelism interface{}) *Spawn_Run_Call {
+	return &Spawn_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, instanceName, dependenciesInstance, vars, planMode, parallelism)}
 }
 
-func (_c *Spawn_Run_Call) Run(run func(ctx context.Context, definitionName string, instanceName string, dependenciesInstance map[string]string, vars []string)) *Spawn_Run_Call {
+func (_c *Spawn_Run_Call) Run(run func(ctx context.Context, definitionName string, instanceName string, dependenciesInstance map[string]string, vars []string, planMode command.PlanMode, parallelism int)) *Spawn_Run_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(map[string]string), args[4].([]string))
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(map[string]string), args[4].([]string), args[5].(command.PlanMode), args[6].(int))
 	})
 	return _c
 }
@@ -62,7 +66,7 @@ func (_c *Spawn_Run_Call) Return(_a0 error) *Spawn_Run_Call {
 	return _c
 }
 
-func (_c *Spawn_Run_Call) RunAndReturn(run func(context.Context, string, string, map[string]string, []string) error) *Spawn_Run_Call {
+func (_c *Spawn_Run_Call) RunAndReturn(run func(context.Context, string, string, map[string]string, []string, command.PlanMode, int) error) *Spawn_Run_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -0,0 +1,93 @@
+// Code generated by mockery v2.32.2. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	upgrade "github.com/ergomake/layerform/pkg/command/upgrade"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Upgrade is an autogenerated mock type for the Upgrade type
+type Upgrade struct {
+	mock.Mock
+}
+
+type Upgrade_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *Upgrade) EXPECT() *Upgrade_Expecter {
+	return &Upgrade_Expecter{mock: &_m.Mock}
+}
+
+// Run provides a mock function with given fields: ctx, definitionName, concurrency
+func (_m *Upgrade) Run(ctx context.Context, definitionName string, concurrency int) ([]*upgrade.Report, error) {
+	ret := _m.Called(ctx, definitionName, concurrency)
+
+	var r0 []*upgrade.Report
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]*upgrade.Report, error)); ok {
+		return rf(ctx, definitionName, concurrency)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []*upgrade.Report); ok {
+		r0 = rf(ctx, definitionName, concurrency)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*upgrade.Report)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, definitionName, concurrency)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Upgrade_Run_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Run'
+type Upgrade_Run_Call struct {
+	*mock.Call
+}
+
+// Run is a helper method to define mock.On call
+//   - ctx context.Context
+//   - definitionName string
+//   - concurrency int
+func (_e *Upgrade_Expecter) Run(ctx interface{}, definitionName interface{}, concurrency interface{}) *Upgrade_Run_Call {
+	return &Upgrade_Run_Call{Call: _e.mock.On("Run", ctx, definitionName, concurrency)}
+}
+
+func (_c *Upgrade_Run_Call) Run(run func(ctx context.Context, definitionName string, concurrency int)) *Upgrade_Run_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *Upgrade_Run_Call) Return(_a0 []*upgrade.Report, _a1 error) *Upgrade_Run_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Upgrade_Run_Call) RunAndReturn(run func(context.Context, string, int) ([]*upgrade.Report, error)) *Upgrade_Run_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewUpgrade creates a new instance of Upgrade. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewUpgrade(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Upgrade {
+	mock := &Upgrade{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
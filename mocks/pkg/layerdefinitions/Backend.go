@@ -23,6 +23,49 @@ func (_m *Backend) EXPECT() *Backend_Expecter {
 	return &Backend_Expecter{mock: &_m.Mock}
 }
 
+// DeleteLayer provides a mock function with given fields: ctx, name
+func (_m *Backend) DeleteLayer(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Backend_DeleteLayer_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteLayer'
+type Backend_DeleteLayer_Call struct {
+	*mock.Call
+}
+
+// DeleteLayer is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Backend_Expecter) DeleteLayer(ctx interface{}, name interface{}) *Backend_DeleteLayer_Call {
+	return &Backend_DeleteLayer_Call{Call: _e.mock.On("DeleteLayer", ctx, name)}
+}
+
+func (_c *Backend_DeleteLayer_Call) Run(run func(ctx context.Context, name string)) *Backend_DeleteLayer_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Backend_DeleteLayer_Call) Return(_a0 error) *Backend_DeleteLayer_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Backend_DeleteLayer_Call) RunAndReturn(run func(context.Context, string) error) *Backend_DeleteLayer_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetLayer provides a mock function with given fields: ctx, name
 func (_m *Backend) GetLayer(ctx context.Context, name string) (*data.LayerDefinition, error) {
 	ret := _m.Called(ctx, name)
@@ -78,6 +121,214 @@ func (_c *Backend_GetLayer_Call) RunAndReturn(run func(context.Context, string)
 	return _c
 }
 
+// GetLayerVersion provides a mock function with given fields: ctx, name, sha
+func (_m *Backend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	ret := _m.Called(ctx, name, sha)
+
+	var r0 *data.LayerDefinition
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) (*data.LayerDefinition, error)); ok {
+		return rf(ctx, name, sha)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) *data.LayerDefinition); ok {
+		r0 = rf(ctx, name, sha)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*data.LayerDefinition)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte) error); ok {
+		r1 = rf(ctx, name, sha)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Backend_GetLayerVersion_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLayerVersion'
+type Backend_GetLayerVersion_Call struct {
+	*mock.Call
+}
+
+// GetLayerVersion is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+//   - sha []byte
+func (_e *Backend_Expecter) GetLayerVersion(ctx interface{}, name interface{}, sha interface{}) *Backend_GetLayerVersion_Call {
+	return &Backend_GetLayerVersion_Call{Call: _e.mock.On("GetLayerVersion", ctx, name, sha)}
+}
+
+func (_c *Backend_GetLayerVersion_Call) Run(run func(ctx context.Context, name string, sha []byte)) *Backend_GetLayerVersion_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].([]byte))
+	})
+	return _c
+}
+
+func (_c *Backend_GetLayerVersion_Call) Return(_a0 *data.LayerDefinition, _a1 error) *Backend_GetLayerVersion_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Backend_GetLayerVersion_Call) RunAndReturn(run func(context.Context, string, []byte) (*data.LayerDefinition, error)) *Backend_GetLayerVersion_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ImportHistory provides a mock function with given fields: ctx, versions
+func (_m *Backend) ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error {
+	ret := _m.Called(ctx, versions)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*data.LayerDefinitionVersion) error); ok {
+		r0 = rf(ctx, versions)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Backend_ImportHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImportHistory'
+type Backend_ImportHistory_Call struct {
+	*mock.Call
+}
+
+// ImportHistory is a helper method to define mock.On call
+//   - ctx context.Context
+//   - versions []*data.LayerDefinitionVersion
+func (_e *Backend_Expecter) ImportHistory(ctx interface{}, versions interface{}) *Backend_ImportHistory_Call {
+	return &Backend_ImportHistory_Call{Call: _e.mock.On("ImportHistory", ctx, versions)}
+}
+
+func (_c *Backend_ImportHistory_Call) Run(run func(ctx context.Context, versions []*data.LayerDefinitionVersion)) *Backend_ImportHistory_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]*data.LayerDefinitionVersion))
+	})
+	return _c
+}
+
+func (_c *Backend_ImportHistory_Call) Return(_a0 error) *Backend_ImportHistory_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Backend_ImportHistory_Call) RunAndReturn(run func(context.Context, []*data.LayerDefinitionVersion) error) *Backend_ImportHistory_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListHistory provides a mock function with given fields: ctx
+func (_m *Backend) ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []*data.LayerDefinitionVersion
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*data.LayerDefinitionVersion, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []*data.LayerDefinitionVersion); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*data.LayerDefinitionVersion)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Backend_ListHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListHistory'
+type Backend_ListHistory_Call struct {
+	*mock.Call
+}
+
+// ListHistory is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Backend_Expecter) ListHistory(ctx interface{}) *Backend_ListHistory_Call {
+	return &Backend_ListHistory_Call{Call: _e.mock.On("ListHistory", ctx)}
+}
+
+func (_c *Backend_ListHistory_Call) Run(run func(ctx context.Context)) *Backend_ListHistory_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Backend_ListHistory_Call) Return(_a0 []*data.LayerDefinitionVersion, _a1 error) *Backend_ListHistory_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Backend_ListHistory_Call) RunAndReturn(run func(context.Context) ([]*data.LayerDefinitionVersion, error)) *Backend_ListHistory_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListLayerHistory provides a mock function with given fields: ctx, name
+func (_m *Backend) ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 []*data.LayerDefinitionVersion
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]*data.LayerDefinitionVersion, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []*data.LayerDefinitionVersion); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*data.LayerDefinitionVersion)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Backend_ListLayerHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListLayerHistory'
+type Backend_ListLayerHistory_Call struct {
+	*mock.Call
+}
+
+// ListLayerHistory is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Backend_Expecter) ListLayerHistory(ctx interface{}, name interface{}) *Backend_ListLayerHistory_Call {
+	return &Backend_ListLayerHistory_Call{Call: _e.mock.On("ListLayerHistory", ctx, name)}
+}
+
+func (_c *Backend_ListLayerHistory_Call) Run(run func(ctx context.Context, name string)) *Backend_ListLayerHistory_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Backend_ListLayerHistory_Call) Return(_a0 []*data.LayerDefinitionVersion, _a1 error) *Backend_ListLayerHistory_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Backend_ListLayerHistory_Call) RunAndReturn(run func(context.Context, string) ([]*data.LayerDefinitionVersion, error)) *Backend_ListLayerHistory_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ListLayers provides a mock function with given fields: ctx
 func (_m *Backend) ListLayers(ctx context.Context) ([]*data.LayerDefinition, error) {
 	ret := _m.Called(ctx)
@@ -282,6 +533,49 @@ func (_c *Backend_UpdateLayers_Call) RunAndReturn(run func(context.Context, []*d
 	return _c
 }
 
+// UpsertLayers provides a mock function with given fields: ctx, layers
+func (_m *Backend) UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	ret := _m.Called(ctx, layers)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*data.LayerDefinition) error); ok {
+		r0 = rf(ctx, layers)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Backend_UpsertLayers_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpsertLayers'
+type Backend_UpsertLayers_Call struct {
+	*mock.Call
+}
+
+// UpsertLayers is a helper method to define mock.On call
+//   - ctx context.Context
+//   - layers []*data.LayerDefinition
+func (_e *Backend_Expecter) UpsertLayers(ctx interface{}, layers interface{}) *Backend_UpsertLayers_Call {
+	return &Backend_UpsertLayers_Call{Call: _e.mock.On("UpsertLayers", ctx, layers)}
+}
+
+func (_c *Backend_UpsertLayers_Call) Run(run func(ctx context.Context, layers []*data.LayerDefinition)) *Backend_UpsertLayers_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]*data.LayerDefinition))
+	})
+	return _c
+}
+
+func (_c *Backend_UpsertLayers_Call) Return(_a0 error) *Backend_UpsertLayers_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Backend_UpsertLayers_Call) RunAndReturn(run func(context.Context, []*data.LayerDefinition) error) *Backend_UpsertLayers_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewBackend creates a new instance of Backend. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewBackend(t interface {
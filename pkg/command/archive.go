@@ -0,0 +1,421 @@
+package command
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+// ARCHIVE_FORMAT_VERSION is bumped on incompatible changes to the layout of
+// context archives, import refuses archives with a newer version.
+const ARCHIVE_FORMAT_VERSION = 1
+
+const (
+	archiveManifestName    = "manifest.json"
+	archiveDefinitionsName = "definitions.json"
+	archiveHistoryName     = "history.json"
+	archiveInstancesName   = "instances.json"
+	archiveEnvVarsName     = "envvars.json"
+)
+
+type archiveManifest struct {
+	FormatVersion    uint              `json:"formatVersion"`
+	LayerformVersion string            `json:"layerformVersion"`
+	InstanceVersion  uint              `json:"instanceVersion"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	Source           string            `json:"source"`
+	Definitions      int               `json:"definitions"`
+	History          int               `json:"history"`
+	Instances        int               `json:"instances"`
+	EnvVars          int               `json:"envVars"`
+	Checksums        map[string]string `json:"checksums"`
+}
+
+type exportCommand struct {
+	backends         ContextBackends
+	layerformVersion string
+}
+
+func NewExport(backends ContextBackends, layerformVersion string) *exportCommand {
+	return &exportCommand{backends, layerformVersion}
+}
+
+// Run writes a tar.gz archive of every definition, instance and environment
+// variable of the context to w. The archive has a manifest with the sha256
+// checksum of every other file in it.
+func (c *exportCommand) Run(ctx context.Context, w io.Writer) error {
+	logger := hclog.FromContext(ctx)
+
+	contextData, err := readContext(ctx, c.backends)
+	if err != nil {
+		return errors.Wrap(err, "fail to read context")
+	}
+
+	source, err := c.backends.Definitions.Location(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fail to get context location")
+	}
+
+	files := []struct {
+		name  string
+		value any
+	}{
+		{archiveDefinitionsName, contextData.definitions},
+		{archiveHistoryName, contextData.history},
+		{archiveInstancesName, contextData.instances},
+		{archiveEnvVarsName, contextData.variables},
+	}
+
+	manifest := archiveManifest{
+		FormatVersion:    ARCHIVE_FORMAT_VERSION,
+		LayerformVersion: c.layerformVersion,
+		InstanceVersion:  data.CURRENT_INSTANCE_VERSION,
+		CreatedAt:        time.Now().UTC(),
+		Source:           source,
+		Definitions:      len(contextData.definitions),
+		History:          len(contextData.history),
+		Instances:        len(contextData.instances),
+		EnvVars:          len(contextData.variables),
+		Checksums:        map[string]string{},
+	}
+
+	contents := map[string][]byte{}
+	for _, f := range files {
+		b, err := json.MarshalIndent(f.value, "", "  ")
+		if err != nil {
+			return errors.Wrapf(err, "fail to encode %s", f.name)
+		}
+
+		sum := sha256.Sum256(b)
+		manifest.Checksums[f.name] = hex.EncodeToString(sum[:])
+		contents[f.name] = b
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "fail to encode manifest")
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// manifest goes first so readers can validate it before anything else
+	names := []string{archiveManifestName}
+	contents[archiveManifestName] = manifestBytes
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+
+	for _, name := range names {
+		logger.Debug("Writing archive entry", "name", name)
+		b := contents[name]
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(b)),
+			ModTime: manifest.CreatedAt,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "fail to write %s header", name)
+		}
+
+		if _, err := tw.Write(b); err != nil {
+			return errors.Wrapf(err, "fail to write %s", name)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "fail to finish tar archive")
+	}
+
+	return errors.Wrap(gz.Close(), "fail to finish gzip stream")
+}
+
+// ConflictPolicy decides what import does with data that exists in both the
+// archive and the context but differs.
+type ConflictPolicy string
+
+const (
+	ConflictPolicySkip      ConflictPolicy = "skip"
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	ConflictPolicyFail      ConflictPolicy = "fail"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyFail:
+		return p, nil
+	}
+
+	return "", errors.Errorf("invalid conflict policy %q, must be one of skip, overwrite or fail", s)
+}
+
+type importCommand struct {
+	backends ContextBackends
+}
+
+func NewImport(backends ContextBackends) *importCommand {
+	return &importCommand{backends}
+}
+
+// readArchive reads and validates an archive written by exportCommand, every
+// checksum is verified before anything is decoded.
+func readArchive(r io.Reader) (*archiveManifest, *contextData, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fail to open gzip stream")
+	}
+	defer gz.Close()
+
+	contents := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "fail to read tar archive")
+		}
+
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "fail to read %s", header.Name)
+		}
+		contents[header.Name] = b
+	}
+
+	manifestBytes, ok := contents[archiveManifestName]
+	if !ok {
+		return nil, nil, errors.Errorf("archive has no %s", archiveManifestName)
+	}
+
+	var manifest archiveManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fail to decode manifest")
+	}
+
+	if manifest.FormatVersion > ARCHIVE_FORMAT_VERSION {
+		return nil, nil, errors.Errorf(
+			"archive has format version %d and was created by layerform %s, upgrade layerform to import it",
+			manifest.FormatVersion,
+			manifest.LayerformVersion,
+		)
+	}
+
+	for _, name := range []string{archiveDefinitionsName, archiveHistoryName, archiveInstancesName, archiveEnvVarsName} {
+		b, ok := contents[name]
+		if !ok {
+			return nil, nil, errors.Errorf("archive has no %s", name)
+		}
+
+		sum := sha256.Sum256(b)
+		if hex.EncodeToString(sum[:]) != manifest.Checksums[name] {
+			return nil, nil, errors.Errorf("checksum of %s does not match the manifest, archive is corrupted", name)
+		}
+	}
+
+	archived := &contextData{}
+	if err := json.Unmarshal(contents[archiveDefinitionsName], &archived.definitions); err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to decode %s", archiveDefinitionsName)
+	}
+	if err := json.Unmarshal(contents[archiveHistoryName], &archived.history); err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to decode %s", archiveHistoryName)
+	}
+	if err := json.Unmarshal(contents[archiveInstancesName], &archived.instances); err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to decode %s", archiveInstancesName)
+	}
+	if err := json.Unmarshal(contents[archiveEnvVarsName], &archived.variables); err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to decode %s", archiveEnvVarsName)
+	}
+
+	if len(archived.definitions) != manifest.Definitions ||
+		len(archived.history) != manifest.History ||
+		len(archived.instances) != manifest.Instances ||
+		len(archived.variables) != manifest.EnvVars {
+		return nil, nil, errors.New("archive content does not match the counts of the manifest")
+	}
+
+	return &manifest, archived, nil
+}
+
+// Run imports the archive read from r into the context. Data that is
+// identical in the archive and the context is left alone, data that differs
+// is handled according to policy. With ConflictPolicyFail nothing is written
+// when there is any conflict.
+func (c *importCommand) Run(ctx context.Context, r io.Reader, policy ConflictPolicy) error {
+	logger := hclog.FromContext(ctx)
+
+	manifest, archived, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(
+		os.Stdout,
+		"Importing archive of %s created at %s by layerform %s.\n",
+		manifest.Source,
+		manifest.CreatedAt.Format(time.RFC3339),
+		manifest.LayerformVersion,
+	)
+
+	current, err := readContext(ctx, c.backends)
+	if err != nil {
+		return errors.Wrap(err, "fail to read context")
+	}
+
+	conflicts := []string{}
+
+	definitions := map[string]*data.LayerDefinition{}
+	for _, d := range current.definitions {
+		definitions[d.Name] = d
+	}
+	importedDefinitions := 0
+	for _, d := range archived.definitions {
+		existing, ok := definitions[d.Name]
+		if ok && bytes.Equal(existing.SHA, d.SHA) {
+			continue
+		}
+
+		if ok {
+			conflicts = append(conflicts, fmt.Sprintf("definition %s", d.Name))
+			if policy != ConflictPolicyOverwrite {
+				continue
+			}
+		}
+
+		definitions[d.Name] = d
+		importedDefinitions++
+	}
+
+	instances := []*data.LayerInstance{}
+	currentInstances := map[string]*data.LayerInstance{}
+	for _, i := range current.instances {
+		currentInstances[instanceKey(i)] = i
+	}
+	for _, i := range archived.instances {
+		existing, ok := currentInstances[instanceKey(i)]
+		if ok && bytes.Equal(existing.DefinitionSHA, i.DefinitionSHA) &&
+			bytes.Equal(existing.Bytes, i.Bytes) && existing.Status == i.Status {
+			continue
+		}
+
+		if ok {
+			conflicts = append(conflicts, fmt.Sprintf("instance %s of layer %s", i.InstanceName, i.DefinitionName))
+			if policy != ConflictPolicyOverwrite {
+				continue
+			}
+		}
+
+		instances = append(instances, i)
+	}
+
+	variables := []*data.EnvVar{}
+	currentVariables := map[string]string{}
+	for _, v := range current.variables {
+		currentVariables[v.Name] = v.Value
+	}
+	for _, v := range archived.variables {
+		value, ok := currentVariables[v.Name]
+		if ok && value == v.Value {
+			continue
+		}
+
+		if ok {
+			conflicts = append(conflicts, fmt.Sprintf("environment variable %s", v.Name))
+			if policy != ConflictPolicyOverwrite {
+				continue
+			}
+		}
+
+		variables = append(variables, v)
+	}
+
+	if len(conflicts) > 0 && policy == ConflictPolicyFail {
+		return errors.Errorf(
+			"archive conflicts with the context, nothing was imported:\n  %s",
+			strings.Join(conflicts, "\n  "),
+		)
+	}
+
+	for _, conflict := range conflicts {
+		if policy == ConflictPolicySkip {
+			fmt.Fprintf(os.Stdout, "Skipped %s, it differs from the archive.\n", conflict)
+		} else {
+			fmt.Fprintf(os.Stdout, "Overwrote %s.\n", conflict)
+		}
+	}
+
+	if importedDefinitions > 0 {
+		names := make([]string, 0, len(definitions))
+		for name := range definitions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		layers := make([]*data.LayerDefinition, len(names))
+		for i, name := range names {
+			layers[i] = definitions[name]
+		}
+
+		logger.Debug("Writing definitions", "count", len(layers))
+		err := c.backends.Definitions.UpdateLayers(ctx, layers)
+		if err != nil {
+			return errors.Wrap(err, "fail to write definitions")
+		}
+	}
+
+	// versions are identified by their sha, so the history never conflicts
+	if len(archived.history) > 0 {
+		logger.Debug("Writing definitions history", "count", len(archived.history))
+		err := c.backends.Definitions.ImportHistory(ctx, archived.history)
+		if err != nil {
+			return errors.Wrap(err, "fail to write definitions history")
+		}
+	}
+
+	for _, i := range instances {
+		logger.Debug("Writing instance", "layer", i.DefinitionName, "instance", i.InstanceName)
+		err := c.backends.Instances.SaveInstance(ctx, i)
+		if err != nil {
+			return errors.Wrapf(err, "fail to write instance %s of layer %s", i.InstanceName, i.DefinitionName)
+		}
+	}
+
+	for _, v := range variables {
+		logger.Debug("Writing environment variable", "name", v.Name)
+		err := c.backends.EnvVars.SaveVariable(ctx, v)
+		if err != nil {
+			return errors.Wrapf(err, "fail to write environment variable %s", v.Name)
+		}
+	}
+
+	fmt.Fprintf(
+		os.Stdout,
+		"Imported %d of %d definitions, %d of %d instances and %d of %d environment variables.\n",
+		importedDefinitions,
+		len(archived.definitions),
+		len(instances),
+		len(archived.instances),
+		len(variables),
+		len(archived.variables),
+	)
+
+	return nil
+}
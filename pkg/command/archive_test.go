@@ -0,0 +1,117 @@
+package command
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	sourceDir := t.TempDir()
+
+	source := newFileBackends(t, sourceDir)
+	require.NoError(t, source.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{
+		{SHA: []byte("base"), Name: "base", Files: []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte("tf")}}},
+	}))
+	require.NoError(t, source.Instances.SaveInstance(ctx, &data.LayerInstance{
+		DefinitionSHA:  []byte("base"),
+		DefinitionName: "base",
+		InstanceName:   "default",
+		Bytes:          []byte("state"),
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}))
+	require.NoError(t, source.EnvVars.SaveVariable(ctx, &data.EnvVar{Name: "A", Value: "b"}))
+	require.NoError(t, source.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{
+		{SHA: []byte("base-v2"), Name: "base", Files: []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte("tf2")}}},
+	}))
+
+	var archive bytes.Buffer
+	require.NoError(t, NewExport(source, "test").Run(ctx, &archive))
+
+	t.Run("round trips every resource", func(t *testing.T) {
+		targetDir := t.TempDir()
+		err := NewImport(newFileBackends(t, targetDir)).Run(ctx, bytes.NewReader(archive.Bytes()), ConflictPolicyFail)
+		require.NoError(t, err)
+
+		err = NewMigrate(source, newFileBackends(t, targetDir)).Verify(ctx, newFileBackends(t, targetDir))
+		require.NoError(t, err)
+
+		pinned, err := newFileBackends(t, targetDir).Definitions.GetLayerVersion(ctx, "base", []byte("base"))
+		require.NoError(t, err, "history is imported")
+		assert.Equal(t, []byte("tf"), pinned.Files[0].Content)
+
+		// importing again is a no-op even when failing on conflicts
+		err = NewImport(newFileBackends(t, targetDir)).Run(ctx, bytes.NewReader(archive.Bytes()), ConflictPolicyFail)
+		require.NoError(t, err)
+	})
+
+	t.Run("conflict policies", func(t *testing.T) {
+		targetDir := t.TempDir()
+		target := newFileBackends(t, targetDir)
+		require.NoError(t, target.EnvVars.SaveVariable(ctx, &data.EnvVar{Name: "A", Value: "changed"}))
+
+		err := NewImport(target).Run(ctx, bytes.NewReader(archive.Bytes()), ConflictPolicyFail)
+		assert.ErrorContains(t, err, "environment variable A")
+		instances, err := newFileBackends(t, targetDir).Instances.ListInstances(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, instances, "nothing is written when failing")
+
+		err = NewImport(target).Run(ctx, bytes.NewReader(archive.Bytes()), ConflictPolicySkip)
+		require.NoError(t, err)
+		variables, err := newFileBackends(t, targetDir).EnvVars.ListVariables(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*data.EnvVar{{Name: "A", Value: "changed"}}, variables)
+		instances, err = newFileBackends(t, targetDir).Instances.ListInstances(ctx)
+		require.NoError(t, err)
+		assert.Len(t, instances, 1)
+
+		err = NewImport(target).Run(ctx, bytes.NewReader(archive.Bytes()), ConflictPolicyOverwrite)
+		require.NoError(t, err)
+		variables, err = newFileBackends(t, targetDir).EnvVars.ListVariables(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*data.EnvVar{{Name: "A", Value: "b"}}, variables)
+	})
+
+	t.Run("rejects tampered archives", func(t *testing.T) {
+		gz, err := gzip.NewReader(bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+		tr := tar.NewReader(gz)
+
+		var tampered bytes.Buffer
+		gzw := gzip.NewWriter(&tampered)
+		tw := tar.NewWriter(gzw)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+
+			b, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			if header.Name == archiveEnvVarsName {
+				b = bytes.Replace(b, []byte(`"b"`), []byte(`"x"`), 1)
+			}
+
+			header.Size = int64(len(b))
+			require.NoError(t, tw.WriteHeader(header))
+			_, err = tw.Write(b)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gzw.Close())
+
+		err = NewImport(newFileBackends(t, t.TempDir())).Run(ctx, &tampered, ConflictPolicyOverwrite)
+		assert.ErrorContains(t, err, "checksum of envvars.json does not match the manifest")
+	})
+}
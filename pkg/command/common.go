@@ -1,6 +1,7 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/ergomake/layerform/internal/pathutils"
 	"github.com/ergomake/layerform/internal/tags"
+	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/tfclient"
 	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/layerdefinitions"
@@ -31,63 +33,143 @@ func WriteLayerToWorkdir(
 	logger := hclog.FromContext(ctx).With("layer", layer.Name, "layerWorkdir", layerWorkdir)
 	logger.Debug("Writting layer to workdir")
 
-	var inner func(*data.LayerDefinition) ([]string, error)
-	inner = func(layer *data.LayerDefinition) ([]string, error) {
-		fpaths := make([]string, 0)
+	layers := []*data.LayerDefinition{}
+	collected := map[string]struct{}{}
+	var collect func(*data.LayerDefinition) error
+	collect = func(layer *data.LayerDefinition) error {
+		if _, ok := collected[layer.Name]; ok {
+			return nil
+		}
+		collected[layer.Name] = struct{}{}
+
 		for _, dep := range layer.Dependencies {
 			logger.Debug("Writting dependency to workdir", "dependency", dep)
 
 			layer, err := definitionsBackend.GetLayer(ctx, dep)
 			if err != nil {
-				return nil, errors.Wrap(err, "fail to get layer")
+				return errors.Wrap(err, "fail to get layer")
+			}
+
+			err = collect(layer)
+			if err != nil {
+				return errors.Wrap(err, "fail to write layer to workdir")
+			}
+		}
+
+		layers = append(layers, layer)
+		return nil
+	}
+
+	err := collect(layer)
+	if err != nil {
+		return "", errors.Wrap(err, "fail to write layer to workdir")
+	}
+
+	// definitions may come from shared storage, so paths are never trusted
+	// to stay inside of the workdir
+	depth := 0
+	type owner struct {
+		layer   string
+		content []byte
+	}
+	owners := map[string]owner{}
+	for _, l := range layers {
+		for _, f := range l.Files {
+			err := pathutils.ValidateRelative(f.Path, false)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid file in layer %s", l.Name)
 			}
 
-			depPaths, err := inner(layer)
+			// every layer is written to the same directory, so a file must not
+			// replace a different file of another layer
+			if o, ok := owners[f.Path]; ok && !bytes.Equal(o.content, f.Content) {
+				return "", errors.Errorf(
+					"file %s is different in layers %s and %s, which are spawned together",
+					f.Path,
+					o.layer,
+					l.Name,
+				)
+			}
+			owners[f.Path] = owner{l.Name, f.Content}
+		}
+
+		// modules may live above the directory of the layer files, so files
+		// are nested as deep as modules go up for relative module sources to
+		// keep pointing at them without leaving the workdir
+		for _, m := range l.Modules {
+			err := pathutils.ValidateRelative(m.Path, true)
 			if err != nil {
-				return nil, errors.Wrap(err, "fail to write layer to workdir")
+				return "", errors.Wrapf(err, "invalid module file in layer %s", l.Name)
 			}
 
-			fpaths = append(fpaths, depPaths...)
+			if n := pathutils.ParentSegments(m.Path); n > depth {
+				depth = n
+			}
 		}
+	}
+	base := layerWorkdir
+	for i := 0; i < depth; i++ {
+		base = path.Join(base, "layer")
+	}
 
-		instanceName := instanceByLayer[layer.Name]
+	fpaths := make([]string, 0)
+	for _, l := range layers {
+		instanceName := instanceByLayer[l.Name]
 
-		for _, f := range layer.Files {
+		for _, f := range l.Files {
 			fpaths = append(fpaths, f.Path)
-			fpath := path.Join(layerWorkdir, f.Path)
+			fpath := path.Join(base, f.Path)
+
+			err := pathutils.CheckInside(layerWorkdir, fpath)
+			if err != nil {
+				return "", errors.Wrapf(err, "fail to write file of layer %s", l.Name)
+			}
 
-			err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+			err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
 			if err != nil {
-				return fpaths, errors.Wrap(err, "fail to MkdirAll")
+				return "", errors.Wrap(err, "fail to MkdirAll")
 			}
 
 			err = os.WriteFile(fpath, f.Content, 0644)
 			if err != nil {
-				return fpaths, errors.Wrap(err, "fail to write layer file")
+				return "", errors.Wrap(err, "fail to write layer file")
 			}
 
 			err = tags.AddTagsToFile(
 				fpath,
 				map[string]string{
-					"layerform_layer_name":     layer.Name,
+					"layerform_layer_name":     l.Name,
 					"layerform_layer_instance": instanceName,
 				},
 			)
 			if err != nil {
-				return fpaths, errors.Wrap(err, "fail to add tags")
+				return "", errors.Wrap(err, "fail to add tags")
 			}
 		}
 
-		return fpaths, nil
-	}
+		// modules can be shared by many layers so they are not tagged
+		for _, m := range l.Modules {
+			fpath := path.Join(base, m.Path)
 
-	paths, err := inner(layer)
-	if err != nil {
-		return "", errors.Wrap(err, "fail to write layer to workdir")
+			err := pathutils.CheckInside(layerWorkdir, fpath)
+			if err != nil {
+				return "", errors.Wrapf(err, "fail to write module file of layer %s", l.Name)
+			}
+
+			err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+			if err != nil {
+				return "", errors.Wrap(err, "fail to MkdirAll")
+			}
+
+			err = os.WriteFile(fpath, m.Content, 0644)
+			if err != nil {
+				return "", errors.Wrap(err, "fail to write layer module file")
+			}
+		}
 	}
 
-	commonParentPath := pathutils.FindCommonParentPath(paths)
-	dir := path.Join(layerWorkdir, commonParentPath)
+	commonParentPath := pathutils.FindCommonParentPath(fpaths)
+	dir := path.Join(base, commonParentPath)
 
 	err = writeLFVars(dir, instanceByLayer)
 	if err != nil {
@@ -122,6 +204,18 @@ func writeLFVars(dir string, instanceByDefinition map[string]string) error {
 	return os.WriteFile(path.Join(dir, fname), []byte(lfVars), 0644)
 }
 
+// TerraformPath resolves the binary that runs layer. defaults is the terraform
+// config of the context, the config of the layer is applied on top of it.
+func TerraformPath(ctx context.Context, defaults *data.TerraformConfig, layer *data.LayerDefinition) (string, error) {
+	tfpath, err := terraform.Resolve(ctx, terraform.Merge(defaults, layer.Terraform))
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to get terraform path of layer %s", layer.Name)
+	}
+
+	hclog.FromContext(ctx).Debug("Using terraform from", "layer", layer.Name, "tfpath", tfpath)
+	return tfpath, nil
+}
+
 func GetTFState(ctx context.Context, statePath string, tfpath string) (*tfjson.State, error) {
 	hclog.FromContext(ctx).Debug("Getting terraform state", "path", statePath)
 	dir := filepath.Dir(statePath)
@@ -177,6 +271,145 @@ func FindTFVarFiles() ([]string, error) {
 	return matchingFiles, nil
 }
 
+// PinnedDefinitions returns the definition instance was spawned from and a
+// backend holding the definitions its dependency instances were spawned
+// from, so commands run against the same files even after layers were
+// reconfigured. It fails when a version is no longer known, running against
+// the current definition could change resources the instance does not own.
+func PinnedDefinitions(
+	ctx context.Context,
+	definitionsBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	instance *data.LayerInstance,
+) (*data.LayerDefinition, layerdefinitions.Backend, error) {
+	logger := hclog.FromContext(ctx)
+
+	definitions := map[string]*data.LayerDefinition{}
+	var visit func(instance *data.LayerInstance) (*data.LayerDefinition, error)
+	visit = func(instance *data.LayerInstance) (*data.LayerDefinition, error) {
+		if d, ok := definitions[instance.DefinitionName]; ok {
+			return d, nil
+		}
+
+		logger.Debug("Getting definition instance was spawned from", "layer", instance.DefinitionName, "instance", instance.InstanceName)
+		definition, err := definitionsBackend.GetLayerVersion(ctx, instance.DefinitionName, instance.DefinitionSHA)
+		if errors.Is(err, layerdefinitions.ErrNotFound) {
+			return nil, errors.Wrapf(
+				err,
+				"definition instance %s of layer %s was spawned from is not known anymore, it can still be destroyed with the current definition using \"layerform kill --use-current-definition\"",
+				instance.InstanceName,
+				instance.DefinitionName,
+			)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to get definition of instance %s of layer %s", instance.InstanceName, instance.DefinitionName)
+		}
+		definitions[definition.Name] = definition
+
+		for _, dep := range definition.Dependencies {
+			depInstance, err := instancesBackend.GetInstance(ctx, dep, instance.GetDependencyInstanceName(dep))
+			if err != nil {
+				return nil, errors.Wrap(err, "fail to get instance")
+			}
+
+			if _, err := visit(depInstance); err != nil {
+				return nil, err
+			}
+		}
+
+		return definition, nil
+	}
+
+	definition, err := visit(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pinned := make([]*data.LayerDefinition, 0, len(definitions))
+	for _, d := range definitions {
+		pinned = append(pinned, d)
+	}
+
+	return definition, layerdefinitions.NewInMemoryBackend(pinned), nil
+}
+
+// CurrentDefinitions is what PinnedDefinitions falls back to when the user
+// asks for it, the current definition of the layer of instance and
+// definitionsBackend as is.
+func CurrentDefinitions(
+	ctx context.Context,
+	definitionsBackend layerdefinitions.Backend,
+	instance *data.LayerInstance,
+) (*data.LayerDefinition, layerdefinitions.Backend, error) {
+	definition, err := definitionsBackend.GetLayer(ctx, instance.DefinitionName)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to get definition of layer %s", instance.DefinitionName)
+	}
+
+	if definition == nil {
+		return nil, nil, errors.Wrapf(layerdefinitions.ErrNotFound, "layer %s has no current definition", instance.DefinitionName)
+	}
+
+	return definition, definitionsBackend, nil
+}
+
+// SaveInstance saves instance after terraform changed its resources. The
+// state only exists in the work directory until then, so it is saved even
+// when ctx was cancelled while terraform ran.
+func SaveInstance(ctx context.Context, instancesBackend layerinstances.Backend, instance *data.LayerInstance) error {
+	return instancesBackend.SaveInstance(context.WithoutCancel(ctx), instance)
+}
+
+// SaveFaultyInstance saves the state terraform left at statePath as the state
+// of instance and marks it faulty, so users can fix it later. It runs after
+// terraform failed or was interrupted, so it saves even when ctx is cancelled.
+// Nothing is saved when terraform left no state.
+func SaveFaultyInstance(
+	ctx context.Context,
+	instancesBackend layerinstances.Backend,
+	instance *data.LayerInstance,
+	statePath string,
+) error {
+	stateBytes, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "fail to read next state")
+	}
+
+	if len(stateBytes) == 0 {
+		return nil
+	}
+
+	instance.Bytes = stateBytes
+	instance.Status = data.LayerInstanceStatusFaulty
+	err = SaveInstance(ctx, instancesBackend, instance)
+	if err != nil {
+		return errors.Wrap(err, "fail to save instance of failed instance")
+	}
+
+	return nil
+}
+
+// OutdatedInstances returns the instances spawned from a definition that is
+// no longer the current definition of their layer. Instances of layers that
+// are no longer defined are orphans, not outdated.
+func OutdatedInstances(layers []*data.LayerDefinition, instances []*data.LayerInstance) []*data.LayerInstance {
+	layersByName := make(map[string]*data.LayerDefinition, len(layers))
+	for _, l := range layers {
+		layersByName[l.Name] = l
+	}
+
+	outdated := []*data.LayerInstance{}
+	for _, instance := range instances {
+		l, ok := layersByName[instance.DefinitionName]
+		if ok && !bytes.Equal(l.SHA, instance.DefinitionSHA) {
+			outdated = append(outdated, instance)
+		}
+	}
+
+	return outdated
+}
+
 func ComputeInstanceByLayer(
 	ctx context.Context,
 	definitionsBackend layerdefinitions.Backend,
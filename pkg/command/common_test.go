@@ -0,0 +1,234 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/pathutils"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+func TestPinnedDefinitions(t *testing.T) {
+	ctx := context.Background()
+	backends := newFileBackends(t, t.TempDir())
+
+	baseV1 := &data.LayerDefinition{SHA: []byte("base-v1"), Name: "base"}
+	appV1 := &data.LayerDefinition{SHA: []byte("app-v1"), Name: "app", Dependencies: []string{"base"}}
+	require.NoError(t, backends.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{baseV1, appV1}))
+
+	baseInstance := &data.LayerInstance{
+		DefinitionSHA:  baseV1.SHA,
+		DefinitionName: "base",
+		InstanceName:   "default",
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}
+	appInstance := &data.LayerInstance{
+		DefinitionSHA:  appV1.SHA,
+		DefinitionName: "app",
+		InstanceName:   "mine",
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}
+	require.NoError(t, backends.Instances.SaveInstance(ctx, baseInstance))
+	require.NoError(t, backends.Instances.SaveInstance(ctx, appInstance))
+
+	baseV2 := &data.LayerDefinition{SHA: []byte("base-v2"), Name: "base"}
+	appV2 := &data.LayerDefinition{SHA: []byte("app-v2"), Name: "app", Dependencies: []string{"base", "extra"}}
+	require.NoError(t, backends.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{baseV2, appV2}))
+
+	definition, pinned, err := PinnedDefinitions(ctx, backends.Definitions, backends.Instances, appInstance)
+	require.NoError(t, err)
+	assert.Equal(t, appV1, definition)
+
+	base, err := pinned.GetLayer(ctx, "base")
+	require.NoError(t, err)
+	assert.Equal(t, baseV1, base, "dependencies use the version their instance was spawned from")
+
+	t.Run("fails when the version is unknown", func(t *testing.T) {
+		unknown := *baseInstance
+		unknown.DefinitionSHA = []byte("unknown")
+
+		_, _, err := PinnedDefinitions(ctx, backends.Definitions, backends.Instances, &unknown)
+		assert.ErrorIs(t, err, layerdefinitions.ErrNotFound)
+		assert.ErrorContains(t, err, "--use-current-definition")
+
+		definition, current, err := CurrentDefinitions(ctx, backends.Definitions, &unknown)
+		require.NoError(t, err)
+		assert.Equal(t, baseV2, definition)
+		assert.Equal(t, backends.Definitions, current)
+	})
+}
+
+func TestWriteLayerToWorkdir_Modules(t *testing.T) {
+	ctx := context.Background()
+
+	vpc := &data.LayerDefinition{
+		Name:    "vpc",
+		Files:   []data.LayerDefinitionFile{{Path: "layers/vpc.tf", Content: []byte(`module "vpc" { source = "../../modules/vpc" }`)}},
+		Modules: []data.LayerDefinitionFile{{Path: "../modules/vpc/main.tf", Content: []byte("vpc module")}},
+	}
+	app := &data.LayerDefinition{
+		Name:         "app",
+		Files:        []data.LayerDefinitionFile{{Path: "layers/app.tf", Content: []byte("app")}},
+		Dependencies: []string{"vpc"},
+	}
+	definitions := layerdefinitions.NewInMemoryBackend([]*data.LayerDefinition{vpc, app})
+
+	workdir := t.TempDir()
+	dir, err := WriteLayerToWorkdir(ctx, definitions, workdir, app, map[string]string{"vpc": "default", "app": "default"})
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(workdir, "layer", "layers"), dir, "files are nested as deep as modules go up")
+
+	content, err := os.ReadFile(path.Join(dir, "../../modules/vpc/main.tf"))
+	require.NoError(t, err, "relative module sources point at the module files")
+	assert.Equal(t, "vpc module", string(content))
+}
+
+func TestWriteLayerToWorkdir_SameFileName(t *testing.T) {
+	ctx := context.Background()
+
+	network := &data.LayerDefinition{
+		Name:  "network",
+		Files: []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte("network")}},
+	}
+	services := &data.LayerDefinition{
+		Name:         "services",
+		Files:        []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte("services")}},
+		Dependencies: []string{"network"},
+	}
+	definitions := layerdefinitions.NewInMemoryBackend([]*data.LayerDefinition{network, services})
+
+	_, err := WriteLayerToWorkdir(ctx, definitions, t.TempDir(), services, map[string]string{"network": "default", "services": "default"})
+	assert.EqualError(t, err, "file main.tf is different in layers network and services, which are spawned together")
+}
+
+func TestWriteLayerToWorkdir_UnsafePaths(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		layer   *data.LayerDefinition
+		message string
+	}{
+		{
+			name:    "file going up",
+			layer:   &data.LayerDefinition{Name: "evil", Files: []data.LayerDefinitionFile{{Path: "../../.bashrc"}}},
+			message: "goes outside of its directory",
+		},
+		{
+			name:    "file going up after going down",
+			layer:   &data.LayerDefinition{Name: "evil", Files: []data.LayerDefinitionFile{{Path: "layers/../../../.bashrc"}}},
+			message: "goes outside of its directory",
+		},
+		{
+			name:    "absolute file",
+			layer:   &data.LayerDefinition{Name: "evil", Files: []data.LayerDefinitionFile{{Path: "/etc/cron.d/evil"}}},
+			message: "is absolute",
+		},
+		{
+			name: "absolute module",
+			layer: &data.LayerDefinition{
+				Name:    "evil",
+				Files:   []data.LayerDefinitionFile{{Path: "main.tf"}},
+				Modules: []data.LayerDefinitionFile{{Path: "/etc/cron.d/evil"}},
+			},
+			message: "is absolute",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			workdir := path.Join(parent, "workdir")
+			definitions := layerdefinitions.NewInMemoryBackend([]*data.LayerDefinition{tt.layer})
+
+			_, err := WriteLayerToWorkdir(ctx, definitions, workdir, tt.layer, map[string]string{})
+			assert.ErrorIs(t, err, pathutils.ErrUnsafePath)
+			assert.ErrorContains(t, err, tt.message)
+
+			entries, err := os.ReadDir(parent)
+			require.NoError(t, err)
+			assert.Empty(t, entries, "nothing is written")
+		})
+	}
+
+	t.Run("modules going up stay in the workdir", func(t *testing.T) {
+		parent := t.TempDir()
+		workdir := path.Join(parent, "workdir")
+		layer := &data.LayerDefinition{
+			Name:    "layer",
+			Files:   []data.LayerDefinitionFile{{Path: "main.tf"}},
+			Modules: []data.LayerDefinitionFile{{Path: "../../../.bashrc", Content: []byte("module")}},
+		}
+		definitions := layerdefinitions.NewInMemoryBackend([]*data.LayerDefinition{layer})
+
+		_, err := WriteLayerToWorkdir(ctx, definitions, workdir, layer, map[string]string{})
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(path.Join(workdir, ".bashrc"))
+		require.NoError(t, err)
+		assert.Equal(t, "module", string(content))
+
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestOutdatedInstances(t *testing.T) {
+	layers := []*data.LayerDefinition{
+		{SHA: []byte("base-v2"), Name: "base"},
+		{SHA: []byte("app-v1"), Name: "app"},
+	}
+	instances := []*data.LayerInstance{
+		{DefinitionSHA: []byte("base-v1"), DefinitionName: "base", InstanceName: "default"},
+		{DefinitionSHA: []byte("base-v2"), DefinitionName: "base", InstanceName: "other"},
+		{DefinitionSHA: []byte("app-v1"), DefinitionName: "app", InstanceName: "default"},
+		{DefinitionSHA: []byte("gone"), DefinitionName: "gone", InstanceName: "default"},
+	}
+
+	assert.Equal(t, []*data.LayerInstance{instances[0]}, OutdatedInstances(layers, instances))
+}
+
+func TestSaveFaultyInstance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	backends := newFileBackends(t, t.TempDir())
+
+	instance := &data.LayerInstance{
+		DefinitionSHA:  []byte("base"),
+		DefinitionName: "base",
+		InstanceName:   "default",
+		Bytes:          []byte("previous"),
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}
+
+	statePath := path.Join(t.TempDir(), "terraform.tfstate")
+
+	t.Run("keeps instance when there is no state", func(t *testing.T) {
+		require.NoError(t, SaveFaultyInstance(ctx, backends.Instances, instance, statePath))
+
+		_, err := backends.Instances.GetInstance(ctx, "base", "default")
+		assert.ErrorIs(t, err, layerinstances.ErrInstanceNotFound)
+	})
+
+	t.Run("saves partial state even when ctx is cancelled", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(statePath, []byte("partial"), 0644))
+		cancel()
+
+		require.NoError(t, SaveFaultyInstance(ctx, backends.Instances, instance, statePath))
+
+		saved, err := backends.Instances.GetInstance(context.Background(), "base", "default")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("partial"), saved.Bytes)
+		assert.Equal(t, data.LayerInstanceStatusFaulty, saved.Status)
+	})
+}
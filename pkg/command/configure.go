@@ -17,7 +17,7 @@ import (
 	"go.uber.org/multierr"
 
 	"github.com/ergomake/layerform/internal/layerfile"
-	"github.com/ergomake/layerform/internal/terraform"
+	"github.com/ergomake/layerform/internal/signing"
 	"github.com/ergomake/layerform/internal/tfclient"
 	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/layerdefinitions"
@@ -27,13 +27,30 @@ import (
 type configureCommand struct {
 	definitionssBackend layerdefinitions.Backend
 	instancesBackend    layerinstances.Backend
+	signer              *signing.Signer
+	tfConfig            *data.TerraformConfig
 }
 
-func NewConfigure(definitionsBackend layerdefinitions.Backend, instancesBackend layerinstances.Backend) *configureCommand {
-	return &configureCommand{definitionsBackend, instancesBackend}
+// NewConfigure returns the configure command, when signer is not nil every
+// layer is signed before being saved. tfConfig is the default terraform config
+// of layers.
+func NewConfigure(
+	definitionsBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	signer *signing.Signer,
+	tfConfig *data.TerraformConfig,
+) *configureCommand {
+	return &configureCommand{definitionsBackend, instancesBackend, signer, tfConfig}
 }
 
-func (c *configureCommand) Run(ctx context.Context, fpath string) error {
+// Run validates the layerfiles at fpaths and saves their layers as the new
+// definitions of the context, printing what changed. With dryRun nothing is
+// saved and terraform does not run, only the static checks are made. Layers
+// that still have instances are only removed when allowOrphans is set.
+//
+// With merge, the layers of the file are added to the current definitions,
+// replacing the ones with the same name, and no layer is removed.
+func (c *configureCommand) Run(ctx context.Context, fpaths []string, dryRun, allowOrphans, merge bool) error {
 	logger := hclog.FromContext(ctx)
 
 	sm := ysmrr.NewSpinnerManager(
@@ -42,15 +59,35 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 	)
 	sm.Start()
 
+	fpath := strings.Join(fpaths, "\", \"")
 	loadSpinner := sm.AddSpinner(fmt.Sprintf("Loading layer definitions from \"%s\"", fpath))
 
-	layerfile, err := layerfile.FromFile(fpath)
+	layerfile, err := layerfile.FromFiles(fpaths)
 	if err != nil {
 		loadSpinner.Error()
 		sm.Stop()
 		return errors.Wrap(err, "fail to read layerform layers definitions from file")
 	}
 
+	current, err := c.definitionssBackend.ListLayers(ctx)
+	if err != nil {
+		loadSpinner.Error()
+		sm.Stop()
+		return errors.Wrap(err, "fail to list current layer definitions")
+	}
+
+	var existing []*data.LayerDefinition
+	if merge {
+		existing = current
+	}
+
+	err = layerfile.Validate(existing)
+	if err != nil {
+		loadSpinner.Error()
+		sm.Stop()
+		return errors.Wrapf(err, "invalid layer definitions at \"%s\"", fpath)
+	}
+
 	ls, err := layerfile.ToLayers()
 	if err != nil {
 		loadSpinner.Error()
@@ -64,6 +101,18 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 		return errors.Errorf("No layers are defined at \"%s\"", fpath)
 	}
 
+	if c.signer != nil {
+		logger.Debug("Signing layer definitions", "keyID", c.signer.KeyID())
+		for _, l := range ls {
+			err := c.signer.Sign(l)
+			if err != nil {
+				loadSpinner.Error()
+				sm.Stop()
+				return errors.Wrapf(err, "fail to sign layer %s", l.Name)
+			}
+		}
+	}
+
 	loadSpinner.UpdateMessagef(
 		"%d %s loaded from \"%s\"",
 		len(ls),
@@ -72,12 +121,56 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 	)
 	loadSpinner.Complete()
 
-	tfpath, err := terraform.GetTFPath(ctx)
+	next := ls
+	if merge {
+		next = mergeLayers(current, ls)
+	}
+
+	instances, err := c.instancesBackend.ListInstances(ctx)
 	if err != nil {
 		sm.Stop()
-		return errors.Wrap(err, "fail to get terraform path")
+		return errors.Wrap(err, "fail to list layer instances")
+	}
+
+	impact := computeConfigureImpact(current, next, instances)
+
+	if dryRun {
+		sm.Stop()
+		fmt.Fprintln(os.Stdout)
+		impact.print(os.Stdout)
+		if len(impact.orphaned) > 0 && !allowOrphans {
+			fmt.Fprintln(os.Stdout, "\nRemoving layers that still have instances requires --allow-orphans.")
+		}
+		fmt.Fprintln(os.Stdout, "\nDry run, nothing was saved.")
+		return nil
+	}
+
+	if len(impact.orphaned) > 0 && !allowOrphans {
+		sm.Stop()
+		names := make([]string, len(impact.orphaned))
+		for i, instance := range impact.orphaned {
+			names[i] = fmt.Sprintf("%s of layer %s", instance.InstanceName, instance.DefinitionName)
+		}
+
+		return errors.Errorf(
+			"removed layers still have instances, kill them first or run with --allow-orphans:\n  %s",
+			strings.Join(names, "\n  "),
+		)
+	}
+
+	// every layer must have a terraform binary before any of them is
+	// validated, so unsatisfiable constraints fail early
+	var tfErr error
+	tfpaths := make([]string, len(ls))
+	for i, l := range ls {
+		tfpath, err := TerraformPath(ctx, c.tfConfig, l)
+		tfErr = multierr.Append(tfErr, err)
+		tfpaths[i] = tfpath
+	}
+	if tfErr != nil {
+		sm.Stop()
+		return tfErr
 	}
-	logger.Debug("Using terraform from", "tfpath", tfpath)
 
 	logger.Debug("Creating a temporary work directory")
 	workdir, err := os.MkdirTemp("", "")
@@ -88,11 +181,11 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 	defer os.RemoveAll(workdir)
 
 	instanceByLayer := map[string]string{}
-	for _, l := range ls {
+	for _, l := range next {
 		instanceByLayer[l.Name] = "default"
 	}
 
-	inMemoryDefinitionsBackend := layerdefinitions.NewInMemoryBackend(ls)
+	inMemoryDefinitionsBackend := layerdefinitions.NewInMemoryBackend(next)
 	var wg sync.WaitGroup
 	type validationErr struct {
 		err         error
@@ -117,7 +210,7 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 				return
 			}
 
-			tf, err := tfclient.New(tfWorkdir, tfpath)
+			tf, err := tfclient.New(tfWorkdir, tfpaths[i])
 			if err != nil {
 				s.Error()
 				errs[i] = validationErr{
@@ -195,7 +288,11 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 		return errors.Wrap(err, "fail to get layers backend location")
 	}
 
-	err = c.definitionssBackend.UpdateLayers(ctx, ls)
+	if merge {
+		err = c.definitionssBackend.UpsertLayers(ctx, ls)
+	} else {
+		err = c.definitionssBackend.UpdateLayers(ctx, ls)
+	}
 	if err != nil {
 		savingSpinner.Error()
 		sm.Stop()
@@ -211,9 +308,30 @@ func (c *configureCommand) Run(ctx context.Context, fpath string) error {
 	savingSpinner.Complete()
 	sm.Stop()
 
+	fmt.Fprintln(os.Stdout)
+	impact.print(os.Stdout)
+
 	return nil
 }
 
+// mergeLayers returns current with every layer of layers added or replacing
+// the one with the same name.
+func mergeLayers(current, layers []*data.LayerDefinition) []*data.LayerDefinition {
+	byName := map[string]bool{}
+	for _, l := range layers {
+		byName[l.Name] = true
+	}
+
+	merged := []*data.LayerDefinition{}
+	for _, l := range current {
+		if !byName[l.Name] {
+			merged = append(merged, l)
+		}
+	}
+
+	return append(merged, layers...)
+}
+
 func pluralize(s string, n int) string {
 	if n == 1 {
 		return s
@@ -0,0 +1,296 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type fileChange struct {
+	path           string
+	status         string
+	added, removed int
+}
+
+type layerChange struct {
+	name                string
+	files               []fileChange
+	dependenciesChanged bool
+	dependenciesBefore  []string
+	dependenciesAfter   []string
+	terraformBefore     string
+	terraformAfter      string
+}
+
+// configureImpact is what changes in a context when a set of definitions is
+// configured in place of the current one.
+type configureImpact struct {
+	added    []string
+	removed  []string
+	changed  []layerChange
+	outdated []*data.LayerInstance
+	// orphaned are the instances of removed layers
+	orphaned []*data.LayerInstance
+}
+
+func (i *configureImpact) empty() bool {
+	return len(i.added) == 0 && len(i.removed) == 0 && len(i.changed) == 0
+}
+
+func computeConfigureImpact(
+	current, next []*data.LayerDefinition,
+	instances []*data.LayerInstance,
+) *configureImpact {
+	impact := &configureImpact{}
+
+	currentByName := map[string]*data.LayerDefinition{}
+	for _, l := range current {
+		currentByName[l.Name] = l
+	}
+	nextByName := map[string]*data.LayerDefinition{}
+	for _, l := range next {
+		nextByName[l.Name] = l
+	}
+
+	for _, l := range next {
+		c, ok := currentByName[l.Name]
+		if !ok {
+			impact.added = append(impact.added, l.Name)
+			continue
+		}
+
+		if bytes.Equal(c.SHA, l.SHA) {
+			continue
+		}
+
+		impact.changed = append(impact.changed, layerChange{
+			name:                l.Name,
+			files:               diffFiles(allFiles(c), allFiles(l)),
+			dependenciesChanged: !sameDependencies(c.Dependencies, l.Dependencies),
+			dependenciesBefore:  c.Dependencies,
+			dependenciesAfter:   l.Dependencies,
+			terraformBefore:     describeTerraform(c.Terraform),
+			terraformAfter:      describeTerraform(l.Terraform),
+		})
+	}
+
+	for _, l := range current {
+		if _, ok := nextByName[l.Name]; !ok {
+			impact.removed = append(impact.removed, l.Name)
+		}
+	}
+
+	for _, instance := range instances {
+		l, ok := nextByName[instance.DefinitionName]
+		if !ok {
+			// instances orphaned by an earlier configure are not reported again
+			if _, removedNow := currentByName[instance.DefinitionName]; removedNow {
+				impact.orphaned = append(impact.orphaned, instance)
+			}
+		} else if !bytes.Equal(l.SHA, instance.DefinitionSHA) {
+			impact.outdated = append(impact.outdated, instance)
+		}
+	}
+
+	sort.Strings(impact.added)
+	sort.Strings(impact.removed)
+	sort.Slice(impact.changed, func(i, j int) bool {
+		return impact.changed[i].name < impact.changed[j].name
+	})
+	sortInstances(impact.outdated)
+	sortInstances(impact.orphaned)
+
+	return impact
+}
+
+func sortInstances(instances []*data.LayerInstance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instanceKey(instances[i]) < instanceKey(instances[j])
+	})
+}
+
+func sameDependencies(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allFiles returns the files of the layer followed by its module files.
+func allFiles(l *data.LayerDefinition) []data.LayerDefinitionFile {
+	files := make([]data.LayerDefinitionFile, 0, len(l.Files)+len(l.Modules))
+	files = append(files, l.Files...)
+	return append(files, l.Modules...)
+}
+
+// diffFiles compares two versions of the files of a layer by path, counting
+// the lines added and removed from files present in both.
+func diffFiles(before, after []data.LayerDefinitionFile) []fileChange {
+	beforeByPath := map[string][]byte{}
+	for _, f := range before {
+		beforeByPath[f.Path] = f.Content
+	}
+	afterByPath := map[string][]byte{}
+	for _, f := range after {
+		afterByPath[f.Path] = f.Content
+	}
+
+	changes := []fileChange{}
+	for _, f := range after {
+		content, ok := beforeByPath[f.Path]
+		if !ok {
+			changes = append(changes, fileChange{path: f.Path, status: "+", added: countLines(f.Content)})
+			continue
+		}
+
+		if bytes.Equal(content, f.Content) {
+			continue
+		}
+
+		added, removed := diffLines(content, f.Content)
+		changes = append(changes, fileChange{path: f.Path, status: "~", added: added, removed: removed})
+	}
+
+	for _, f := range before {
+		if _, ok := afterByPath[f.Path]; !ok {
+			changes = append(changes, fileChange{path: f.Path, status: "-", removed: countLines(f.Content)})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+
+	return changes
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func countLines(content []byte) int {
+	return len(splitLines(content))
+}
+
+// diffLines returns how many lines were added and removed to turn a into b,
+// based on their longest common subsequence of lines.
+func diffLines(a, b []byte) (int, int) {
+	x, y := splitLines(a), splitLines(b)
+
+	// common prefix and suffix do not change the result and are cheap to skip
+	for len(x) > 0 && len(y) > 0 && x[0] == y[0] {
+		x, y = x[1:], y[1:]
+	}
+	for len(x) > 0 && len(y) > 0 && x[len(x)-1] == y[len(y)-1] {
+		x, y = x[:len(x)-1], y[:len(y)-1]
+	}
+
+	prev := make([]int, len(y)+1)
+	row := make([]int, len(y)+1)
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			switch {
+			case x[i-1] == y[j-1]:
+				row[j] = prev[j-1] + 1
+			case prev[j] >= row[j-1]:
+				row[j] = prev[j]
+			default:
+				row[j] = row[j-1]
+			}
+		}
+		prev, row = row, prev
+	}
+	lcs := prev[len(y)]
+
+	return len(y) - lcs, len(x) - lcs
+}
+
+func describeTerraform(tf *data.TerraformConfig) string {
+	if tf == nil {
+		return "default"
+	}
+
+	parts := []string{}
+	if tf.Engine != "" {
+		parts = append(parts, tf.Engine)
+	}
+	if tf.Version != "" {
+		parts = append(parts, fmt.Sprintf("%q", tf.Version))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (i *configureImpact) print(w io.Writer) {
+	if i.empty() {
+		fmt.Fprintln(w, "No changes to layer definitions.")
+	}
+
+	for _, name := range i.added {
+		fmt.Fprintf(w, "+ layer %s\n", name)
+	}
+
+	for _, name := range i.removed {
+		fmt.Fprintf(w, "- layer %s\n", name)
+	}
+
+	for _, c := range i.changed {
+		fmt.Fprintf(w, "~ layer %s\n", c.name)
+		for _, f := range c.files {
+			switch f.status {
+			case "~":
+				fmt.Fprintf(w, "    ~ %s (+%d -%d)\n", f.path, f.added, f.removed)
+			case "+":
+				fmt.Fprintf(w, "    + %s (+%d)\n", f.path, f.added)
+			default:
+				fmt.Fprintf(w, "    - %s (-%d)\n", f.path, f.removed)
+			}
+		}
+
+		if c.dependenciesChanged {
+			fmt.Fprintf(
+				w,
+				"    dependencies: [%s] -> [%s]\n",
+				strings.Join(c.dependenciesBefore, ", "),
+				strings.Join(c.dependenciesAfter, ", "),
+			)
+		}
+
+		if c.terraformBefore != c.terraformAfter {
+			fmt.Fprintf(w, "    terraform: %s -> %s\n", c.terraformBefore, c.terraformAfter)
+		}
+	}
+
+	if len(i.outdated) > 0 {
+		fmt.Fprintf(w, "\n%d outdated %s, spawned from a definition that is no longer current:\n", len(i.outdated), pluralize("instance", len(i.outdated)))
+		for _, instance := range i.outdated {
+			fmt.Fprintf(w, "  %s of layer %s\n", instance.InstanceName, instance.DefinitionName)
+		}
+	}
+
+	if len(i.orphaned) > 0 {
+		fmt.Fprintf(w, "\n%d orphaned %s, their layer is no longer defined:\n", len(i.orphaned), pluralize("instance", len(i.orphaned)))
+		for _, instance := range i.orphaned {
+			fmt.Fprintf(w, "  %s of layer %s\n", instance.InstanceName, instance.DefinitionName)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name           string
+		a, b           string
+		added, removed int
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 0, 0},
+		{"appended", "a\n", "a\nb\nc\n", 2, 0},
+		{"removed", "a\nb\nc\n", "a\nc\n", 0, 1},
+		{"replaced", "a\nb\nc\n", "a\nx\nc\n", 1, 1},
+		{"from empty", "", "a\nb", 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffLines([]byte(tt.a), []byte(tt.b))
+			assert.Equal(t, tt.added, added)
+			assert.Equal(t, tt.removed, removed)
+		})
+	}
+}
+
+func TestComputeConfigureImpact(t *testing.T) {
+	current := []*data.LayerDefinition{
+		{
+			SHA:  []byte("base-v1"),
+			Name: "base",
+			Files: []data.LayerDefinitionFile{
+				{Path: "base/main.tf", Content: []byte("a\nb\n")},
+				{Path: "base/old.tf", Content: []byte("old\n")},
+			},
+		},
+		{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}},
+		{SHA: []byte("legacy"), Name: "legacy"},
+	}
+	next := []*data.LayerDefinition{
+		{
+			SHA:  []byte("base-v2"),
+			Name: "base",
+			Files: []data.LayerDefinitionFile{
+				{Path: "base/main.tf", Content: []byte("a\nc\nd\n")},
+				{Path: "base/new.tf", Content: []byte("new\n")},
+			},
+			Dependencies: []string{"network"},
+			Terraform:    &data.TerraformConfig{Engine: "tofu", Version: ">= 1.6"},
+		},
+		{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}},
+		{SHA: []byte("network"), Name: "network"},
+	}
+	instances := []*data.LayerInstance{
+		{DefinitionSHA: []byte("base-v1"), DefinitionName: "base", InstanceName: "default"},
+		{DefinitionSHA: []byte("app"), DefinitionName: "app", InstanceName: "default"},
+		{DefinitionSHA: []byte("legacy"), DefinitionName: "legacy", InstanceName: "default"},
+		{DefinitionSHA: []byte("gone"), DefinitionName: "gone", InstanceName: "default"},
+	}
+
+	impact := computeConfigureImpact(current, next, instances)
+
+	assert.Equal(t, []string{"network"}, impact.added)
+	assert.Equal(t, []string{"legacy"}, impact.removed)
+	require.Len(t, impact.changed, 1)
+	assert.Equal(t, layerChange{
+		name: "base",
+		files: []fileChange{
+			{path: "base/main.tf", status: "~", added: 2, removed: 1},
+			{path: "base/new.tf", status: "+", added: 1},
+			{path: "base/old.tf", status: "-", removed: 1},
+		},
+		dependenciesChanged: true,
+		dependenciesAfter:   []string{"network"},
+		terraformBefore:     "default",
+		terraformAfter:      `tofu ">= 1.6"`,
+	}, impact.changed[0])
+	assert.Equal(t, []*data.LayerInstance{instances[0]}, impact.outdated)
+	assert.Equal(t, []*data.LayerInstance{instances[2]}, impact.orphaned, "instances orphaned before are left alone")
+
+	var out bytes.Buffer
+	impact.print(&out)
+	assert.Equal(t, `+ layer network
+- layer legacy
+~ layer base
+    ~ base/main.tf (+2 -1)
+    + base/new.tf (+1)
+    - base/old.tf (-1)
+    dependencies: [] -> [network]
+    terraform: default -> tofu ">= 1.6"
+
+1 outdated instance, spawned from a definition that is no longer current:
+  default of layer base
+
+1 orphaned instance, their layer is no longer defined:
+  default of layer legacy
+`, out.String())
+}
+
+func TestConfigure_ImpactChecks(t *testing.T) {
+	ctx := context.Background()
+	backendsDir := t.TempDir()
+	backends := newFileBackends(t, backendsDir)
+
+	legacy := &data.LayerDefinition{SHA: []byte("legacy"), Name: "legacy"}
+	require.NoError(t, backends.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{legacy}))
+	require.NoError(t, backends.Instances.SaveInstance(ctx, &data.LayerInstance{
+		DefinitionSHA:  legacy.SHA,
+		DefinitionName: "legacy",
+		InstanceName:   "default",
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.tf"), []byte(""), 0644))
+	fpath := path.Join(dir, "layerform.json")
+	require.NoError(t, os.WriteFile(fpath, []byte(`{"layers": [{"name": "app", "files": ["main.tf"]}]}`), 0644))
+
+	configure := NewConfigure(backends.Definitions, backends.Instances, nil, nil)
+
+	t.Run("dry run saves nothing", func(t *testing.T) {
+		err := configure.Run(ctx, []string{fpath}, true, false, false)
+		require.NoError(t, err)
+
+		layers, err := backends.Definitions.ListLayers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*data.LayerDefinition{legacy}, layers)
+	})
+
+	t.Run("refuses to orphan instances", func(t *testing.T) {
+		err := configure.Run(ctx, []string{fpath}, false, false, false)
+		assert.ErrorContains(t, err, "--allow-orphans")
+		assert.ErrorContains(t, err, "default of layer legacy")
+
+		layers, err := backends.Definitions.ListLayers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*data.LayerDefinition{legacy}, layers)
+	})
+	t.Run("merge keeps current layers", func(t *testing.T) {
+		fpath := path.Join(dir, "merge.json")
+		content := `{"layers": [{"name": "app", "files": ["main.tf"], "dependencies": ["legacy"]}]}`
+		require.NoError(t, os.WriteFile(fpath, []byte(content), 0644))
+
+		err := configure.Run(ctx, []string{fpath}, true, false, false)
+		assert.ErrorContains(t, err, "layer app depends on legacy which is not defined")
+
+		err = configure.Run(ctx, []string{fpath}, true, false, true)
+		assert.NoError(t, err, "current layers are valid dependencies when merging")
+
+		app := &data.LayerDefinition{SHA: []byte("app"), Name: "app"}
+		assert.Equal(t, []*data.LayerDefinition{legacy, app}, mergeLayers([]*data.LayerDefinition{legacy}, []*data.LayerDefinition{app}))
+	})
+
+	t.Run("merge saves every layer of the file", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+
+		fpath := path.Join(dir, "merge.json")
+		content := `{"layers": [
+			{"name": "app", "files": ["main.tf"], "dependencies": ["legacy"]},
+			{"name": "worker", "files": ["main.tf"], "dependencies": ["app"]}
+		]}`
+		require.NoError(t, os.WriteFile(fpath, []byte(content), 0644))
+
+		tfConfig := &data.TerraformConfig{Path: fakeTerraform(t)}
+		err := NewConfigure(backends.Definitions, backends.Instances, nil, tfConfig).Run(ctx, []string{fpath}, false, false, true)
+		require.NoError(t, err)
+
+		definitions := newFileBackends(t, backendsDir).Definitions
+		layers, err := definitions.ListLayers(ctx)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, l := range layers {
+			names = append(names, l.Name)
+		}
+		assert.ElementsMatch(t, []string{"legacy", "app", "worker"}, names)
+
+		saved, err := definitions.GetLayer(ctx, "legacy")
+		require.NoError(t, err)
+		assert.Equal(t, legacy, saved, "current layers are left untouched")
+	})
+}
+
+// fakeTerraform writes a terraform binary that validates every layer.
+func fakeTerraform(t *testing.T) string {
+	fpath := path.Join(t.TempDir(), "terraform")
+	script := `#!/bin/sh
+case "$1" in
+version) echo '{"terraform_version": "1.5.5"}' ;;
+init) mkdir -p .terraform && touch .terraform.lock.hcl ;;
+validate) echo '{"format_version": "1.0", "valid": true, "error_count": 0, "warning_count": 0, "diagnostics": []}' ;;
+esac
+`
+	require.NoError(t, os.WriteFile(fpath, []byte(script), 0755))
+
+	return fpath
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+type deleteDefinitionCommand struct {
+	definitionsBackend layerdefinitions.Backend
+	instancesBackend   layerinstances.Backend
+}
+
+func NewDeleteDefinition(definitionsBackend layerdefinitions.Backend, instancesBackend layerinstances.Backend) *deleteDefinitionCommand {
+	return &deleteDefinitionCommand{definitionsBackend, instancesBackend}
+}
+
+// Run removes the definition of layer name, leaving every other definition
+// untouched. Layers that other layers depend on are never removed, and
+// layers that still have instances are only removed when allowOrphans is set.
+func (c *deleteDefinitionCommand) Run(ctx context.Context, name string, allowOrphans bool) error {
+	layers, err := c.definitionsBackend.ListLayers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fail to list layer definitions")
+	}
+
+	found := false
+	dependants := []string{}
+	for _, l := range layers {
+		if l.Name == name {
+			found = true
+			continue
+		}
+
+		for _, d := range l.Dependencies {
+			if d == name {
+				dependants = append(dependants, l.Name)
+				break
+			}
+		}
+	}
+
+	if !found {
+		return errors.Wrapf(layerdefinitions.ErrNotFound, "layer %s not found", name)
+	}
+
+	if len(dependants) > 0 {
+		sort.Strings(dependants)
+		return errors.Errorf(
+			"layer %s can't be deleted because other layers depend on it: %s",
+			name,
+			strings.Join(dependants, ", "),
+		)
+	}
+
+	instances, err := c.instancesBackend.ListInstancesByLayer(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to list instances of layer %s", name)
+	}
+
+	if len(instances) > 0 && !allowOrphans {
+		sortInstances(instances)
+		names := make([]string, len(instances))
+		for i, instance := range instances {
+			names[i] = instance.InstanceName
+		}
+
+		return errors.Errorf(
+			"layer %s still has instances, kill them first or run with --allow-orphans:\n  %s",
+			name,
+			strings.Join(names, "\n  "),
+		)
+	}
+
+	err = c.definitionsBackend.DeleteLayer(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to delete layer %s", name)
+	}
+
+	fmt.Fprintf(os.Stdout, "Layer %s deleted.\n", name)
+	if len(instances) > 0 {
+		fmt.Fprintf(
+			os.Stdout,
+			"%d orphaned %s can still be killed.\n",
+			len(instances),
+			pluralize("instance", len(instances)),
+		)
+	}
+
+	return nil
+}
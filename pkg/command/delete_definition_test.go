@@ -0,0 +1,49 @@
+package command
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+)
+
+func TestDeleteDefinition(t *testing.T) {
+	ctx := context.Background()
+	backends := newFileBackends(t, t.TempDir())
+
+	base := &data.LayerDefinition{SHA: []byte("base"), Name: "base"}
+	app := &data.LayerDefinition{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}}
+	require.NoError(t, backends.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{base, app}))
+	require.NoError(t, backends.Instances.SaveInstance(ctx, &data.LayerInstance{
+		DefinitionSHA:  app.SHA,
+		DefinitionName: "app",
+		InstanceName:   "default",
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}))
+
+	deleteDefinition := NewDeleteDefinition(backends.Definitions, backends.Instances)
+
+	err := deleteDefinition.Run(ctx, "missing", false)
+	assert.ErrorIs(t, err, layerdefinitions.ErrNotFound)
+
+	err = deleteDefinition.Run(ctx, "base", true)
+	assert.ErrorContains(t, err, "other layers depend on it: app")
+
+	err = deleteDefinition.Run(ctx, "app", false)
+	assert.ErrorContains(t, err, "--allow-orphans")
+
+	err = deleteDefinition.Run(ctx, "app", true)
+	require.NoError(t, err)
+
+	layers, err := backends.Definitions.ListLayers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*data.LayerDefinition{base}, layers)
+
+	err = deleteDefinition.Run(ctx, "base", false)
+	require.NoError(t, err, "layers whose dependants were deleted can be deleted")
+}
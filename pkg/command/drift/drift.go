@@ -0,0 +1,79 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type Drift interface {
+	// Run checks the instances selected by definitionName and instanceName,
+	// every instance is checked when both are empty. Instances that could not
+	// be checked have the error in their report.
+	Run(
+		ctx context.Context,
+		definitionName, instanceName string,
+		vars []string,
+	) ([]*Report, error)
+}
+
+type Report struct {
+	Instance *data.LayerInstance
+	Drift    *command.PlanSummary
+	Err      error
+}
+
+func (r *Report) Drifted() bool {
+	return r.Err == nil && !r.Drift.Empty()
+}
+
+// Print writes the resources changed outside terraform of every drifted
+// instance, the errors of instances that could not be checked and a total.
+func Print(w io.Writer, reports []*Report) {
+	if len(reports) == 0 {
+		fmt.Fprintln(w, "No instances to check.")
+		return
+	}
+
+	drifted := 0
+	failed := 0
+	for _, r := range reports {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(
+				w,
+				"Instance \"%s\" of layer \"%s\" could not be checked: %s\n\n",
+				r.Instance.InstanceName,
+				r.Instance.DefinitionName,
+				r.Err,
+			)
+		case r.Drifted():
+			drifted++
+			fmt.Fprintf(
+				w,
+				"Instance \"%s\" of layer \"%s\" changed outside terraform:\n",
+				r.Instance.InstanceName,
+				r.Instance.DefinitionName,
+			)
+			for _, c := range r.Drift.Changes {
+				fmt.Fprintf(w, "  %3s %s\n", c.Action, c.Address)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	instances := "instances"
+	if len(reports) == 1 {
+		instances = "instance"
+	}
+
+	fmt.Fprintf(w, "Checked %d %s, %d drifted", len(reports), instances, drifted)
+	if failed > 0 {
+		fmt.Fprintf(w, ", %d could not be checked", failed)
+	}
+	fmt.Fprintln(w, ".")
+}
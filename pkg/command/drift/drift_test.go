@@ -0,0 +1,92 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+func TestPrint(t *testing.T) {
+	base := &data.LayerInstance{DefinitionName: "base", InstanceName: "default"}
+	app := &data.LayerInstance{DefinitionName: "app", InstanceName: "default"}
+	other := &data.LayerInstance{DefinitionName: "app", InstanceName: "other"}
+
+	reports := []*Report{
+		{Instance: base, Drift: &command.PlanSummary{Changes: []command.ResourceChange{
+			{Address: "aws_iam_role.app", Action: "~"},
+			{Address: "aws_sqs_queue.jobs", Action: "-"},
+		}}},
+		{Instance: app, Drift: &command.PlanSummary{Changes: []command.ResourceChange{}}},
+		{Instance: other, Err: errors.New("fail to terraform init")},
+	}
+
+	assert.True(t, reports[0].Drifted())
+	assert.False(t, reports[1].Drifted())
+	assert.False(t, reports[2].Drifted())
+
+	var out bytes.Buffer
+	Print(&out, reports)
+	assert.Equal(t, `Instance "default" of layer "base" changed outside terraform:
+    ~ aws_iam_role.app
+    - aws_sqs_queue.jobs
+
+Instance "other" of layer "app" could not be checked: fail to terraform init
+
+Checked 3 instances, 1 drifted, 1 could not be checked.
+`, out.String())
+
+	out.Reset()
+	Print(&out, reports[1:2])
+	assert.Equal(t, "Checked 1 instance, 0 drifted.\n", out.String())
+}
+
+func TestSelectInstances(t *testing.T) {
+	ctx := context.Background()
+
+	instancesBackend, err := layerinstances.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(t.TempDir(), "state"), 0))
+	require.NoError(t, err)
+
+	for _, i := range []*data.LayerInstance{
+		{DefinitionName: "base", InstanceName: "b"},
+		{DefinitionName: "app", InstanceName: "default"},
+		{DefinitionName: "base", InstanceName: "a"},
+	} {
+		i.Status = data.LayerInstanceStatusAlive
+		i.Version = data.CURRENT_INSTANCE_VERSION
+		require.NoError(t, instancesBackend.SaveInstance(ctx, i))
+	}
+
+	c := NewLocal(nil, instancesBackend, nil, nil)
+	names := func(instances []*data.LayerInstance) []string {
+		result := []string{}
+		for _, i := range instances {
+			result = append(result, i.DefinitionName+"/"+i.InstanceName)
+		}
+		return result
+	}
+
+	all, err := c.selectInstances(ctx, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app/default", "base/a", "base/b"}, names(all))
+
+	byLayer, err := c.selectInstances(ctx, "base", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base/a", "base/b"}, names(byLayer))
+
+	one, err := c.selectInstances(ctx, "base", "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base/b"}, names(one))
+
+	_, err = c.selectInstances(ctx, "base", "c")
+	assert.EqualError(t, err, "instance c not found for layer base")
+}
@@ -0,0 +1,226 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/chelnak/ysmrr"
+	"github.com/chelnak/ysmrr/pkg/animations"
+	"github.com/chelnak/ysmrr/pkg/colors"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/tfclient"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/envvars"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+type localDriftCommand struct {
+	definitionsBackend layerdefinitions.Backend
+	instancesBackend   layerinstances.Backend
+	envVarsBackend     envvars.Backend
+	tfConfig           *data.TerraformConfig
+}
+
+var _ Drift = &localDriftCommand{}
+
+// NewLocal returns a drift command that runs terraform locally, tfConfig
+// is the default terraform config of layers.
+func NewLocal(
+	definitionsBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	envVarsBackend envvars.Backend,
+	tfConfig *data.TerraformConfig,
+) *localDriftCommand {
+	return &localDriftCommand{definitionsBackend, instancesBackend, envVarsBackend, tfConfig}
+}
+
+func (c *localDriftCommand) Run(
+	ctx context.Context,
+	definitionName, instanceName string,
+	vars []string,
+) ([]*Report, error) {
+	logger := hclog.FromContext(ctx)
+
+	instances, err := c.selectInstances(ctx, definitionName, instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	envVars, err := c.envVarsBackend.ListVariables(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list environment variables")
+	}
+
+	for _, envVar := range envVars {
+		err := os.Setenv(envVar.Name, envVar.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to set %s environment variable", envVar.Name)
+		}
+	}
+
+	logger.Debug("Looking for variable definitions in .tfvars files")
+	varFiles, err := command.FindTFVarFiles()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to find .tfvars files")
+	}
+	logger.Debug(fmt.Sprintf("Found %d var files", len(varFiles)), "varFiles", varFiles)
+
+	planOptions := []tfexec.PlanOption{}
+	for _, vf := range varFiles {
+		planOptions = append(planOptions, tfexec.VarFile(vf))
+	}
+	for _, v := range vars {
+		planOptions = append(planOptions, tfexec.Var(v))
+	}
+
+	sm := ysmrr.NewSpinnerManager(
+		ysmrr.WithAnimation(animations.Dots),
+		ysmrr.WithSpinnerColor(colors.FgHiBlue),
+	)
+	sm.Start()
+
+	reports := make([]*Report, 0, len(instances))
+	for _, instance := range instances {
+		if ctx.Err() != nil {
+			sm.Stop()
+			return nil, errors.Wrap(ctx.Err(), "drift check interrupted")
+		}
+
+		s := sm.AddSpinner(
+			fmt.Sprintf(
+				"Checking instance \"%s\" of layer \"%s\" for drift",
+				instance.InstanceName,
+				instance.DefinitionName,
+			),
+		)
+
+		summary, err := c.check(ctx, instance, planOptions)
+		if err != nil {
+			logger.Debug("Fail to check instance for drift", "layer", instance.DefinitionName, "instance", instance.InstanceName, "err", err)
+			s.Error()
+		} else {
+			s.Complete()
+		}
+
+		reports = append(reports, &Report{Instance: instance, Drift: summary, Err: err})
+	}
+
+	sm.Stop()
+
+	return reports, nil
+}
+
+func (c *localDriftCommand) selectInstances(
+	ctx context.Context,
+	definitionName, instanceName string,
+) ([]*data.LayerInstance, error) {
+	if instanceName != "" {
+		instance, err := c.instancesBackend.GetInstance(ctx, definitionName, instanceName)
+		if err != nil {
+			if errors.Is(err, layerinstances.ErrInstanceNotFound) {
+				return nil, errors.Errorf(
+					"instance %s not found for layer %s",
+					instanceName,
+					definitionName,
+				)
+			}
+
+			return nil, errors.Wrap(err, "fail to get layer instance")
+		}
+
+		return []*data.LayerInstance{instance}, nil
+	}
+
+	var instances []*data.LayerInstance
+	var err error
+	if definitionName != "" {
+		instances, err = c.instancesBackend.ListInstancesByLayer(ctx, definitionName)
+	} else {
+		instances, err = c.instancesBackend.ListInstances(ctx)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list layer instances")
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].DefinitionName != instances[j].DefinitionName {
+			return instances[i].DefinitionName < instances[j].DefinitionName
+		}
+
+		return instances[i].InstanceName < instances[j].InstanceName
+	})
+
+	return instances, nil
+}
+
+// check rebuilds the work directory of instance the same way refresh does and
+// runs a refresh-only plan on it, nothing is applied nor saved.
+func (c *localDriftCommand) check(
+	ctx context.Context,
+	instance *data.LayerInstance,
+	planOptions []tfexec.PlanOption,
+) (*command.PlanSummary, error) {
+	logger := hclog.FromContext(ctx)
+
+	definition, definitions, err := command.PinnedDefinitions(ctx, c.definitionsBackend, c.instancesBackend, instance)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get layer definition")
+	}
+
+	tfpath, err := command.TerraformPath(ctx, c.tfConfig, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Creating a temporary work directory")
+	workdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to create work directory")
+	}
+	defer os.RemoveAll(workdir)
+
+	layerDir := path.Join(workdir, instance.DefinitionName)
+
+	instanceByLayer, err := command.ComputeInstanceByLayer(
+		ctx,
+		definitions,
+		c.instancesBackend,
+		definition,
+		instance,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to compute instance by layer instance")
+	}
+
+	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, definitions, layerDir, definition, instanceByLayer)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to write layer to work directory")
+	}
+
+	statePath := path.Join(layerWorkdir, "terraform.tfstate")
+	err = os.WriteFile(statePath, instance.Bytes, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to write terraform state to work directory")
+	}
+
+	tf, err := tfclient.New(layerWorkdir, tfpath)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get terraform client")
+	}
+
+	err = tf.Init(ctx, definition.SHA)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to terraform init")
+	}
+
+	planPath := path.Join(layerWorkdir, "layerform.tfplan")
+	return command.Drift(ctx, tf, planPath, planOptions...)
+}
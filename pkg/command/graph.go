@@ -0,0 +1,85 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DependencyError is the error of graph nodes that did not run because a
+// node they depend on failed.
+type DependencyError struct {
+	Node string
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("dependency %s failed", e.Node)
+}
+
+// RunGraph calls run for every node once all the nodes it depends on
+// succeeded, at most parallelism nodes run at the same time. Nodes with a
+// failed dependency are not run and fail with a *DependencyError instead,
+// and nodes that did not start before ctx is cancelled fail with ctx.Err().
+// deps maps nodes to the nodes they depend on, it must not have cycles and
+// dependencies that are not in nodes are ignored. The returned map has the
+// error of every node, nil for the ones that succeeded.
+func RunGraph(
+	ctx context.Context,
+	nodes []string,
+	deps map[string][]string,
+	parallelism int,
+	run func(ctx context.Context, node string) error,
+) map[string]error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	done := make(map[string]chan struct{}, len(nodes))
+	for _, n := range nodes {
+		done[n] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	errs := make(map[string]error, len(nodes))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			defer close(done[n])
+
+			var err error
+			for _, d := range deps[n] {
+				ch, ok := done[d]
+				if !ok {
+					continue
+				}
+				<-ch
+
+				mu.Lock()
+				failed := errs[d] != nil
+				mu.Unlock()
+				if failed && err == nil {
+					err = &DependencyError{Node: d}
+				}
+			}
+
+			if err == nil {
+				sem <- struct{}{}
+				if err = ctx.Err(); err == nil {
+					err = run(ctx, n)
+				}
+				<-sem
+			}
+
+			mu.Lock()
+			errs[n] = err
+			mu.Unlock()
+		}(n)
+	}
+
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,106 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunGraph(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("runs dependencies first", func(t *testing.T) {
+		var mu sync.Mutex
+		order := []string{}
+		deps := map[string][]string{
+			"app":     {"eks", "db"},
+			"db":      {"network"},
+			"eks":     {"network"},
+			"network": {"outside"},
+		}
+
+		errs := RunGraph(ctx, []string{"app", "db", "eks", "network"}, deps, 4, func(_ context.Context, node string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, node)
+			return nil
+		})
+
+		assert.Equal(t, map[string]error{"app": nil, "db": nil, "eks": nil, "network": nil}, errs)
+		assert.Len(t, order, 4)
+		assert.Equal(t, "network", order[0])
+		assert.Equal(t, "app", order[3])
+	})
+
+	t.Run("respects parallelism", func(t *testing.T) {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		nodes := []string{"a", "b", "c", "d", "e", "f"}
+
+		RunGraph(ctx, nodes, nil, 2, func(_ context.Context, _ string) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+
+		assert.Equal(t, 2, maxRunning)
+	})
+
+	t.Run("skips dependants of failed nodes", func(t *testing.T) {
+		fail := errors.New("fail to apply")
+		deps := map[string][]string{
+			"app": {"eks"},
+			"ui":  {"app"},
+		}
+
+		ran := map[string]bool{}
+		var mu sync.Mutex
+		errs := RunGraph(ctx, []string{"ui", "app", "eks", "db"}, deps, 1, func(_ context.Context, node string) error {
+			mu.Lock()
+			ran[node] = true
+			mu.Unlock()
+
+			if node == "eks" {
+				return fail
+			}
+			return nil
+		})
+
+		assert.Equal(t, fail, errs["eks"])
+		assert.Equal(t, &DependencyError{Node: "eks"}, errs["app"])
+		assert.Equal(t, &DependencyError{Node: "app"}, errs["ui"])
+		assert.NoError(t, errs["db"])
+		assert.Equal(t, map[string]bool{"eks": true, "db": true}, ran)
+	})
+
+	t.Run("does not start nodes after ctx is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		deps := map[string][]string{"app": {"eks"}}
+		ran := []string{}
+		errs := RunGraph(ctx, []string{"app", "eks"}, deps, 1, func(_ context.Context, node string) error {
+			ran = append(ran, node)
+			cancel()
+			return nil
+		})
+
+		assert.NoError(t, errs["eks"])
+		assert.Equal(t, context.Canceled, errs["app"])
+		assert.Equal(t, []string{"eks"}, ran)
+	})
+}
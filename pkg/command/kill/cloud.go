@@ -35,12 +35,15 @@ func NewCloud(client *cloud.HTTPClient) *cloudKillCommand {
 	return &cloudKillCommand{client, definitionsBackend, instancesBackend}
 }
 
+// Run kills the instance remotely, cloud contexts always destroy instances
+// with the current definition of their layer so useCurrentDefinition is
+// ignored.
 func (e *cloudKillCommand) Run(
 	ctx context.Context,
 	definitionName, instanceName string,
 	autoApprove bool,
 	vars []string,
-	force bool,
+	force, useCurrentDefinition bool,
 ) error {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Killing instance remotely")
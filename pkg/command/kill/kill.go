@@ -5,5 +5,8 @@ import (
 )
 
 type Kill interface {
-	Run(ctx context.Context, definitionName, instanceName string, autoApprove bool, vars []string, force bool) error
+	// Run destroys the instance with the definition it was spawned from, or
+	// with the current definition of the layer when useCurrentDefinition is
+	// set, which is the only way to kill instances whose version was lost.
+	Run(ctx context.Context, definitionName, instanceName string, autoApprove bool, vars []string, force, useCurrentDefinition bool) error
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strings"
 
 	"github.com/chelnak/ysmrr"
 	"github.com/chelnak/ysmrr/pkg/animations"
@@ -14,7 +13,6 @@ import (
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"github.com/pkg/errors"
 
-	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/tfclient"
 	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
@@ -27,16 +25,20 @@ type localKillCommand struct {
 	definitionsBackend layerdefinitions.Backend
 	instancesBackend   layerinstances.Backend
 	envVarsBackend     envvars.Backend
+	tfConfig           *data.TerraformConfig
 }
 
 var _ Kill = &localKillCommand{}
 
+// NewLocal returns a kill command that runs terraform locally, tfConfig is
+// the default terraform config of layers.
 func NewLocal(
 	definitionsBackend layerdefinitions.Backend,
 	instancesBackend layerinstances.Backend,
 	envVarsBackend envvars.Backend,
+	tfConfig *data.TerraformConfig,
 ) *localKillCommand {
-	return &localKillCommand{definitionsBackend, instancesBackend, envVarsBackend}
+	return &localKillCommand{definitionsBackend, instancesBackend, envVarsBackend, tfConfig}
 }
 
 func (c *localKillCommand) Run(
@@ -44,32 +46,37 @@ func (c *localKillCommand) Run(
 	layerName, instanceName string,
 	autoApprove bool,
 	vars []string,
-	force bool,
+	force, useCurrentDefinition bool,
 ) error {
 	logger := hclog.FromContext(ctx)
 
-	layer, err := c.definitionsBackend.GetLayer(ctx, layerName)
-	if err != nil {
-		return errors.Wrap(err, "fail to get layer")
-	}
-
-	if layer == nil {
-		return errors.New("layer not found")
-	}
-
-	instance, err := c.instancesBackend.GetInstance(ctx, layer.Name, instanceName)
+	instance, err := c.instancesBackend.GetInstance(ctx, layerName, instanceName)
 	if err != nil {
 		if errors.Is(err, layerinstances.ErrInstanceNotFound) {
 			return errors.Errorf(
 				"instance %s not found for layer %s",
 				instanceName,
-				layer.Name,
+				layerName,
 			)
 		}
 
 		return errors.Wrap(err, "fail to get layer instance")
 	}
 
+	// the instance is destroyed with the definition it was spawned from, which
+	// still works when the layer was changed or removed since
+	var layer *data.LayerDefinition
+	var definitions layerdefinitions.Backend
+	if useCurrentDefinition {
+		logger.Warn("Destroying instance with the current definition of its layer", "layer", layerName, "instance", instanceName)
+		layer, definitions, err = command.CurrentDefinitions(ctx, c.definitionsBackend, instance)
+	} else {
+		layer, definitions, err = command.PinnedDefinitions(ctx, c.definitionsBackend, c.instancesBackend, instance)
+	}
+	if err != nil {
+		return errors.Wrap(err, "fail to get layer")
+	}
+
 	sm := ysmrr.NewSpinnerManager(
 		ysmrr.WithAnimation(animations.Dots),
 		ysmrr.WithSpinnerColor(colors.FgHiBlue),
@@ -106,7 +113,7 @@ func (c *localKillCommand) Run(
 	if force {
 		autoApprove = true
 		for _, d := range dependants {
-			err = c.Run(ctx, d.DefinitionName, d.InstanceName, autoApprove, vars, force)
+			err = c.Run(ctx, d.DefinitionName, d.InstanceName, autoApprove, vars, force, useCurrentDefinition)
 			if err != nil {
 				return errors.Wrapf(err, "fail to kill dependant %s=%s", d.DefinitionName, d.InstanceName)
 			}
@@ -129,14 +136,12 @@ func (c *localKillCommand) Run(
 		}
 	}
 
-	tfpath, err := terraform.GetTFPath(ctx)
+	tfpath, err := command.TerraformPath(ctx, c.tfConfig, layer)
 	if err != nil {
 		s.Error()
 		sm.Stop()
-		return errors.Wrap(err, "fail to get terraform path")
+		return err
 	}
-	logger.Debug("Using terraform from", "tfpath", tfpath)
-	logger.Debug("Found terraform installation", "tfpath", tfpath)
 
 	logger.Debug("Creating a temporary work directory")
 	workdir, err := os.MkdirTemp("", "")
@@ -148,7 +153,7 @@ func (c *localKillCommand) Run(
 	defer os.RemoveAll(workdir)
 
 	layerDir := path.Join(workdir, layerName)
-	layerAddrs, layerDir, err := c.getLayerAddresses(ctx, layer, instance, layerDir, tfpath)
+	layerAddrs, layerDir, err := c.getLayerAddresses(ctx, definitions, layer, instance, layerDir)
 	if err != nil {
 		s.Error()
 		sm.Stop()
@@ -161,7 +166,7 @@ func (c *localKillCommand) Run(
 	}
 
 	for _, dep := range layer.Dependencies {
-		depLayer, err := c.definitionsBackend.GetLayer(ctx, dep)
+		depLayer, err := definitions.GetLayer(ctx, dep)
 		if err != nil {
 			s.Error()
 			sm.Stop()
@@ -171,7 +176,7 @@ func (c *localKillCommand) Run(
 		if depLayer == nil {
 			s.Error()
 			sm.Stop()
-			return errors.Wrap(err, "dependency layer not found")
+			return errors.Errorf("dependency layer %s not found", dep)
 		}
 
 		depInstance, err := c.instancesBackend.GetInstance(ctx, depLayer.Name, instance.GetDependencyInstanceName(dep))
@@ -182,7 +187,7 @@ func (c *localKillCommand) Run(
 		}
 
 		depDir := path.Join(workdir, dep)
-		depAddrs, _, err := c.getLayerAddresses(ctx, depLayer, depInstance, depDir, tfpath)
+		depAddrs, _, err := c.getLayerAddresses(ctx, definitions, depLayer, depInstance, depDir)
 		if err != nil {
 			s.Error()
 			sm.Stop()
@@ -230,14 +235,12 @@ func (c *localKillCommand) Run(
 	sm.Stop()
 
 	if !autoApprove {
-		var answer string
-		fmt.Print("Are you sure? This can't be undone. [yes/no]: ")
-		_, err = fmt.Scan(&answer)
+		approved, err := command.Confirm(ctx, "Are you sure? This can't be undone.")
 		if err != nil {
-			return errors.Wrap(err, "fail to read asnwer")
+			return err
 		}
 
-		if strings.ToLower(strings.TrimSpace(answer)) != "yes" {
+		if !approved {
 			return nil
 		}
 	}
@@ -260,10 +263,20 @@ func (c *localKillCommand) Run(
 	if err != nil {
 		s.Error()
 		sm.Stop()
+
+		// resources destroyed before the failure are gone from the state,
+		// which is saved as faulty so killing again picks up from there
+		saveErr := command.SaveFaultyInstance(ctx, c.instancesBackend, instance, path.Join(layerDir, "terraform.tfstate"))
+		if saveErr != nil {
+			return saveErr
+		}
+
 		return errors.Wrap(err, "fail to terraform destroy")
 	}
 
-	err = c.instancesBackend.DeleteInstance(ctx, layerName, instanceName)
+	// the resources are gone, so the instance is deleted even when
+	// interrupted right after terraform finished
+	err = c.instancesBackend.DeleteInstance(context.WithoutCancel(ctx), layerName, instanceName)
 	if err != nil {
 		s.Error()
 		sm.Stop()
@@ -278,19 +291,25 @@ func (c *localKillCommand) Run(
 
 func (c *localKillCommand) getLayerAddresses(
 	ctx context.Context,
+	definitions layerdefinitions.Backend,
 	layer *data.LayerDefinition,
 	instance *data.LayerInstance,
-	layerDir, tfpath string,
+	layerDir string,
 ) ([]string, string, error) {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Getting layer addresses", "layer", layer.Name, "instance", instance.InstanceName)
 
-	instanceByLayer, err := command.ComputeInstanceByLayer(ctx, c.definitionsBackend, c.instancesBackend, layer, instance)
+	tfpath, err := command.TerraformPath(ctx, c.tfConfig, layer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	instanceByLayer, err := command.ComputeInstanceByLayer(ctx, definitions, c.instancesBackend, layer, instance)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "fail to compute instance by layer instance")
 	}
 
-	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, c.definitionsBackend, layerDir, layer, instanceByLayer)
+	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, definitions, layerDir, layer, instanceByLayer)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "fail to write layer to work directory")
 	}
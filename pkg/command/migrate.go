@@ -0,0 +1,383 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/envvars"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+// ContextBackends are the backends holding all the data of a context.
+type ContextBackends struct {
+	Definitions layerdefinitions.Backend
+	Instances   layerinstances.Backend
+	EnvVars     envvars.Backend
+}
+
+type contextData struct {
+	definitions []*data.LayerDefinition
+	// history has every version of the definitions, so instances spawned
+	// from older versions still find them
+	history   []*data.LayerDefinitionVersion
+	instances []*data.LayerInstance
+	variables []*data.EnvVar
+}
+
+func readContext(ctx context.Context, backends ContextBackends) (*contextData, error) {
+	definitions, err := backends.Definitions.ListLayers(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list definitions")
+	}
+
+	history, err := backends.Definitions.ListHistory(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list definitions history")
+	}
+
+	instances, err := backends.Instances.ListInstances(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list instances")
+	}
+
+	variables, err := backends.EnvVars.ListVariables(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list environment variables")
+	}
+
+	return &contextData{definitions, history, instances, variables}, nil
+}
+
+func instanceKey(instance *data.LayerInstance) string {
+	return instance.DefinitionName + "/" + instance.InstanceName
+}
+
+type migrateCommand struct {
+	source ContextBackends
+	target ContextBackends
+}
+
+func NewMigrate(source, target ContextBackends) *migrateCommand {
+	return &migrateCommand{source, target}
+}
+
+type migrationCounts struct {
+	source, target, new, overwritten, removed int
+}
+
+// Run copies every definition, instance and environment variable of the
+// source context to the target context, printing a summary of what changes
+// in the target first. Definitions of the target are replaced by the ones of
+// the source while instances and variables are merged, data that would be
+// overwritten or removed is only touched when force is set. Targets that
+// don't keep the history of definitions only get the current ones, force is
+// required too when instances were spawned from older ones.
+func (c *migrateCommand) Run(ctx context.Context, dryRun, force bool) error {
+	logger := hclog.FromContext(ctx)
+
+	source, err := readContext(ctx, c.source)
+	if err != nil {
+		return errors.Wrap(err, "fail to read source context")
+	}
+
+	target, err := readContext(ctx, c.target)
+	if err != nil {
+		return errors.Wrap(err, "fail to read target context")
+	}
+
+	definitions := migrationCounts{source: len(source.definitions), target: len(target.definitions)}
+	sourceDefinitions := map[string]struct{}{}
+	for _, d := range source.definitions {
+		sourceDefinitions[d.Name] = struct{}{}
+	}
+	targetDefinitions := map[string]struct{}{}
+	for _, d := range target.definitions {
+		targetDefinitions[d.Name] = struct{}{}
+		if _, ok := sourceDefinitions[d.Name]; !ok {
+			definitions.removed++
+		}
+	}
+	for _, d := range source.definitions {
+		if _, ok := targetDefinitions[d.Name]; ok {
+			definitions.overwritten++
+		} else {
+			definitions.new++
+		}
+	}
+
+	instances := migrationCounts{source: len(source.instances), target: len(target.instances)}
+	targetInstances := map[string]struct{}{}
+	for _, i := range target.instances {
+		targetInstances[instanceKey(i)] = struct{}{}
+	}
+	for _, i := range source.instances {
+		if _, ok := targetInstances[instanceKey(i)]; ok {
+			instances.overwritten++
+		} else {
+			instances.new++
+		}
+	}
+
+	variables := migrationCounts{source: len(source.variables), target: len(target.variables)}
+	targetVariables := map[string]struct{}{}
+	for _, v := range target.variables {
+		targetVariables[v.Name] = struct{}{}
+	}
+	for _, v := range source.variables {
+		if _, ok := targetVariables[v.Name]; ok {
+			variables.overwritten++
+		} else {
+			variables.new++
+		}
+	}
+
+	// targets that don't keep history only know the current definitions,
+	// instances spawned from older versions can then only be killed with
+	// the current definition
+	droppedVersions := 0
+	strandedInstances := 0
+	keepsHistory := layerdefinitions.KeepsHistory(c.target.Definitions)
+	if !keepsHistory {
+		current := map[string][]byte{}
+		for _, d := range source.definitions {
+			current[d.Name] = d.SHA
+		}
+		for _, v := range source.history {
+			if !bytes.Equal(current[v.Definition.Name], v.Definition.SHA) {
+				droppedVersions++
+			}
+		}
+		for _, i := range source.instances {
+			if !bytes.Equal(current[i.DefinitionName], i.DefinitionSHA) {
+				strandedInstances++
+			}
+		}
+	}
+
+	sourceLocation, err := c.source.Definitions.Location(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fail to get source location")
+	}
+	targetLocation, err := c.target.Definitions.Location(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fail to get target location")
+	}
+
+	fmt.Fprintf(os.Stdout, "Migrating from %s to %s:\n\n", sourceLocation, targetLocation)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tSOURCE\tTARGET\tNEW\tOVERWRITTEN\tREMOVED")
+	for _, row := range []struct {
+		name   string
+		counts migrationCounts
+	}{{"definitions", definitions}, {"instances", instances}, {"env vars", variables}} {
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%d\t%d\n",
+			row.name,
+			row.counts.source,
+			row.counts.target,
+			row.counts.new,
+			row.counts.overwritten,
+			row.counts.removed,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "fail to print output")
+	}
+	fmt.Fprintln(os.Stdout)
+
+	if droppedVersions > 0 {
+		fmt.Fprintf(
+			os.Stdout,
+			"Target context does not keep the history of definitions, %d previous %s will not be migrated.\n",
+			droppedVersions,
+			pluralize("version", droppedVersions),
+		)
+	}
+	if strandedInstances > 0 {
+		fmt.Fprintf(
+			os.Stdout,
+			"%d %s spawned from one of them can then only be killed with \"layerform kill --use-current-definition\".\n",
+			strandedInstances,
+			pluralize("instance", strandedInstances),
+		)
+	}
+	if droppedVersions > 0 || strandedInstances > 0 {
+		fmt.Fprintln(os.Stdout)
+	}
+
+	destructive := definitions.overwritten + definitions.removed + instances.overwritten + variables.overwritten
+	if dryRun {
+		if destructive > 0 && !force {
+			fmt.Fprintln(os.Stdout, "Target context already has data that would be overwritten, --force is required to migrate.")
+		}
+		if strandedInstances > 0 && !force {
+			fmt.Fprintln(os.Stdout, "Instances would lose the definition they were spawned from, --force is required to migrate.")
+		}
+		fmt.Fprintln(os.Stdout, "Dry run, nothing was written.")
+		return nil
+	}
+
+	if destructive > 0 && !force {
+		return errors.New("target context already has data that would be overwritten or removed, run with --force to migrate anyway")
+	}
+
+	if strandedInstances > 0 && !force {
+		return errors.New("target context can't keep the definitions some instances were spawned from, run with --force to migrate anyway")
+	}
+
+	logger.Debug("Writing definitions to target", "count", len(source.definitions))
+	err = c.target.Definitions.UpdateLayers(ctx, source.definitions)
+	if err != nil {
+		return errors.Wrap(err, "fail to write definitions to target")
+	}
+
+	logger.Debug("Writing definitions history to target", "count", len(source.history))
+	err = c.target.Definitions.ImportHistory(ctx, source.history)
+	if err != nil {
+		return errors.Wrap(err, "fail to write definitions history to target")
+	}
+
+	for _, i := range source.instances {
+		logger.Debug("Writing instance to target", "layer", i.DefinitionName, "instance", i.InstanceName)
+		err := c.target.Instances.SaveInstance(ctx, i)
+		if err != nil {
+			return errors.Wrapf(err, "fail to write instance %s of layer %s to target", i.InstanceName, i.DefinitionName)
+		}
+	}
+
+	for _, v := range source.variables {
+		logger.Debug("Writing environment variable to target", "name", v.Name)
+		err := c.target.EnvVars.SaveVariable(ctx, v)
+		if err != nil {
+			return errors.Wrapf(err, "fail to write environment variable %s to target", v.Name)
+		}
+	}
+
+	fmt.Fprintf(
+		os.Stdout,
+		"Migrated %d definitions, %d instances and %d environment variables.\n",
+		len(source.definitions),
+		len(source.instances),
+		len(source.variables),
+	)
+
+	return nil
+}
+
+// Verify checks that target, which should be freshly loaded backends of the
+// target context, holds the same definitions, instances and environment
+// variables as the source context.
+func (c *migrateCommand) Verify(ctx context.Context, target ContextBackends) error {
+	source, err := readContext(ctx, c.source)
+	if err != nil {
+		return errors.Wrap(err, "fail to read source context")
+	}
+
+	migrated, err := readContext(ctx, target)
+	if err != nil {
+		return errors.Wrap(err, "fail to read target context")
+	}
+
+	var result *multierror.Error
+
+	definitions := map[string]*data.LayerDefinition{}
+	for _, d := range migrated.definitions {
+		definitions[d.Name] = d
+	}
+	if len(definitions) != len(source.definitions) {
+		result = multierror.Append(result, errors.Errorf(
+			"source has %d definitions but target has %d",
+			len(source.definitions),
+			len(definitions),
+		))
+	}
+	for _, d := range source.definitions {
+		m, ok := definitions[d.Name]
+		if !ok {
+			result = multierror.Append(result, errors.Errorf("definition %s is missing from target", d.Name))
+		} else if !bytes.Equal(d.SHA, m.SHA) {
+			result = multierror.Append(result, errors.Errorf("definition %s has a different SHA in target", d.Name))
+		}
+	}
+
+	instances := map[string]*data.LayerInstance{}
+	for _, i := range migrated.instances {
+		instances[instanceKey(i)] = i
+	}
+	if len(instances) < len(source.instances) {
+		result = multierror.Append(result, errors.Errorf(
+			"source has %d instances but target has only %d",
+			len(source.instances),
+			len(instances),
+		))
+	}
+	for _, i := range source.instances {
+		m, ok := instances[instanceKey(i)]
+		if !ok {
+			result = multierror.Append(result, errors.Errorf("instance %s of layer %s is missing from target", i.InstanceName, i.DefinitionName))
+			continue
+		}
+
+		if !bytes.Equal(i.DefinitionSHA, m.DefinitionSHA) {
+			result = multierror.Append(result, errors.Errorf("instance %s of layer %s has a different definition SHA in target", i.InstanceName, i.DefinitionName))
+		}
+
+		// the source may have lost the version too, for instances spawned
+		// before history was kept, and targets without history only have
+		// the current version, which Run warned about
+		_, err := c.source.Definitions.GetLayerVersion(ctx, i.DefinitionName, i.DefinitionSHA)
+		if err == nil && layerdefinitions.KeepsHistory(target.Definitions) {
+			_, err = target.Definitions.GetLayerVersion(ctx, i.DefinitionName, i.DefinitionSHA)
+			if err != nil {
+				result = multierror.Append(result, errors.Wrapf(
+					err,
+					"definition instance %s of layer %s was spawned from is missing from target",
+					i.InstanceName,
+					i.DefinitionName,
+				))
+			}
+		}
+
+		if sha256.Sum256(i.Bytes) != sha256.Sum256(m.Bytes) {
+			result = multierror.Append(result, errors.Errorf("instance %s of layer %s has a different state in target", i.InstanceName, i.DefinitionName))
+		}
+	}
+
+	variables := map[string]string{}
+	for _, v := range migrated.variables {
+		variables[v.Name] = v.Value
+	}
+	for _, v := range source.variables {
+		value, ok := variables[v.Name]
+		if !ok {
+			result = multierror.Append(result, errors.Errorf("environment variable %s is missing from target", v.Name))
+		} else if value != v.Value {
+			result = multierror.Append(result, errors.Errorf("environment variable %s has a different value in target", v.Name))
+		}
+	}
+
+	if err := result.ErrorOrNil(); err != nil {
+		return errors.Wrap(err, "verification failed")
+	}
+
+	fmt.Fprintf(
+		os.Stdout,
+		"Verified %d definitions, %d instances and %d environment variables in target.\n",
+		len(source.definitions),
+		len(source.instances),
+		len(source.variables),
+	)
+
+	return nil
+}
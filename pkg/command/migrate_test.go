@@ -0,0 +1,144 @@
+package command
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/envvars"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+func newFileBackends(t *testing.T, dir string) ContextBackends {
+	ctx := context.Background()
+
+	definitions, err := layerdefinitions.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "definitions"), 0))
+	require.NoError(t, err)
+
+	instances, err := layerinstances.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "state"), 0))
+	require.NoError(t, err)
+
+	envVars, err := envvars.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "env"), 0))
+	require.NoError(t, err)
+
+	return ContextBackends{definitions, instances, envVars}
+}
+
+// historylessBackend stands for cloud contexts, which only keep the current
+// definitions.
+type historylessBackend struct {
+	layerdefinitions.Backend
+}
+
+func (historylessBackend) KeepsHistory() bool {
+	return false
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	sourceDir := t.TempDir()
+	targetDir := t.TempDir()
+
+	source := newFileBackends(t, sourceDir)
+	require.NoError(t, source.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{
+		{SHA: []byte("base"), Name: "base"},
+		{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}},
+	}))
+	require.NoError(t, source.Instances.SaveInstance(ctx, &data.LayerInstance{
+		DefinitionSHA:  []byte("base"),
+		DefinitionName: "base",
+		InstanceName:   "default",
+		Bytes:          []byte("state"),
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}))
+	require.NoError(t, source.EnvVars.SaveVariable(ctx, &data.EnvVar{Name: "A", Value: "b"}))
+
+	// the instance stays pinned to the version it was spawned from
+	require.NoError(t, source.Definitions.UpdateLayers(ctx, []*data.LayerDefinition{
+		{SHA: []byte("base-v2"), Name: "base"},
+		{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}},
+	}))
+
+	t.Run("dry run writes nothing", func(t *testing.T) {
+		err := NewMigrate(source, newFileBackends(t, targetDir)).Run(ctx, true, false)
+		require.NoError(t, err)
+
+		target, err := readContext(ctx, newFileBackends(t, targetDir))
+		require.NoError(t, err)
+		assert.Empty(t, target.definitions)
+		assert.Empty(t, target.instances)
+		assert.Empty(t, target.variables)
+	})
+
+	t.Run("copies and verifies everything", func(t *testing.T) {
+		migrate := NewMigrate(source, newFileBackends(t, targetDir))
+		require.NoError(t, migrate.Run(ctx, false, false))
+		require.NoError(t, migrate.Verify(ctx, newFileBackends(t, targetDir)))
+
+		target := newFileBackends(t, targetDir)
+		pinned, err := target.Definitions.GetLayerVersion(ctx, "base", []byte("base"))
+		require.NoError(t, err, "history is migrated")
+		assert.Equal(t, []byte("base"), pinned.SHA)
+
+		sourceHistory, err := source.Definitions.ListHistory(ctx)
+		require.NoError(t, err)
+		targetHistory, err := target.Definitions.ListHistory(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, sourceHistory, targetHistory, "configuration times are kept")
+	})
+
+	t.Run("requires force to overwrite", func(t *testing.T) {
+		migrate := NewMigrate(source, newFileBackends(t, targetDir))
+		err := migrate.Run(ctx, false, false)
+		assert.ErrorContains(t, err, "--force")
+
+		require.NoError(t, migrate.Run(ctx, false, true))
+	})
+
+	t.Run("verification catches differences", func(t *testing.T) {
+		target := newFileBackends(t, targetDir)
+		require.NoError(t, target.EnvVars.SaveVariable(ctx, &data.EnvVar{Name: "A", Value: "changed"}))
+		require.NoError(t, target.Instances.DeleteInstance(ctx, "base", "default"))
+
+		err := NewMigrate(source, target).Verify(ctx, newFileBackends(t, targetDir))
+		assert.ErrorContains(t, err, "instance default of layer base is missing from target")
+		assert.ErrorContains(t, err, "environment variable A has a different value in target")
+	})
+
+	t.Run("verification catches lost pinned versions", func(t *testing.T) {
+		// a target that only knows the current definitions
+		target := newFileBackends(t, t.TempDir())
+		current, err := source.Definitions.ListLayers(ctx)
+		require.NoError(t, err)
+		require.NoError(t, target.Definitions.UpdateLayers(ctx, current))
+		instances, err := source.Instances.ListInstances(ctx)
+		require.NoError(t, err)
+		require.NoError(t, target.Instances.SaveInstance(ctx, instances[0]))
+
+		err = NewMigrate(source, target).Verify(ctx, target)
+		assert.ErrorContains(t, err, "definition instance default of layer base was spawned from is missing from target")
+	})
+
+	t.Run("targets without history require force for outdated instances", func(t *testing.T) {
+		dir := t.TempDir()
+		target := newFileBackends(t, dir)
+		target.Definitions = historylessBackend{target.Definitions}
+
+		migrate := NewMigrate(source, target)
+		err := migrate.Run(ctx, false, false)
+		assert.ErrorContains(t, err, "--force")
+
+		require.NoError(t, migrate.Run(ctx, false, true))
+
+		reloaded := newFileBackends(t, dir)
+		reloaded.Definitions = historylessBackend{reloaded.Definitions}
+		require.NoError(t, migrate.Verify(ctx, reloaded), "lost versions were already warned about")
+	})
+}
@@ -13,8 +13,8 @@ import (
 
 	"github.com/cbroglie/mustache"
 
-	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/tfclient"
+	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/layerdefinitions"
 	"github.com/ergomake/layerform/pkg/layerinstances"
 )
@@ -22,43 +22,42 @@ import (
 type outputCommand struct {
 	definitionsBackend layerdefinitions.Backend
 	instancesBackend   layerinstances.Backend
+	tfConfig           *data.TerraformConfig
 }
 
-func NewOutput(definitionsBackend layerdefinitions.Backend, instancesBackend layerinstances.Backend) *outputCommand {
-	return &outputCommand{definitionsBackend, instancesBackend}
+func NewOutput(
+	definitionsBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	tfConfig *data.TerraformConfig,
+) *outputCommand {
+	return &outputCommand{definitionsBackend, instancesBackend, tfConfig}
 }
 
 func (c *outputCommand) Run(ctx context.Context, layerName, instanceName, template string) error {
 	logger := hclog.FromContext(ctx)
 
-	layer, err := c.definitionsBackend.GetLayer(ctx, layerName)
-	if err != nil {
-		return errors.Wrap(err, "fail to get layer")
-	}
-
-	if layer == nil {
-		return errors.New("layer not found")
-	}
-
-	instance, err := c.instancesBackend.GetInstance(ctx, layer.Name, instanceName)
+	instance, err := c.instancesBackend.GetInstance(ctx, layerName, instanceName)
 	if err != nil {
 		if errors.Is(err, layerinstances.ErrInstanceNotFound) {
 			return errors.Errorf(
 				"instance %s not found for layer %s\n",
 				instanceName,
-				layer.Name,
+				layerName,
 			)
 		}
 
 		return errors.Wrap(err, "fail to get layer instance")
 	}
 
-	tfpath, err := terraform.GetTFPath(ctx)
+	layer, definitions, err := PinnedDefinitions(ctx, c.definitionsBackend, c.instancesBackend, instance)
+	if err != nil {
+		return errors.Wrap(err, "fail to get layer")
+	}
+
+	tfpath, err := TerraformPath(ctx, c.tfConfig, layer)
 	if err != nil {
-		return errors.Wrap(err, "fail to get terraform path")
+		return err
 	}
-	logger.Debug("Using terraform from", "tfpath", tfpath)
-	logger.Debug("Found terraform installation", "tfpath", tfpath)
 
 	logger.Debug("Creating a temporary work directory")
 	workdir, err := os.MkdirTemp("", "")
@@ -69,12 +68,12 @@ func (c *outputCommand) Run(ctx context.Context, layerName, instanceName, templa
 
 	layerDir := path.Join(workdir, layerName)
 
-	instanceByLayer, err := ComputeInstanceByLayer(ctx, c.definitionsBackend, c.instancesBackend, layer, instance)
+	instanceByLayer, err := ComputeInstanceByLayer(ctx, definitions, c.instancesBackend, layer, instance)
 	if err != nil {
 		return errors.Wrap(err, "fail to compute instance by layer instance")
 	}
 
-	layerWorkdir, err := WriteLayerToWorkdir(ctx, c.definitionsBackend, layerDir, layer, instanceByLayer)
+	layerWorkdir, err := WriteLayerToWorkdir(ctx, definitions, layerDir, layer, instanceByLayer)
 	if err != nil {
 		return errors.Wrap(err, "fail to write layer to work directory")
 	}
@@ -0,0 +1,199 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/pkg/errors"
+)
+
+// PlanMode tells spawn and refresh whether to preview what terraform will do
+// before doing it.
+type PlanMode int
+
+const (
+	// PlanNone applies right away, without a plan.
+	PlanNone PlanMode = iota
+	// PlanApprove shows the plan and asks for approval before applying it.
+	PlanApprove
+	// PlanOnly shows the plan and never applies it.
+	PlanOnly
+)
+
+var ErrPlanNotApproved = errors.New("plan was not approved, nothing was applied")
+
+type ResourceChange struct {
+	Address string
+	// Action is "+" for creates, "~" for updates, "-" for deletes and "-/+"
+	// for replacements.
+	Action string
+}
+
+// PlanSummary counts the changes of a plan the same way terraform does, a
+// replacement is both an add and a destroy.
+type PlanSummary struct {
+	Changes []ResourceChange
+	Add     int
+	Change  int
+	Destroy int
+}
+
+func (p *PlanSummary) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func SummarizePlan(plan *tfjson.Plan) *PlanSummary {
+	return summarizeChanges(plan.ResourceChanges)
+}
+
+// SummarizeDrift summarizes the changes terraform found between the state of
+// a refresh-only plan and the real resources, updates are resources changed
+// outside terraform and deletes are resources removed outside terraform.
+func SummarizeDrift(plan *tfjson.Plan) *PlanSummary {
+	return summarizeChanges(plan.ResourceDrift)
+}
+
+func summarizeChanges(changes []*tfjson.ResourceChange) *PlanSummary {
+	summary := &PlanSummary{Changes: []ResourceChange{}}
+	for _, rc := range changes {
+		if rc.Change == nil || rc.Mode == tfjson.DataResourceMode {
+			continue
+		}
+
+		actions := rc.Change.Actions
+		var action string
+		switch {
+		case actions.Replace():
+			action = "-/+"
+			summary.Add++
+			summary.Destroy++
+		case actions.Create():
+			action = "+"
+			summary.Add++
+		case actions.Update():
+			action = "~"
+			summary.Change++
+		case actions.Delete():
+			action = "-"
+			summary.Destroy++
+		default:
+			continue
+		}
+
+		summary.Changes = append(summary.Changes, ResourceChange{rc.Address, action})
+	}
+
+	sort.SliceStable(summary.Changes, func(i, j int) bool {
+		return summary.Changes[i].Address < summary.Changes[j].Address
+	})
+
+	return summary
+}
+
+func (p *PlanSummary) Print(w io.Writer) {
+	if p.Empty() {
+		fmt.Fprintln(w, "No changes, the instance matches its layer definition.")
+		return
+	}
+
+	for _, c := range p.Changes {
+		fmt.Fprintf(w, "  %3s %s\n", c.Action, c.Address)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to destroy.\n", p.Add, p.Change, p.Destroy)
+}
+
+type planner interface {
+	Plan(ctx context.Context, opts ...tfexec.PlanOption) (bool, error)
+	ShowPlanFile(ctx context.Context, planPath string) (*tfjson.Plan, error)
+}
+
+// Plan runs terraform plan saving the plan to planPath, which can then be
+// applied with tfexec.DirOrPlan, and summarizes it.
+func Plan(ctx context.Context, tf planner, planPath string, opts ...tfexec.PlanOption) (*PlanSummary, error) {
+	plan, err := runPlan(ctx, tf, planPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return SummarizePlan(plan), nil
+}
+
+// Drift runs a refresh-only terraform plan saving it to planPath and
+// summarizes what changed outside terraform.
+func Drift(ctx context.Context, tf planner, planPath string, opts ...tfexec.PlanOption) (*PlanSummary, error) {
+	opts = append(opts, tfexec.RefreshOnly(true))
+	plan, err := runPlan(ctx, tf, planPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return SummarizeDrift(plan), nil
+}
+
+func runPlan(ctx context.Context, tf planner, planPath string, opts ...tfexec.PlanOption) (*tfjson.Plan, error) {
+	opts = append(opts, tfexec.Out(planPath))
+	_, err := tf.Plan(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to terraform plan")
+	}
+
+	plan, err := tf.ShowPlanFile(ctx, planPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to read terraform plan")
+	}
+
+	return plan, nil
+}
+
+type answer struct {
+	line string
+	err  error
+}
+
+var (
+	stdin       io.Reader = os.Stdin
+	answers               = make(chan answer)
+	readAnswers sync.Once
+)
+
+// Confirm asks question and tells whether the answer was yes. It gives up
+// waiting for the answer when ctx is cancelled. Every prompt shares the same
+// reader, so a line is only consumed by the prompt that receives it.
+func Confirm(ctx context.Context, question string) (bool, error) {
+	readAnswers.Do(func() {
+		go func() {
+			r := bufio.NewReader(stdin)
+			for {
+				line, err := r.ReadString('\n')
+				answers <- answer{line, err}
+			}
+		}()
+	})
+
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	fmt.Fprintf(os.Stdout, "%s [yes/no]: ", question)
+
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stdout)
+		return false, ctx.Err()
+	case a := <-answers:
+		if a.err != nil && !(errors.Is(a.err, io.EOF) && a.line != "") {
+			return false, errors.Wrap(a.err, "fail to read answer")
+		}
+
+		return strings.ToLower(strings.TrimSpace(a.line)) == "yes", nil
+	}
+}
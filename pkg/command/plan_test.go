@@ -0,0 +1,122 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resourceChange(address string, mode tfjson.ResourceMode, actions ...tfjson.Action) *tfjson.ResourceChange {
+	return &tfjson.ResourceChange{
+		Address: address,
+		Mode:    mode,
+		Change:  &tfjson.Change{Actions: actions},
+	}
+}
+
+func TestSummarizePlan(t *testing.T) {
+	plan := &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			resourceChange("aws_s3_bucket.logs", tfjson.ManagedResourceMode, tfjson.ActionCreate),
+			resourceChange("aws_instance.app", tfjson.ManagedResourceMode, tfjson.ActionDelete, tfjson.ActionCreate),
+			resourceChange("aws_iam_role.app", tfjson.ManagedResourceMode, tfjson.ActionUpdate),
+			resourceChange("aws_sqs_queue.old", tfjson.ManagedResourceMode, tfjson.ActionDelete),
+			resourceChange("aws_vpc.main", tfjson.ManagedResourceMode, tfjson.ActionNoop),
+			resourceChange("data.aws_ami.ubuntu", tfjson.DataResourceMode, tfjson.ActionRead),
+		},
+	}
+
+	summary := SummarizePlan(plan)
+	assert.Equal(t, []ResourceChange{
+		{"aws_iam_role.app", "~"},
+		{"aws_instance.app", "-/+"},
+		{"aws_s3_bucket.logs", "+"},
+		{"aws_sqs_queue.old", "-"},
+	}, summary.Changes)
+
+	var out bytes.Buffer
+	summary.Print(&out)
+	assert.Equal(t, `    ~ aws_iam_role.app
+  -/+ aws_instance.app
+    + aws_s3_bucket.logs
+    - aws_sqs_queue.old
+
+Plan: 2 to add, 1 to change, 2 to destroy.
+`, out.String())
+
+	empty := SummarizePlan(&tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		resourceChange("aws_vpc.main", tfjson.ManagedResourceMode, tfjson.ActionNoop),
+	}})
+	assert.True(t, empty.Empty())
+}
+
+type fakePlanner struct {
+	opts []tfexec.PlanOption
+	plan *tfjson.Plan
+}
+
+func (f *fakePlanner) Plan(_ context.Context, opts ...tfexec.PlanOption) (bool, error) {
+	f.opts = opts
+	return len(f.plan.ResourceChanges) > 0, nil
+}
+
+func (f *fakePlanner) ShowPlanFile(_ context.Context, _ string) (*tfjson.Plan, error) {
+	return f.plan, nil
+}
+
+func TestPlan(t *testing.T) {
+	planner := &fakePlanner{plan: &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		resourceChange("aws_s3_bucket.logs", tfjson.ManagedResourceMode, tfjson.ActionCreate),
+	}}}
+
+	summary, err := Plan(context.Background(), planner, "/tmp/layerform.tfplan", tfexec.Var("foo=bar"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Add)
+	assert.Equal(t, []tfexec.PlanOption{tfexec.Var("foo=bar"), tfexec.Out("/tmp/layerform.tfplan")}, planner.opts)
+}
+
+func TestDrift(t *testing.T) {
+	planner := &fakePlanner{plan: &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			resourceChange("aws_s3_bucket.logs", tfjson.ManagedResourceMode, tfjson.ActionCreate),
+		},
+		ResourceDrift: []*tfjson.ResourceChange{
+			resourceChange("aws_sqs_queue.jobs", tfjson.ManagedResourceMode, tfjson.ActionDelete),
+			resourceChange("aws_iam_role.app", tfjson.ManagedResourceMode, tfjson.ActionUpdate),
+		},
+	}}
+
+	summary, err := Drift(context.Background(), planner, "/tmp/layerform.tfplan")
+	require.NoError(t, err)
+	assert.Equal(t, []ResourceChange{
+		{"aws_iam_role.app", "~"},
+		{"aws_sqs_queue.jobs", "-"},
+	}, summary.Changes, "only resources changed outside terraform are drift")
+	assert.Equal(t, []tfexec.PlanOption{tfexec.RefreshOnly(true), tfexec.Out("/tmp/layerform.tfplan")}, planner.opts)
+}
+
+func TestConfirm(t *testing.T) {
+	// the reader is shared by every prompt and starts on the first one
+	stdin = strings.NewReader("yes\nno\nyes")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Confirm(ctx, "Cancelled?")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	for _, expected := range []bool{true, false, true} {
+		approved, err := Confirm(context.Background(), "Apply?")
+		require.NoError(t, err)
+		assert.Equal(t, expected, approved, "cancelled prompts do not consume answers")
+	}
+
+	_, err = Confirm(context.Background(), "Apply?")
+	assert.ErrorIs(t, err, io.EOF)
+}
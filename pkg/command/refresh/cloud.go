@@ -15,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ergomake/layerform/internal/cloud"
+	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/layerdefinitions"
 	"github.com/ergomake/layerform/pkg/layerinstances"
@@ -39,10 +40,15 @@ func (e *cloudRefreshCommand) Run(
 	ctx context.Context,
 	definitionName, instanceName string,
 	vars []string,
+	planMode command.PlanMode,
 ) error {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Refreshing instance remotely")
 
+	if planMode != command.PlanNone {
+		return errors.New("plans are not supported by contexts of type cloud")
+	}
+
 	sm := ysmrr.NewSpinnerManager(
 		ysmrr.WithAnimation(animations.Dots),
 		ysmrr.WithSpinnerColor(colors.FgHiBlue),
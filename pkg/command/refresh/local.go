@@ -13,7 +13,6 @@ import (
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"github.com/pkg/errors"
 
-	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/tfclient"
 	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
@@ -26,22 +25,27 @@ type localRefreshCommand struct {
 	definitionsBackend layerdefinitions.Backend
 	instancesBackend   layerinstances.Backend
 	envVarsBackend     envvars.Backend
+	tfConfig           *data.TerraformConfig
 }
 
 var _ Refresh = &localRefreshCommand{}
 
+// NewLocal returns a refresh command that runs terraform locally, tfConfig
+// is the default terraform config of layers.
 func NewLocal(
 	definitionsBackend layerdefinitions.Backend,
 	instancesBackend layerinstances.Backend,
 	envVarsBackend envvars.Backend,
+	tfConfig *data.TerraformConfig,
 ) *localRefreshCommand {
-	return &localRefreshCommand{definitionsBackend, instancesBackend, envVarsBackend}
+	return &localRefreshCommand{definitionsBackend, instancesBackend, envVarsBackend, tfConfig}
 }
 
 func (c *localRefreshCommand) Run(
 	ctx context.Context,
 	definitionName, instanceName string,
 	vars []string,
+	planMode command.PlanMode,
 ) error {
 	logger := hclog.FromContext(ctx)
 
@@ -58,14 +62,7 @@ func (c *localRefreshCommand) Run(
 		),
 	)
 
-	definition, err := c.definitionsBackend.GetLayer(ctx, definitionName)
-	if err != nil {
-		s.Error()
-		sm.Stop()
-		return errors.Wrap(err, "fail to get layer definition")
-	}
-
-	instance, err := c.instancesBackend.GetInstance(ctx, definition.Name, instanceName)
+	instance, err := c.instancesBackend.GetInstance(ctx, definitionName, instanceName)
 	if err != nil {
 		s.Error()
 		sm.Stop()
@@ -74,13 +71,22 @@ func (c *localRefreshCommand) Run(
 			return errors.Errorf(
 				"instance %s not found for layer %s",
 				instanceName,
-				definition.Name,
+				definitionName,
 			)
 		}
 
 		return errors.Wrap(err, "fail to get layer instance")
 	}
 
+	// refresh keeps the definition sha of the instance so it must apply the
+	// same definition the instance was spawned from
+	definition, definitions, err := command.PinnedDefinitions(ctx, c.definitionsBackend, c.instancesBackend, instance)
+	if err != nil {
+		s.Error()
+		sm.Stop()
+		return errors.Wrap(err, "fail to get layer definition")
+	}
+
 	envVars, err := c.envVarsBackend.ListVariables(ctx)
 	if err != nil {
 		s.Error()
@@ -97,14 +103,12 @@ func (c *localRefreshCommand) Run(
 		}
 	}
 
-	tfpath, err := terraform.GetTFPath(ctx)
+	tfpath, err := command.TerraformPath(ctx, c.tfConfig, definition)
 	if err != nil {
 		s.Error()
 		sm.Stop()
-		return errors.Wrap(err, "fail to get terraform path")
+		return err
 	}
-	logger.Debug("Using terraform from", "tfpath", tfpath)
-	logger.Debug("Found terraform installation", "tfpath", tfpath)
 
 	logger.Debug("Creating a temporary work directory")
 	workdir, err := os.MkdirTemp("", "")
@@ -119,7 +123,7 @@ func (c *localRefreshCommand) Run(
 
 	instanceByLayer, err := command.ComputeInstanceByLayer(
 		ctx,
-		c.definitionsBackend,
+		definitions,
 		c.instancesBackend,
 		definition,
 		instance,
@@ -130,7 +134,7 @@ func (c *localRefreshCommand) Run(
 		return errors.Wrap(err, "fail to compute instance by layer instance")
 	}
 
-	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, c.definitionsBackend, layerDir, definition, instanceByLayer)
+	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, definitions, layerDir, definition, instanceByLayer)
 	if err != nil {
 		s.Error()
 		sm.Stop()
@@ -169,15 +173,61 @@ func (c *localRefreshCommand) Run(
 	logger.Debug(fmt.Sprintf("Found %d var files", len(varFiles)), "varFiles", varFiles)
 
 	applyOptions := []tfexec.ApplyOption{}
+	planOptions := []tfexec.PlanOption{}
 	for _, vf := range varFiles {
 		applyOptions = append(applyOptions, tfexec.VarFile(vf))
+		planOptions = append(planOptions, tfexec.VarFile(vf))
 	}
 	for _, v := range vars {
 		applyOptions = append(applyOptions, tfexec.Var(v))
+		planOptions = append(planOptions, tfexec.Var(v))
 	}
 
 	s.Complete()
 
+	if planMode != command.PlanNone {
+		s = sm.AddSpinner(fmt.Sprintf("Planning instance \"%s\" of layer \"%s\"", instanceName, definitionName))
+
+		planPath := path.Join(layerWorkdir, "layerform.tfplan")
+		summary, err := command.Plan(ctx, tf, planPath, planOptions...)
+		if err != nil {
+			s.Error()
+			sm.Stop()
+			return err
+		}
+		s.Complete()
+		sm.Stop()
+
+		fmt.Fprintf(os.Stdout, "\nInstance \"%s\" of layer \"%s\":\n", instanceName, definitionName)
+		summary.Print(os.Stdout)
+		fmt.Fprintln(os.Stdout)
+
+		if planMode == command.PlanOnly {
+			return nil
+		}
+
+		// an empty plan changes nothing, applying it still updates the
+		// outputs of the instance
+		if !summary.Empty() {
+			approved, err := command.Confirm(ctx, "Do you want to apply this plan?")
+			if err != nil {
+				return err
+			}
+			if !approved {
+				return command.ErrPlanNotApproved
+			}
+		}
+
+		// the saved plan already has the variables
+		applyOptions = []tfexec.ApplyOption{tfexec.DirOrPlan(planPath)}
+
+		sm = ysmrr.NewSpinnerManager(
+			ysmrr.WithAnimation(animations.Dots),
+			ysmrr.WithSpinnerColor(colors.FgHiBlue),
+		)
+		sm.Start()
+	}
+
 	s = sm.AddSpinner(
 		fmt.Sprintf(
 			"Refreshing instance \"%s\" of layer \"%s\"",
@@ -188,31 +238,17 @@ func (c *localRefreshCommand) Run(
 
 	err = tf.Apply(ctx, applyOptions...)
 	if err != nil {
-		originalErr := err
-
-		nextStateBytes, err := os.ReadFile(statePath)
-		if err != nil {
-			s.Error()
-			sm.Stop()
-			return errors.Wrap(err, "fail to read next state")
-		}
+		s.Error()
+		sm.Stop()
 
 		// if this refresh attempt generated state, we should save it as faulty
 		// so user can fix it later
-		if len(nextStateBytes) > 0 {
-			instance.Bytes = nextStateBytes
-			instance.Status = data.LayerInstanceStatusFaulty
-			err = c.instancesBackend.SaveInstance(ctx, instance)
-			if err != nil {
-				s.Error()
-				sm.Stop()
-				return errors.Wrap(err, "fail to save instance of failed instance")
-			}
+		saveErr := command.SaveFaultyInstance(ctx, c.instancesBackend, instance, statePath)
+		if saveErr != nil {
+			return saveErr
 		}
 
-		s.Error()
-		sm.Stop()
-		return errors.Wrap(originalErr, "fail to terraform apply")
+		return errors.Wrap(err, "fail to terraform apply")
 	}
 
 	nextStateBytes, err := os.ReadFile(statePath)
@@ -224,7 +260,7 @@ func (c *localRefreshCommand) Run(
 
 	instance.Bytes = nextStateBytes
 	instance.Status = data.LayerInstanceStatusAlive
-	err = c.instancesBackend.SaveInstance(ctx, instance)
+	err = command.SaveInstance(ctx, c.instancesBackend, instance)
 	if err != nil {
 		s.Error()
 		sm.Stop()
@@ -2,6 +2,8 @@ package refresh
 
 import (
 	"context"
+
+	"github.com/ergomake/layerform/pkg/command"
 )
 
 type Refresh interface {
@@ -9,5 +11,6 @@ type Refresh interface {
 		ctx context.Context,
 		definitionName, instanceName string,
 		vars []string,
+		planMode command.PlanMode,
 	) error
 }
@@ -0,0 +1,107 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/storage"
+)
+
+type restoreBackupCommand struct {
+	storages []storage.BackupStorage
+}
+
+func NewRestoreBackup(storages []storage.BackupStorage) *restoreBackupCommand {
+	return &restoreBackupCommand{storages}
+}
+
+// List prints every backup ID available, newest first, along with the files
+// that have a backup with that ID.
+func (c *restoreBackupCommand) List(ctx context.Context) error {
+	filesByID := map[string][]string{}
+	for _, s := range c.storages {
+		fpath, err := s.Path(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fail to get storage path")
+		}
+
+		backups, err := s.ListBackups(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "fail to list backups of %s", fpath)
+		}
+
+		for _, b := range backups {
+			filesByID[b.ID] = append(filesByID[b.ID], fpath)
+		}
+	}
+
+	if len(filesByID) == 0 {
+		fmt.Fprintln(os.Stdout, "No backups found.")
+		return nil
+	}
+
+	ids := make([]string, 0, len(filesByID))
+	for id := range filesByID {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "BACKUP ID\tFILE")
+	for _, id := range ids {
+		for _, f := range filesByID[id] {
+			fmt.Fprintf(w, "%s\t%s\n", id, f)
+		}
+	}
+
+	return errors.Wrap(w.Flush(), "fail to print output")
+}
+
+// Run rolls every file of the context back to the state it was in at the
+// time of the given backup ID. Nothing is restored when the backup of any
+// file was pruned, files would end up at different points in time.
+func (c *restoreBackupCommand) Run(ctx context.Context, id string) error {
+	logger := hclog.FromContext(ctx)
+
+	for _, s := range c.storages {
+		_, err := s.FindBackup(ctx, id)
+		if err != nil && !errors.Is(err, storage.ErrBackupNotFound) {
+			return errors.Wrapf(err, "fail to find backup %s", id)
+		}
+	}
+
+	restored := 0
+	for _, s := range c.storages {
+		fpath, err := s.Path(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fail to get storage path")
+		}
+
+		// files that were not replaced since id already have the content they
+		// had back then
+		backup, err := s.RestoreBackup(ctx, id)
+		if errors.Is(err, storage.ErrBackupNotFound) {
+			logger.Debug("Nothing changed since backup", "path", fpath, "id", id)
+			continue
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "fail to restore backup of %s", fpath)
+		}
+
+		fmt.Fprintf(os.Stdout, "Restored \"%s\" from backup %s.\n", fpath, backup.ID)
+		restored++
+	}
+
+	if restored == 0 {
+		return errors.Wrapf(storage.ErrBackupNotFound, "nothing changed at or after %s", id)
+	}
+
+	return nil
+}
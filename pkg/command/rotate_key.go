@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/storage"
+)
+
+type rotateKeyCommand struct {
+	storages []storage.FileLike
+}
+
+// NewRotateKey receives the raw, unencrypted, storages of every file of a
+// context. Storages that keep backups must not take new ones.
+func NewRotateKey(storages []storage.FileLike) *rotateKeyCommand {
+	return &rotateKeyCommand{storages}
+}
+
+// Run re-encrypts every file with newKey. oldKey is the key currently in use
+// and may be nil when the context was not encrypted yet.
+//
+// Files already encrypted with newKey are still readable, so an interrupted
+// rotation can be run again. Content that is not encrypted is only accepted
+// when oldKey is nil. Backups are deleted once their file is re-encrypted,
+// they hold plain content or content encrypted with oldKey. For the same
+// reason nothing is done when a storage keeps a history of the files, like
+// git contexts do, unless it has no previous version of them.
+func (c *rotateKeyCommand) Run(ctx context.Context, oldKey, newKey *storage.EncryptionKey) error {
+	logger := hclog.FromContext(ctx)
+
+	decryptKeys := []*storage.EncryptionKey{}
+	if oldKey != nil {
+		decryptKeys = append(decryptKeys, oldKey)
+	}
+
+	for _, raw := range c.storages {
+		h, ok := raw.(storage.HistoryStorage)
+		if !ok {
+			continue
+		}
+
+		fpath, err := h.Path(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fail to get storage path")
+		}
+
+		hasHistory, err := h.HasHistory(ctx)
+		if err != nil {
+			return err
+		}
+
+		if hasHistory {
+			return errors.Errorf(
+				"previous versions of %s are kept in the history and would stay readable, "+
+					"remove them from the history of the repository (e.g. with git filter-repo) first",
+				fpath,
+			)
+		}
+	}
+
+	for _, raw := range c.storages {
+		fpath, err := raw.Path(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fail to get storage path")
+		}
+
+		var current json.RawMessage
+		err = raw.Load(ctx, &current)
+		if err != nil {
+			return errors.Wrapf(err, "fail to read %s", fpath)
+		}
+
+		if current == nil {
+			logger.Debug("Nothing to re-encrypt", "path", fpath)
+			continue
+		}
+
+		encrypted := storage.NewEncryptedStorage(raw, newKey, decryptKeys...)
+		if oldKey == nil {
+			encrypted.AllowPlaintext()
+		}
+
+		ctx := storage.WithChangeDescription(ctx, fmt.Sprintf("Re-encrypt with key %s", newKey.ID))
+		err = encrypted.Update(ctx, func(load storage.LoadFunc) (any, error) {
+			var content json.RawMessage
+			err := load(&content)
+			return content, err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "fail to re-encrypt %s", fpath)
+		}
+
+		fmt.Fprintf(os.Stdout, "Re-encrypted \"%s\" with key %s.\n", fpath, newKey.ID)
+
+		if b, ok := raw.(storage.BackupStorage); ok {
+			n, err := b.DeleteBackups(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "fail to delete backups of %s", fpath)
+			}
+
+			if n > 0 {
+				fmt.Fprintf(os.Stdout, "Deleted %d backups of \"%s\".\n", n, fpath)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/storage"
+)
+
+func TestRotateKey(t *testing.T) {
+	ctx := context.Background()
+	fpath := path.Join(t.TempDir(), "layerform.env")
+
+	// two plain versions, so the file has a plain backup
+	withBackups := storage.NewFileStorage(fpath, 5)
+	require.NoError(t, withBackups.Save(ctx, map[string]string{"A": "old"}))
+	require.NoError(t, withBackups.Save(ctx, map[string]string{"A": "b"}))
+	backups, err := withBackups.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	oldKey, err := storage.NewEncryptionKey(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	newKey, err := storage.NewEncryptionKey(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+
+	raw := []storage.FileLike{storage.NewFileStorage(fpath, 0)}
+
+	t.Run("enabling encryption deletes plain backups", func(t *testing.T) {
+		require.NoError(t, NewRotateKey(raw).Run(ctx, nil, oldKey))
+
+		backups, err := withBackups.ListBackups(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, backups)
+
+		content := map[string]string{}
+		require.NoError(t, storage.NewEncryptedStorage(raw[0], oldKey).Load(ctx, &content))
+		assert.Equal(t, map[string]string{"A": "b"}, content)
+	})
+
+	t.Run("rotating refuses plain content", func(t *testing.T) {
+		other := path.Join(t.TempDir(), "layerform.env")
+		require.NoError(t, storage.NewFileStorage(other, 0).Save(ctx, map[string]string{"A": "injected"}))
+
+		err := NewRotateKey([]storage.FileLike{storage.NewFileStorage(other, 0)}).Run(ctx, oldKey, newKey)
+		assert.ErrorIs(t, err, storage.ErrNotEncrypted)
+	})
+
+	t.Run("refuses storages with history", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not installed")
+		}
+
+		gs, err := storage.NewGitStorage(ctx, t.TempDir(), "layerform.env")
+		require.NoError(t, err)
+		require.NoError(t, gs.Save(ctx, map[string]string{"A": "plain"}))
+
+		err = NewRotateKey([]storage.FileLike{gs}).Run(ctx, nil, newKey)
+		assert.ErrorContains(t, err, "are kept in the history")
+
+		content := map[string]string{}
+		require.NoError(t, gs.Load(ctx, &content))
+		assert.Equal(t, map[string]string{"A": "plain"}, content, "nothing is re-encrypted")
+	})
+
+	t.Run("rotating leaves no copy encrypted with the old key", func(t *testing.T) {
+		require.NoError(t, storage.NewEncryptedStorage(withBackups, oldKey).Save(ctx, map[string]string{"A": "b"}))
+		backups, err := withBackups.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+
+		require.NoError(t, NewRotateKey(raw).Run(ctx, oldKey, newKey))
+
+		backups, err = withBackups.ListBackups(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, backups)
+
+		content := map[string]string{}
+		err = storage.NewEncryptedStorage(raw[0], oldKey).Load(ctx, &content)
+		assert.ErrorIs(t, err, storage.ErrUnknownEncryptionKey)
+		require.NoError(t, storage.NewEncryptedStorage(raw[0], newKey).Load(ctx, &content))
+		assert.Equal(t, map[string]string{"A": "b"}, content)
+	})
+}
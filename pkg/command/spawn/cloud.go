@@ -15,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ergomake/layerform/internal/cloud"
+	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
 	"github.com/ergomake/layerform/pkg/layerinstances"
 )
@@ -37,10 +38,16 @@ func (e *cloudSpawnCommand) Run(
 	definitionName, instanceName string,
 	dependenciesInstance map[string]string,
 	vars []string,
+	planMode command.PlanMode,
+	parallelism int,
 ) error {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Spawning instance remotely")
 
+	if planMode != command.PlanNone {
+		return errors.New("plans are not supported by contexts of type cloud")
+	}
+
 	_, err := e.instancesBackend.GetInstance(ctx, definitionName, instanceName)
 	if err == nil {
 		return errors.Errorf("layer %s already spawned with name %s", definitionName, instanceName)
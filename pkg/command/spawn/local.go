@@ -7,16 +7,17 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/chelnak/ysmrr"
 	"github.com/chelnak/ysmrr/pkg/animations"
 	"github.com/chelnak/ysmrr/pkg/colors"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform-exec/tfexec"
 	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/pkg/errors"
 
-	"github.com/ergomake/layerform/internal/terraform"
 	"github.com/ergomake/layerform/internal/tfclient"
 	"github.com/ergomake/layerform/pkg/command"
 	"github.com/ergomake/layerform/pkg/data"
@@ -29,16 +30,20 @@ type localSpawnCommand struct {
 	definitionsBackend layerdefinitions.Backend
 	instancesBackend   layerinstances.Backend
 	envVarsBackend     envvars.Backend
+	tfConfig           *data.TerraformConfig
 }
 
 var _ Spawn = &localSpawnCommand{}
 
+// NewLocal returns a spawn command that runs terraform locally, tfConfig is
+// the default terraform config of layers.
 func NewLocal(
 	definitionsBackend layerdefinitions.Backend,
 	instancesBackend layerinstances.Backend,
 	envVarsBackend envvars.Backend,
+	tfConfig *data.TerraformConfig,
 ) *localSpawnCommand {
-	return &localSpawnCommand{definitionsBackend, instancesBackend, envVarsBackend}
+	return &localSpawnCommand{definitionsBackend, instancesBackend, envVarsBackend, tfConfig}
 }
 
 func (c *localSpawnCommand) Run(
@@ -46,15 +51,11 @@ func (c *localSpawnCommand) Run(
 	layerName, instanceName string,
 	dependenciesInstance map[string]string,
 	vars []string,
+	planMode command.PlanMode,
+	parallelism int,
 ) error {
 	logger := hclog.FromContext(ctx)
 
-	tfpath, err := terraform.GetTFPath(ctx)
-	if err != nil {
-		return errors.Wrap(err, "fail to get terraform path")
-	}
-	logger.Debug("Using terraform from", "tfpath", tfpath)
-
 	logger.Debug("Creating a temporary work directory")
 	workdir, err := os.MkdirTemp("", "")
 	if err != nil {
@@ -82,7 +83,7 @@ func (c *localSpawnCommand) Run(
 		}
 	}
 
-	err = c.spawnLayer(ctx, layerName, instanceName, workdir, tfpath, dependenciesInstance, vars)
+	err = c.spawnLayer(ctx, layerName, instanceName, workdir, dependenciesInstance, vars, planMode, parallelism)
 	if err != nil {
 		return errors.Wrap(err, "fail to spawn layer")
 	}
@@ -165,16 +166,92 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
+// spawnGraph returns the layers the instance of layerName stands on, bases
+// before dependants, and the dependencies of each of them.
+func (c *localSpawnCommand) spawnGraph(
+	ctx context.Context,
+	layerName string,
+) ([]*data.LayerDefinition, map[string][]string, error) {
+	layers := []*data.LayerDefinition{}
+	deps := map[string][]string{}
+
+	var visit func(layerName string) error
+	visit = func(layerName string) error {
+		if _, ok := deps[layerName]; ok {
+			return nil
+		}
+
+		layer, err := c.definitionsBackend.GetLayer(ctx, layerName)
+		if err != nil {
+			return errors.Wrap(err, "fail to get layer")
+		}
+
+		if layer == nil {
+			return errors.Errorf("layer %s not found", layerName)
+		}
+
+		deps[layerName] = layer.Dependencies
+		for _, dep := range layer.Dependencies {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+
+		layers = append(layers, layer)
+		return nil
+	}
+
+	err := visit(layerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return layers, deps, nil
+}
+
 func (c *localSpawnCommand) spawnLayer(
 	ctx context.Context,
-	layerName, instanceName, workdir, tfpath string,
+	layerName, instanceName, workdir string,
 	dependenciesInstance map[string]string,
 	vars []string,
+	planMode command.PlanMode,
+	parallelism int,
 ) error {
 	logger := hclog.FromContext(ctx)
 	logger.Debug("Start spawning layer")
 
-	visited := make(map[string]string)
+	targetLayer := layerName
+
+	layers, deps, err := c.spawnGraph(ctx, layerName)
+	if err != nil {
+		return err
+	}
+
+	// plans print and prompt in the middle of the spinners, so layers are
+	// spawned one at a time
+	if planMode != command.PlanNone {
+		parallelism = 1
+	}
+
+	logger.Debug("Looking for variable definitions in .tfvars files")
+	varFiles, err := command.FindTFVarFiles()
+	if err != nil {
+		return errors.Wrap(err, "fail to find .tfvars files")
+	}
+	logger.Debug(fmt.Sprintf("Found %d var files", len(varFiles)), "varFiles", varFiles)
+
+	layersByName := make(map[string]*data.LayerDefinition, len(layers))
+	nodes := make([]string, 0, len(layers))
+	for _, l := range layers {
+		layersByName[l.Name] = l
+		nodes = append(nodes, l.Name)
+	}
+
+	// states has the state path of every layer spawned so far, dependants
+	// merge the states of their dependencies into theirs
+	var statesMu sync.Mutex
+	states := make(map[string]string, len(layers))
 
 	sm := ysmrr.NewSpinnerManager(
 		ysmrr.WithAnimation(animations.Dots),
@@ -182,35 +259,36 @@ func (c *localSpawnCommand) spawnLayer(
 	)
 	sm.Start()
 
-	var inner func(layerName, instanceName, layerWorkdir string) (string, error)
-	inner = func(layerName, instanceName, layerWorkdir string) (string, error) {
-		logger = logger.With("layer", layerName, "instance", instanceName, "layerWorkdir", layerWorkdir)
-		logger.Debug("Spawning layer")
+	run := func(ctx context.Context, layerName string) error {
+		layer := layersByName[layerName]
 
-		if st, ok := visited[layerName]; ok {
-			logger.Debug("Layer already spawned before")
-			return st, nil
+		instanceName := instanceName
+		if layerName != targetLayer {
+			instanceName = dependenciesInstance[layerName]
+			if instanceName == "" {
+				instanceName = data.DEFAULT_LAYER_INSTANCE_NAME
+			}
 		}
 
+		layerWorkdir := path.Join(workdir, layerName)
+		logger := logger.With("layer", layerName, "instance", instanceName, "layerWorkdir", layerWorkdir)
+		logger.Debug("Spawning layer")
+
 		err := os.Mkdir(layerWorkdir, os.ModePerm)
 		if err != nil {
-			return "", errors.Wrap(err, "fail to create sub work directory for layer")
+			return errors.Wrap(err, "fail to create sub work directory for layer")
 		}
 
-		layer, err := c.definitionsBackend.GetLayer(ctx, layerName)
+		tfpath, err := command.TerraformPath(ctx, c.tfConfig, layer)
 		if err != nil {
-			return "", errors.Wrap(err, "fail to get layer")
-		}
-
-		if layer == nil {
-			return "", errors.New("layer not found")
+			return err
 		}
 
 		thisLayerDepInstances := map[string]string{}
 		for _, dep := range layer.Dependencies {
 			thisLayerDepInstances[dep] = dependenciesInstance[dep]
 			if thisLayerDepInstances[dep] == "" {
-				thisLayerDepInstances[dep] = "default"
+				thisLayerDepInstances[dep] = data.DEFAULT_LAYER_INSTANCE_NAME
 			}
 		}
 
@@ -224,42 +302,43 @@ func (c *localSpawnCommand) spawnLayer(
 
 		layerWorkdir, err = command.WriteLayerToWorkdir(ctx, c.definitionsBackend, layerWorkdir, layer, instanceByLayer)
 		if err != nil {
-			return "", errors.Wrap(err, "fail to write layer to workdir")
+			s.Error()
+			return errors.Wrap(err, "fail to write layer to workdir")
 		}
 
 		tf, err := tfclient.New(layerWorkdir, tfpath)
 		if err != nil {
-			return "", errors.Wrap(err, "fail to get terraform client")
+			s.Error()
+			return errors.Wrap(err, "fail to get terraform client")
 		}
 
 		err = tf.Init(ctx, layer.SHA)
 		if err != nil {
 			s.Error()
-			return "", errors.Wrap(err, "fail to terraform init")
+			return errors.Wrap(err, "fail to terraform init")
 		}
 
 		statePath := path.Join(layerWorkdir, "terraform.tfstate")
 		err = os.WriteFile(statePath, []byte{}, 0644)
 		if err != nil {
 			s.Error()
-			return "", errors.Wrap(err, "fail to create empty terraform state")
+			return errors.Wrap(err, "fail to create empty terraform state")
 		}
 
+		// merging moves resources out of the states of dependencies, which
+		// other dependants may be merging at the same time, so each layer
+		// merges its own copies
 		depStates := []string{}
 		for _, dep := range layer.Dependencies {
-			layerWorkdir := path.Join(workdir, dep)
-
-			depInstanceName := dependenciesInstance[dep]
-			if depInstanceName == "" {
-				depInstanceName = data.DEFAULT_LAYER_INSTANCE_NAME
-			} else {
-				thisLayerDepInstances[dep] = depInstanceName
-			}
+			statesMu.Lock()
+			depStatePath := states[dep]
+			statesMu.Unlock()
 
-			depState, err := inner(dep, depInstanceName, layerWorkdir)
+			depState := path.Join(layerWorkdir, fmt.Sprintf("layerform-%s.tfstate", dep))
+			err := copyFile(depStatePath, depState)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to launch dependency layer")
+				return errors.Wrapf(err, "fail to copy state of dependency %s", dep)
 			}
 
 			depStates = append(depStates, depState)
@@ -270,7 +349,7 @@ func (c *localSpawnCommand) spawnLayer(
 			err := os.WriteFile(statePath, instance.Bytes, 0644)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to write layer instance to layer work dir")
+				return errors.Wrap(err, "fail to write layer instance to layer work dir")
 			}
 
 			depStates = append(depStates, statePath)
@@ -278,14 +357,14 @@ func (c *localSpawnCommand) spawnLayer(
 
 		if err != nil && !errors.Is(err, layerinstances.ErrInstanceNotFound) {
 			s.Error()
-			return "", errors.Wrap(err, "fail to get layer instance")
+			return errors.Wrap(err, "fail to get layer instance")
 		}
 
 		if len(depStates) > 1 {
 			destFile, err := os.CreateTemp("", "")
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to create temp file to use as output of merged state")
+				return errors.Wrap(err, "fail to create temp file to use as output of merged state")
 			}
 			defer destFile.Close()
 			defer os.Remove(destFile.Name())
@@ -295,37 +374,95 @@ func (c *localSpawnCommand) spawnLayer(
 			err = mergeTFState(ctx, tfpath, base, destFile.Name(), rest...)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to merge states")
+				return errors.Wrap(err, "fail to merge states")
 			}
 
 			err = copyFile(destFile.Name(), statePath)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to copy merged state into state path")
+				return errors.Wrap(err, "fail to copy merged state into state path")
 			}
 		} else if len(depStates) > 0 {
 			err = copyFile(depStates[0], statePath)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to copy base state into state path")
+				return errors.Wrap(err, "fail to copy base state into state path")
 			}
 		}
 
 		s.Complete()
 
-		logger.Debug("Looking for variable definitions in .tfvars files")
-		varFiles, err := command.FindTFVarFiles()
-		if err != nil {
-			return "", errors.Wrap(err, "fail to find .tfvars files")
-		}
-		logger.Debug(fmt.Sprintf("Found %d var files", len(varFiles)), "varFiles", varFiles)
-
 		applyOptions := []tfexec.ApplyOption{}
+		planOptions := []tfexec.PlanOption{}
 		for _, vf := range varFiles {
 			applyOptions = append(applyOptions, tfexec.VarFile(vf))
+			planOptions = append(planOptions, tfexec.VarFile(vf))
 		}
 		for _, v := range vars {
 			applyOptions = append(applyOptions, tfexec.Var(v))
+			planOptions = append(planOptions, tfexec.Var(v))
+		}
+
+		needsApply := instance == nil || !bytes.Equal(layer.SHA, instance.DefinitionSHA)
+
+		// only the target layer is planned, its dependencies are planned
+		// on top of the state they have now
+		if planMode == command.PlanOnly && layerName != targetLayer {
+			if instance == nil {
+				return errors.Errorf(
+					"instance %s of dependency %s does not exist, spawn it before planning",
+					instanceName,
+					layerName,
+				)
+			}
+
+			statesMu.Lock()
+			states[layerName] = statePath
+			statesMu.Unlock()
+			return nil
+		}
+
+		if needsApply && planMode != command.PlanNone {
+			s = sm.AddSpinner(fmt.Sprintf("Planning instance \"%s\" of layer \"%s\"", instanceName, layerName))
+
+			planPath := path.Join(layerWorkdir, "layerform.tfplan")
+			summary, err := command.Plan(ctx, tf, planPath, planOptions...)
+			if err != nil {
+				s.Error()
+				return err
+			}
+			s.Complete()
+			sm.Stop()
+
+			fmt.Fprintf(os.Stdout, "\nInstance \"%s\" of layer \"%s\":\n", instanceName, layerName)
+			summary.Print(os.Stdout)
+			fmt.Fprintln(os.Stdout)
+
+			approved := false
+			if planMode == command.PlanApprove {
+				approved, err = command.Confirm(ctx, "Do you want to apply this plan?")
+			}
+
+			// spawnLayer stops the spinners when done, plans run one layer
+			// at a time so no other layer uses the old ones
+			sm = ysmrr.NewSpinnerManager(
+				ysmrr.WithAnimation(animations.Dots),
+				ysmrr.WithSpinnerColor(colors.FgHiBlue),
+			)
+			sm.Start()
+
+			if planMode == command.PlanOnly {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !approved {
+				return command.ErrPlanNotApproved
+			}
+
+			// the saved plan already has the variables
+			applyOptions = []tfexec.ApplyOption{tfexec.DirOrPlan(planPath)}
 		}
 
 		verb := "Spawning"
@@ -335,44 +472,32 @@ func (c *localSpawnCommand) spawnLayer(
 		s = sm.AddSpinner(fmt.Sprintf("%s instance \"%s\" of layer \"%s\"", verb, instanceName, layerName))
 
 		var nextStateBytes []byte
-		if instance == nil || !bytes.Equal(layer.SHA, instance.DefinitionSHA) {
+		if needsApply {
 			logger.Debug("Running terraform apply")
 			err = tf.Apply(ctx, applyOptions...)
 			if err != nil {
 				s.Error()
 
-				originalErr := err
-
-				nextStateBytes, err = os.ReadFile(statePath)
-				if err != nil {
-					return "", errors.Wrap(err, "fail to read next state")
-				}
-
 				// if this spawn attempt generated state, we should save it as faulty
 				// so user can fix it
-				if len(nextStateBytes) > 0 {
-					instance = &data.LayerInstance{
-						DefinitionSHA:        layer.SHA,
-						DefinitionName:       layerName,
-						InstanceName:         instanceName,
-						DependenciesInstance: thisLayerDepInstances,
-						Bytes:                nextStateBytes,
-						Status:               data.LayerInstanceStatusFaulty,
-						Version:              data.CURRENT_INSTANCE_VERSION,
-					}
-					err = c.instancesBackend.SaveInstance(ctx, instance)
-					if err != nil {
-						return "", errors.Wrap(err, "fail to save instance of failed instance")
-					}
+				saveErr := command.SaveFaultyInstance(ctx, c.instancesBackend, &data.LayerInstance{
+					DefinitionSHA:        layer.SHA,
+					DefinitionName:       layerName,
+					InstanceName:         instanceName,
+					DependenciesInstance: thisLayerDepInstances,
+					Version:              data.CURRENT_INSTANCE_VERSION,
+				}, statePath)
+				if saveErr != nil {
+					return saveErr
 				}
 
-				return "", errors.Wrap(originalErr, "fail to terraform apply")
+				return errors.Wrap(err, "fail to terraform apply")
 			}
 
 			nextStateBytes, err = os.ReadFile(statePath)
 			if err != nil {
 				s.Error()
-				return "", errors.Wrap(err, "fail to read next state")
+				return errors.Wrap(err, "fail to read next state")
 			}
 
 		} else {
@@ -388,20 +513,45 @@ func (c *localSpawnCommand) spawnLayer(
 			Status:               data.LayerInstanceStatusAlive,
 			Version:              data.CURRENT_INSTANCE_VERSION,
 		}
-		err = c.instancesBackend.SaveInstance(ctx, instance)
+		err = command.SaveInstance(ctx, c.instancesBackend, instance)
 		if err != nil {
 			s.Error()
-			return "", errors.Wrap(err, "fail to save instance")
+			return errors.Wrap(err, "fail to save instance")
 		}
 
 		s.Complete()
-		visited[layerName] = statePath
-		return visited[layerName], nil
+
+		statesMu.Lock()
+		states[layerName] = statePath
+		statesMu.Unlock()
+		return nil
 	}
 
-	layerWorkdir := path.Join(workdir, layerName)
-	_, err := inner(layerName, instanceName, layerWorkdir)
+	errs := command.RunGraph(ctx, nodes, deps, parallelism, run)
 
 	sm.Stop()
-	return err
+
+	return graphError(ctx, targetLayer, nodes, errs)
+}
+
+// graphError combines the errors of the layers of a spawn. Layers skipped
+// because a dependency failed or because spawn was interrupted only repeat
+// those failures, but an interrupted spawn still fails when the target layer
+// was not spawned.
+func graphError(ctx context.Context, targetLayer string, nodes []string, errs map[string]error) error {
+	var result error
+	for _, name := range nodes {
+		var depErr *command.DependencyError
+		if errs[name] == nil || errors.As(errs[name], &depErr) || errs[name] == ctx.Err() {
+			continue
+		}
+
+		result = multierror.Append(result, errors.Wrapf(errs[name], "fail to spawn layer %s", name))
+	}
+
+	if result == nil && ctx.Err() != nil && errs[targetLayer] != nil {
+		return errors.Wrap(ctx.Err(), "spawn interrupted")
+	}
+
+	return result
 }
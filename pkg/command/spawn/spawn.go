@@ -2,13 +2,20 @@ package spawn
 
 import (
 	"context"
+
+	"github.com/ergomake/layerform/pkg/command"
 )
 
 type Spawn interface {
+	// Run spawns the instance and the missing instances it depends on,
+	// parallelism is how many layers independent of each other are applied
+	// at the same time when terraform runs locally.
 	Run(
 		ctx context.Context,
 		definitionName, instanceName string,
 		dependenciesInstance map[string]string,
 		vars []string,
+		planMode command.PlanMode,
+		parallelism int,
 	) error
 }
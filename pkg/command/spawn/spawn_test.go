@@ -1 +1,94 @@
 package spawn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+)
+
+func TestSpawnGraph(t *testing.T) {
+	ctx := context.Background()
+	definitions := layerdefinitions.NewInMemoryBackend([]*data.LayerDefinition{
+		{Name: "eks"},
+		{Name: "elasticsearch", Dependencies: []string{"eks"}},
+		{Name: "kibana", Dependencies: []string{"elasticsearch", "eks"}},
+		{Name: "beats", Dependencies: []string{"kibana", "elasticsearch"}},
+		{Name: "broken", Dependencies: []string{"missing"}},
+	})
+	c := NewLocal(definitions, nil, nil, nil)
+
+	layers, deps, err := c.spawnGraph(ctx, "beats")
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, l := range layers {
+		names = append(names, l.Name)
+	}
+	assert.Equal(t, []string{"eks", "elasticsearch", "kibana", "beats"}, names, "shared dependencies are only spawned once")
+	assert.Equal(t, map[string][]string{
+		"eks":           nil,
+		"elasticsearch": {"eks"},
+		"kibana":        {"elasticsearch", "eks"},
+		"beats":         {"kibana", "elasticsearch"},
+	}, deps)
+
+	_, _, err = c.spawnGraph(ctx, "broken")
+	assert.EqualError(t, err, "layer missing not found")
+}
+
+func TestGraphError(t *testing.T) {
+	nodes := []string{"eks", "elasticsearch", "kibana"}
+	deps := map[string][]string{
+		"elasticsearch": {"eks"},
+		"kibana":        {"elasticsearch"},
+	}
+
+	t.Run("interrupted after the first layer", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errs := command.RunGraph(ctx, nodes, deps, 1, func(_ context.Context, _ string) error {
+			cancel()
+			return nil
+		})
+
+		err := graphError(ctx, "kibana", nodes, errs)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.EqualError(t, err, "spawn interrupted: context canceled")
+	})
+
+	t.Run("interrupted after the target layer", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errs := command.RunGraph(ctx, nodes, deps, 1, func(_ context.Context, node string) error {
+			if node == "kibana" {
+				cancel()
+			}
+			return nil
+		})
+
+		assert.NoError(t, graphError(ctx, "kibana", nodes, errs))
+	})
+
+	t.Run("only reports layers that failed", func(t *testing.T) {
+		fail := errors.New("fail to apply")
+		errs := command.RunGraph(context.Background(), nodes, deps, 1, func(_ context.Context, node string) error {
+			if node == "elasticsearch" {
+				return fail
+			}
+			return nil
+		})
+
+		err := graphError(context.Background(), "kibana", nodes, errs)
+		assert.ErrorIs(t, err, fail)
+		assert.NotContains(t, err.Error(), "kibana")
+	})
+}
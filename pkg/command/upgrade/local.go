@@ -0,0 +1,339 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/chelnak/ysmrr"
+	"github.com/chelnak/ysmrr/pkg/animations"
+	"github.com/chelnak/ysmrr/pkg/colors"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/internal/tfclient"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/envvars"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+type localUpgradeCommand struct {
+	definitionsBackend layerdefinitions.Backend
+	instancesBackend   layerinstances.Backend
+	envVarsBackend     envvars.Backend
+	tfConfig           *data.TerraformConfig
+}
+
+var _ Upgrade = &localUpgradeCommand{}
+
+// NewLocal returns an upgrade command that runs terraform locally, tfConfig
+// is the default terraform config of layers.
+func NewLocal(
+	definitionsBackend layerdefinitions.Backend,
+	instancesBackend layerinstances.Backend,
+	envVarsBackend envvars.Backend,
+	tfConfig *data.TerraformConfig,
+) *localUpgradeCommand {
+	return &localUpgradeCommand{definitionsBackend, instancesBackend, envVarsBackend, tfConfig}
+}
+
+func (c *localUpgradeCommand) Run(ctx context.Context, definitionName string, concurrency int) ([]*Report, error) {
+	logger := hclog.FromContext(ctx)
+
+	layers, err := c.definitionsBackend.ListLayers(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list layer definitions")
+	}
+
+	instances, err := c.instancesBackend.ListInstances(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list layer instances")
+	}
+
+	order, deps, err := plan(layers, instances, definitionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(order) == 0 {
+		return []*Report{}, nil
+	}
+
+	envVars, err := c.envVarsBackend.ListVariables(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list environment variables")
+	}
+
+	for _, envVar := range envVars {
+		err := os.Setenv(envVar.Name, envVar.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to set %s environment variable", envVar.Name)
+		}
+	}
+
+	logger.Debug("Looking for variable definitions in .tfvars files")
+	varFiles, err := command.FindTFVarFiles()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to find .tfvars files")
+	}
+	logger.Debug(fmt.Sprintf("Found %d var files", len(varFiles)), "varFiles", varFiles)
+
+	applyOptions := []tfexec.ApplyOption{}
+	for _, vf := range varFiles {
+		applyOptions = append(applyOptions, tfexec.VarFile(vf))
+	}
+
+	layersByName := make(map[string]*data.LayerDefinition, len(layers))
+	for _, l := range layers {
+		layersByName[l.Name] = l
+	}
+
+	byKey := make(map[string]*data.LayerInstance, len(order))
+	keys := make([]string, 0, len(order))
+	for _, instance := range order {
+		byKey[key(instance)] = instance
+		keys = append(keys, key(instance))
+	}
+
+	sm := ysmrr.NewSpinnerManager(
+		ysmrr.WithAnimation(animations.Dots),
+		ysmrr.WithSpinnerColor(colors.FgHiBlue),
+	)
+	sm.Start()
+
+	errs := command.RunGraph(ctx, keys, deps, concurrency, func(ctx context.Context, k string) error {
+		instance := byKey[k]
+		s := sm.AddSpinner(
+			fmt.Sprintf(
+				"Upgrading instance \"%s\" of layer \"%s\"",
+				instance.InstanceName,
+				instance.DefinitionName,
+			),
+		)
+
+		err := c.upgrade(ctx, instance, layersByName[instance.DefinitionName], applyOptions)
+		if err != nil {
+			logger.Debug("Fail to upgrade instance", "layer", instance.DefinitionName, "instance", instance.InstanceName, "err", err)
+			s.Error()
+			return err
+		}
+
+		s.Complete()
+		return nil
+	})
+
+	sm.Stop()
+
+	reports := make([]*Report, 0, len(order))
+	for _, instance := range order {
+		err := errs[key(instance)]
+		if err != nil && err == ctx.Err() {
+			err = errNotStarted
+		}
+
+		reports = append(reports, &Report{Instance: instance, Err: err})
+	}
+
+	if ctx.Err() != nil {
+		for _, r := range reports {
+			if r.Err != nil {
+				return reports, errors.Wrap(ctx.Err(), "upgrade interrupted")
+			}
+		}
+	}
+
+	return reports, nil
+}
+
+func key(instance *data.LayerInstance) string {
+	return instance.DefinitionName + "/" + instance.InstanceName
+}
+
+// plan selects the outdated instances to upgrade and sorts them so bases come
+// before their dependants. deps maps every selected instance to the selected
+// instances it must wait for, which may be dependencies of dependencies when
+// the instances in between are up to date.
+func plan(
+	layers []*data.LayerDefinition,
+	instances []*data.LayerInstance,
+	definitionName string,
+) ([]*data.LayerInstance, map[string][]string, error) {
+	layersByName := make(map[string]*data.LayerDefinition, len(layers))
+	for _, l := range layers {
+		layersByName[l.Name] = l
+	}
+
+	if definitionName != "" {
+		if _, ok := layersByName[definitionName]; !ok {
+			return nil, nil, errors.Errorf("layer %s not found", definitionName)
+		}
+	}
+
+	byKey := make(map[string]*data.LayerInstance, len(instances))
+	for _, instance := range instances {
+		byKey[key(instance)] = instance
+	}
+
+	outdated := map[string]bool{}
+	for _, instance := range command.OutdatedInstances(layers, instances) {
+		outdated[key(instance)] = true
+	}
+
+	// outdatedDeps finds the closest outdated instances below instance,
+	// walking through the current definitions since those are the ones
+	// the upgrade applies
+	var outdatedDeps func(instance *data.LayerInstance, found map[string]bool)
+	outdatedDeps = func(instance *data.LayerInstance, found map[string]bool) {
+		layer, ok := layersByName[instance.DefinitionName]
+		if !ok {
+			return
+		}
+
+		for _, dep := range layer.Dependencies {
+			depInstance, ok := byKey[dep+"/"+instance.GetDependencyInstanceName(dep)]
+			if !ok {
+				continue
+			}
+
+			if outdated[key(depInstance)] {
+				found[key(depInstance)] = true
+				continue
+			}
+
+			outdatedDeps(depInstance, found)
+		}
+	}
+
+	deps := map[string][]string{}
+	order := []*data.LayerInstance{}
+	visited := map[string]bool{}
+	var visit func(instance *data.LayerInstance)
+	visit = func(instance *data.LayerInstance) {
+		k := key(instance)
+		if visited[k] {
+			return
+		}
+		visited[k] = true
+
+		found := map[string]bool{}
+		outdatedDeps(instance, found)
+		depKeys := make([]string, 0, len(found))
+		for d := range found {
+			depKeys = append(depKeys, d)
+		}
+		sort.Strings(depKeys)
+
+		for _, d := range depKeys {
+			visit(byKey[d])
+		}
+
+		deps[k] = depKeys
+		order = append(order, instance)
+	}
+
+	sorted := append([]*data.LayerInstance{}, instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return key(sorted[i]) < key(sorted[j])
+	})
+	for _, instance := range sorted {
+		if !outdated[key(instance)] {
+			continue
+		}
+
+		if definitionName == "" || instance.DefinitionName == definitionName {
+			visit(instance)
+		}
+	}
+
+	return order, deps, nil
+}
+
+// upgrade applies the current definition of layer to instance, it is the same
+// as a refresh except that the instance moves to the current definition.
+func (c *localUpgradeCommand) upgrade(
+	ctx context.Context,
+	instance *data.LayerInstance,
+	layer *data.LayerDefinition,
+	applyOptions []tfexec.ApplyOption,
+) error {
+	logger := hclog.FromContext(ctx)
+
+	tfpath, err := command.TerraformPath(ctx, c.tfConfig, layer)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Creating a temporary work directory")
+	workdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return errors.Wrap(err, "fail to create work directory")
+	}
+	defer os.RemoveAll(workdir)
+
+	layerDir := path.Join(workdir, layer.Name)
+
+	instanceByLayer, err := command.ComputeInstanceByLayer(
+		ctx,
+		c.definitionsBackend,
+		c.instancesBackend,
+		layer,
+		instance,
+	)
+	if err != nil {
+		return errors.Wrap(err, "fail to compute instance by layer instance")
+	}
+
+	layerWorkdir, err := command.WriteLayerToWorkdir(ctx, c.definitionsBackend, layerDir, layer, instanceByLayer)
+	if err != nil {
+		return errors.Wrap(err, "fail to write layer to work directory")
+	}
+
+	statePath := path.Join(layerWorkdir, "terraform.tfstate")
+	err = os.WriteFile(statePath, instance.Bytes, 0644)
+	if err != nil {
+		return errors.Wrap(err, "fail to write terraform state to work directory")
+	}
+
+	tf, err := tfclient.New(layerWorkdir, tfpath)
+	if err != nil {
+		return errors.Wrap(err, "fail to get terraform client")
+	}
+
+	err = tf.Init(ctx, layer.SHA)
+	if err != nil {
+		return errors.Wrap(err, "fail to terraform init")
+	}
+
+	err = tf.Apply(ctx, applyOptions...)
+	if err != nil {
+		// the instance keeps its definition so it can still be refreshed,
+		// but the state this attempt generated is saved as faulty so user
+		// can fix it later
+		saveErr := command.SaveFaultyInstance(ctx, c.instancesBackend, instance, statePath)
+		if saveErr != nil {
+			return saveErr
+		}
+
+		return errors.Wrap(err, "fail to terraform apply")
+	}
+
+	nextStateBytes, err := os.ReadFile(statePath)
+	if err != nil {
+		return errors.Wrap(err, "fail to read next state")
+	}
+
+	instance.Bytes = nextStateBytes
+	instance.DefinitionSHA = layer.SHA
+	instance.Status = data.LayerInstanceStatusAlive
+	err = command.SaveInstance(ctx, c.instancesBackend, instance)
+	if err != nil {
+		return errors.Wrap(err, "fail to save instance")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type Upgrade interface {
+	// Run moves the outdated instances of definitionName, and the outdated
+	// instances they depend on, to the current definition of their layers.
+	// Every outdated instance is upgraded when definitionName is empty.
+	// Instances that fail to upgrade have the error in their report. When
+	// interrupted before every instance was upgraded, the reports come
+	// with an error.
+	Run(ctx context.Context, definitionName string, concurrency int) ([]*Report, error)
+}
+
+type Report struct {
+	Instance *data.LayerInstance
+	Err      error
+}
+
+var errNotStarted = errors.New("interrupted before it started")
+
+// Skipped tells whether the instance was not upgraded because an instance it
+// depends on failed to upgrade or because upgrade was interrupted first.
+func (r *Report) Skipped() bool {
+	var depErr *command.DependencyError
+	return errors.As(r.Err, &depErr) || errors.Is(r.Err, errNotStarted)
+}
+
+// Print writes what happened to every instance, bases before dependants, and
+// a total.
+func Print(w io.Writer, reports []*Report) {
+	if len(reports) == 0 {
+		fmt.Fprintln(w, "All layer instances are up to date.")
+		return
+	}
+
+	upgraded := 0
+	failed := 0
+	skipped := 0
+	for _, r := range reports {
+		name := r.Instance.InstanceName
+		layer := r.Instance.DefinitionName
+
+		switch {
+		case r.Err == nil:
+			upgraded++
+			fmt.Fprintf(w, "Upgraded instance \"%s\" of layer \"%s\".\n", name, layer)
+		case r.Skipped():
+			skipped++
+			fmt.Fprintf(w, "Skipped instance \"%s\" of layer \"%s\", %s.\n", name, layer, r.Err)
+		default:
+			failed++
+			fmt.Fprintf(w, "Failed to upgrade instance \"%s\" of layer \"%s\": %s\n", name, layer, r.Err)
+		}
+	}
+
+	instances := "instances"
+	if len(reports) == 1 {
+		instances = "instance"
+	}
+
+	fmt.Fprintf(w, "\nUpgraded %d of %d outdated %s", upgraded, len(reports), instances)
+	if failed > 0 {
+		fmt.Fprintf(w, ", %d failed", failed)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d skipped", skipped)
+	}
+	fmt.Fprintln(w, ".")
+}
@@ -0,0 +1,129 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/storage"
+	"github.com/ergomake/layerform/pkg/command"
+	"github.com/ergomake/layerform/pkg/data"
+	"github.com/ergomake/layerform/pkg/envvars"
+	"github.com/ergomake/layerform/pkg/layerdefinitions"
+	"github.com/ergomake/layerform/pkg/layerinstances"
+)
+
+func keys(instances []*data.LayerInstance) []string {
+	result := []string{}
+	for _, i := range instances {
+		result = append(result, key(i))
+	}
+	return result
+}
+
+func TestPlan(t *testing.T) {
+	layers := []*data.LayerDefinition{
+		{SHA: []byte("eks-v2"), Name: "eks"},
+		{SHA: []byte("es-v1"), Name: "elasticsearch", Dependencies: []string{"eks"}},
+		{SHA: []byte("kibana-v2"), Name: "kibana", Dependencies: []string{"elasticsearch"}},
+		{SHA: []byte("other-v2"), Name: "other"},
+	}
+	instances := []*data.LayerInstance{
+		{DefinitionSHA: []byte("kibana-v1"), DefinitionName: "kibana", InstanceName: "default"},
+		{DefinitionSHA: []byte("kibana-v2"), DefinitionName: "kibana", InstanceName: "current"},
+		{DefinitionSHA: []byte("es-v1"), DefinitionName: "elasticsearch", InstanceName: "default"},
+		{DefinitionSHA: []byte("eks-v1"), DefinitionName: "eks", InstanceName: "default"},
+		{DefinitionSHA: []byte("other-v1"), DefinitionName: "other", InstanceName: "default"},
+		{DefinitionSHA: []byte("gone"), DefinitionName: "gone", InstanceName: "default"},
+	}
+
+	t.Run("every outdated instance, bases first", func(t *testing.T) {
+		order, deps, err := plan(layers, instances, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"eks/default", "kibana/default", "other/default"}, keys(order))
+		assert.Equal(t, map[string][]string{
+			"eks/default": {},
+			// elasticsearch is up to date, kibana still waits for eks
+			"kibana/default": {"eks/default"},
+			"other/default":  {},
+		}, deps)
+	})
+
+	t.Run("one layer and its outdated dependencies", func(t *testing.T) {
+		order, _, err := plan(layers, instances, "kibana")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"eks/default", "kibana/default"}, keys(order))
+
+		order, _, err = plan(layers, instances, "elasticsearch")
+		require.NoError(t, err)
+		assert.Empty(t, order)
+	})
+
+	t.Run("unknown layer", func(t *testing.T) {
+		_, _, err := plan(layers, instances, "nope")
+		assert.EqualError(t, err, "layer nope not found")
+	})
+}
+
+func TestPrint(t *testing.T) {
+	eks := &data.LayerInstance{DefinitionName: "eks", InstanceName: "default"}
+	kibana := &data.LayerInstance{DefinitionName: "kibana", InstanceName: "default"}
+	other := &data.LayerInstance{DefinitionName: "other", InstanceName: "default"}
+
+	reports := []*Report{
+		{Instance: eks, Err: errors.New("fail to terraform apply")},
+		{Instance: other},
+		{Instance: kibana, Err: &command.DependencyError{Node: "eks/default"}},
+	}
+
+	assert.False(t, reports[0].Skipped())
+	assert.True(t, reports[2].Skipped())
+
+	var out bytes.Buffer
+	Print(&out, reports)
+	assert.Equal(t, `Failed to upgrade instance "default" of layer "eks": fail to terraform apply
+Upgraded instance "default" of layer "other".
+Skipped instance "default" of layer "kibana", dependency eks/default failed.
+
+Upgraded 1 of 3 outdated instances, 1 failed, 1 skipped.
+`, out.String())
+
+	out.Reset()
+	Print(&out, nil)
+	assert.Equal(t, "All layer instances are up to date.\n", out.String())
+}
+
+func TestRunInterrupted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	definitions, err := layerdefinitions.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "definitions"), 0))
+	require.NoError(t, err)
+	instances, err := layerinstances.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "state"), 0))
+	require.NoError(t, err)
+	envVars, err := envvars.NewFileLikeBackend(ctx, storage.NewFileStorage(path.Join(dir, "env"), 0))
+	require.NoError(t, err)
+
+	require.NoError(t, definitions.UpdateLayers(ctx, []*data.LayerDefinition{{SHA: []byte("eks-v2"), Name: "eks"}}))
+	require.NoError(t, instances.SaveInstance(ctx, &data.LayerInstance{
+		DefinitionSHA:  []byte("eks-v1"),
+		DefinitionName: "eks",
+		InstanceName:   "default",
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	reports, err := NewLocal(definitions, instances, envVars, nil).Run(ctx, "", 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Len(t, reports, 1)
+	assert.True(t, reports[0].Skipped())
+}
@@ -2,7 +2,11 @@ package data
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"sort"
+	"time"
 )
 
 type LayerDefinition struct {
@@ -10,6 +14,33 @@ type LayerDefinition struct {
 	Name         string                `json:"name"`
 	Files        []LayerDefinitionFile `json:"files"`
 	Dependencies []string              `json:"dependencies"`
+	// Modules are files shared between layers, like terraform modules
+	// referenced with a relative source. Their paths are relative to the
+	// same directory as Files but may go above it with "..".
+	Modules []LayerDefinitionFile `json:"modules,omitempty"`
+	// Signature is set when the definition was signed by configure, it is
+	// not part of the SHA.
+	Signature *LayerDefinitionSignature `json:"signature,omitempty"`
+	// Terraform selects the binary that runs the layer, contexts may set
+	// defaults for it too.
+	Terraform *TerraformConfig `json:"terraform,omitempty"`
+}
+
+// TerraformConfig selects the binary used to run terraform. Engine is
+// "terraform" or "tofu", Version is a version constraint like ">= 1.5, < 2"
+// and Path is an explicit binary, which must still match Version. Path is only
+// set by contexts, layers can't select a binary.
+type TerraformConfig struct {
+	Engine  string `json:"engine,omitempty" yaml:"engine,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// LayerDefinitionSignature is an ed25519 signature of the name and
+// LayerDefinitionSHA256 of a layer definition, KeyID identifies the public key that verifies it.
+type LayerDefinitionSignature struct {
+	KeyID     string `json:"keyId"`
+	Signature []byte `json:"signature"`
 }
 
 type LayerDefinitionFile struct {
@@ -17,27 +48,59 @@ type LayerDefinitionFile struct {
 	Content []byte `json:"content"`
 }
 
+// LayerDefinitionVersion is an entry of the history of a layer definition,
+// ConfiguredAt is the last time that version was configured.
+type LayerDefinitionVersion struct {
+	Definition   *LayerDefinition `json:"definition"`
+	ConfiguredAt time.Time        `json:"configuredAt"`
+}
+
 func LayerDefinitionSHA(l *LayerDefinition) ([]byte, error) {
 	hasher := sha1.New()
-	for _, f := range l.Files {
-		_, err := hasher.Write([]byte("path:" + f.Path + "\n"))
-		if err != nil {
-			return nil, err
-		}
+	err := hashDefinition(hasher, l)
+	if err != nil {
+		return nil, err
+	}
 
-		_, err = hasher.Write([]byte("content:"))
-		if err != nil {
-			return nil, err
-		}
+	return hasher.Sum(nil), nil
+}
 
-		_, err = hasher.Write(f.Content)
+// LayerDefinitionSHA256 hashes the same content as LayerDefinitionSHA with
+// sha256, it is what signatures cover.
+func LayerDefinitionSHA256(l *LayerDefinition) ([]byte, error) {
+	hasher := sha256.New()
+	err := hashDefinition(hasher, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func hashDefinition(hasher io.Writer, l *LayerDefinition) error {
+	err := hashFiles(hasher, "", l.Files)
+	if err != nil {
+		return err
+	}
+
+	// layers without modules keep the sha they had before modules existed
+	if len(l.Modules) > 0 {
+		err := hashFiles(hasher, "module-", l.Modules)
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
 
-		_, err = hasher.Write([]byte("\n"))
+	// same for layers that don't select a terraform binary
+	if l.Terraform != nil {
+		_, err := hasher.Write([]byte(fmt.Sprintf(
+			"terraform:engine=%s;version=%s;path=%s\n",
+			l.Terraform.Engine,
+			l.Terraform.Version,
+			l.Terraform.Path,
+		)))
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -45,17 +108,43 @@ func LayerDefinitionSHA(l *LayerDefinition) ([]byte, error) {
 	copy(deps, l.Dependencies)
 	sort.Strings(deps)
 
-	_, err := hasher.Write([]byte("deps:"))
+	_, err = hasher.Write([]byte("deps:"))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for _, d := range deps {
 		_, err := hasher.Write([]byte(d))
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return hasher.Sum(nil), nil
+	return nil
+}
+
+func hashFiles(hasher io.Writer, prefix string, files []LayerDefinitionFile) error {
+	for _, f := range files {
+		_, err := hasher.Write([]byte(prefix + "path:" + f.Path + "\n"))
+		if err != nil {
+			return err
+		}
+
+		_, err = hasher.Write([]byte(prefix + "content:"))
+		if err != nil {
+			return err
+		}
+
+		_, err = hasher.Write(f.Content)
+		if err != nil {
+			return err
+		}
+
+		_, err = hasher.Write([]byte("\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -3,7 +3,7 @@ package data
 import (
 	"encoding/json"
 
-	"github.com/pkg/errors"
+	"github.com/ergomake/layerform/internal/migrations"
 )
 
 type LayerInstanceStatus string
@@ -18,10 +18,6 @@ const (
 
 const DEFAULT_LAYER_INSTANCE_NAME = "default"
 
-type version struct {
-	Version uint `json:"version"`
-}
-
 const CURRENT_INSTANCE_VERSION = 1
 
 type LayerInstanceV0 struct {
@@ -55,45 +51,38 @@ type LayerInstance struct {
 	Version              uint                `json:"version"`
 }
 
-func (i *LayerInstance) UnmarshalJSON(b []byte) error {
-	i.Version = CURRENT_INSTANCE_VERSION
-
-	var v version
-	err := json.Unmarshal(b, &v)
-	if err != nil {
-		return err
-	}
-
-	if v.Version == CURRENT_INSTANCE_VERSION {
-		// need a type alias to avoid infinite recursion
-		type alias LayerInstance
-		var tmp alias
-
-		err := json.Unmarshal(b, &tmp)
+// instanceMigrations upgrade the JSON of a layer instance, the element at
+// index N upgrading version N to N+1.
+var instanceMigrations = []migrations.JSONMigration{
+	func(b []byte) ([]byte, error) {
+		var v0 LayerInstanceV0
+		err := json.Unmarshal(b, &v0)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		*i = LayerInstance(tmp)
-		return nil
-	}
+		return json.Marshal(v0.ToLayerInstance())
+	},
+}
 
-	if v.Version > CURRENT_INSTANCE_VERSION {
-		return errors.New("layer instance was created using a newer version of layerform")
+func (i *LayerInstance) UnmarshalJSON(b []byte) error {
+	b, err := migrations.UpgradeJSON(b, instanceMigrations, "layer instance")
+	if err != nil {
+		return err
 	}
 
-	if v.Version == 0 {
-		var v0 LayerInstanceV0
-		err := json.Unmarshal(b, &v0)
-		if err != nil {
-			return err
-		}
+	// need a type alias to avoid infinite recursion
+	type alias LayerInstance
+	var tmp alias
 
-		*i = *v0.ToLayerInstance()
-		return nil
+	err = json.Unmarshal(b, &tmp)
+	if err != nil {
+		return err
 	}
 
-	return errors.Errorf("got unexpected version %d of layer instance", v.Version)
+	*i = LayerInstance(tmp)
+	i.Version = CURRENT_INSTANCE_VERSION
+	return nil
 }
 
 func (s *LayerInstance) GetDependencyInstanceName(dep string) string {
@@ -2,6 +2,7 @@ package envvars
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pkg/errors"
 
@@ -31,13 +32,31 @@ func (flb *fileLikeBackend) ListVariables(ctx context.Context) ([]*data.EnvVar,
 }
 
 func (flb *fileLikeBackend) SaveVariable(ctx context.Context, variable *data.EnvVar) error {
-	for i, v := range flb.variables {
-		if v.Name == variable.Name {
-			flb.variables[i] = variable
-			return flb.storage.Save(ctx, flb.variables)
+	ctx = storage.WithChangeDescription(ctx, fmt.Sprintf("Set environment variable %s", variable.Name))
+
+	var next []*data.EnvVar
+	err := flb.storage.Update(ctx, func(load storage.LoadFunc) (any, error) {
+		variables := make([]*data.EnvVar, 0)
+		err := load(&variables)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to reload variables")
 		}
+
+		next = variables
+		for i, v := range next {
+			if v.Name == variable.Name {
+				next[i] = variable
+				return next, nil
+			}
+		}
+
+		next = append(next, variable)
+		return next, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "fail to update variables")
 	}
 
-	flb.variables = append(flb.variables, variable)
-	return flb.storage.Save(ctx, flb.variables)
+	flb.variables = next
+	return nil
 }
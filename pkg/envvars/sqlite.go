@@ -0,0 +1,54 @@
+package envvars
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+var _ Backend = &sqliteBackend{}
+
+// NewSQLiteBackend stores each variable in its own row, db must have been
+// opened with sqlite.Open so the schema is up to date.
+func NewSQLiteBackend(db *sql.DB) *sqliteBackend {
+	return &sqliteBackend{db}
+}
+
+func (sb *sqliteBackend) ListVariables(ctx context.Context) ([]*data.EnvVar, error) {
+	rows, err := sb.db.QueryContext(ctx, "SELECT name, value FROM env_vars ORDER BY name")
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to query variables")
+	}
+	defer rows.Close()
+
+	variables := make([]*data.EnvVar, 0)
+	for rows.Next() {
+		var v data.EnvVar
+		err := rows.Scan(&v.Name, &v.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to scan variable")
+		}
+
+		variables = append(variables, &v)
+	}
+
+	return variables, errors.Wrap(rows.Err(), "fail to iterate over variables")
+}
+
+func (sb *sqliteBackend) SaveVariable(ctx context.Context, variable *data.EnvVar) error {
+	_, err := sb.db.ExecContext(
+		ctx,
+		"INSERT INTO env_vars (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value",
+		variable.Name,
+		variable.Value,
+	)
+
+	return errors.Wrap(err, "fail to save variable")
+}
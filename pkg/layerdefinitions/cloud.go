@@ -6,18 +6,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
 
 	"github.com/ergomake/layerform/internal/cloud"
 	"github.com/ergomake/layerform/pkg/data"
 )
 
+const cloudMaxAttempts = 10
+
+var errCloudConflict = errors.New("definitions were concurrently modified")
+
 type cloudBackend struct {
 	client *cloud.HTTPClient
 }
 
 var _ Backend = &cloudBackend{}
+var _ HistoryKeeper = &cloudBackend{}
 
 func NewCloud(client *cloud.HTTPClient) *cloudBackend {
 	return &cloudBackend{client}
@@ -54,31 +61,90 @@ func (e *cloudBackend) GetLayer(ctx context.Context, name string) (*data.LayerDe
 	return &layer, nil
 }
 
+// GetLayerVersion only finds the current version of layers, cloud contexts
+// do not expose the history of definitions.
+func (e *cloudBackend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	layer, err := e.GetLayer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(layer.SHA, sha) {
+		return nil, errors.Wrapf(ErrNotFound, "version %s of layer %s is not the current one", shortSHA(sha), name)
+	}
+
+	return layer, nil
+}
+
+// ListLayerHistory only returns the current version of the layer, with an
+// unknown configuration time.
+func (e *cloudBackend) ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error) {
+	layer, err := e.GetLayer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.LayerDefinitionVersion{{Definition: layer}}, nil
+}
+
+// ListHistory only returns the current version of every layer, like
+// ListLayerHistory.
+func (e *cloudBackend) ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error) {
+	layers, err := e.ListLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]*data.LayerDefinition{}
+	for _, l := range layers {
+		current[l.Name] = l
+	}
+
+	return flattenHistory(nil, current), nil
+}
+
+func (e *cloudBackend) KeepsHistory() bool {
+	return false
+}
+
+// ImportHistory does nothing, cloud contexts do not keep the history of
+// definitions and only find the current version of layers.
+func (e *cloudBackend) ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error {
+	return nil
+}
+
 func (e *cloudBackend) ListLayers(ctx context.Context) ([]*data.LayerDefinition, error) {
+	layers, _, err := e.listLayers(ctx)
+	return layers, err
+}
+
+// listLayers also returns the ETag the cloud sent for the definitions, which
+// is empty when it does not support conditional configuration.
+func (e *cloudBackend) listLayers(ctx context.Context) ([]*data.LayerDefinition, string, error) {
 	url := "/v1/definitions"
 
 	req, err := e.client.NewRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "fail to create http request to cloud backend")
+		return nil, "", errors.Wrap(err, "fail to create http request to cloud backend")
 	}
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "fail to perform http request to cloud backend")
+		return nil, "", errors.Wrap(err, "fail to perform http request to cloud backend")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("HTTP request to %s failed with status code %d", url, resp.StatusCode)
+		return nil, "", errors.Errorf("HTTP request to %s failed with status code %d", url, resp.StatusCode)
 	}
 
 	var layers []*data.LayerDefinition
 	err = json.NewDecoder(resp.Body).Decode(&layers)
 	if err != nil {
-		return nil, errors.Wrap(err, "fail to decode layers JSON response")
+		return nil, "", errors.Wrap(err, "fail to decode layers JSON response")
 	}
 
-	return layers, nil
+	return layers, resp.Header.Get("ETag"), nil
 }
 
 func (e *cloudBackend) ResolveDependencies(ctx context.Context, layer *data.LayerDefinition) ([]*data.LayerDefinition, error) {
@@ -97,6 +163,12 @@ func (e *cloudBackend) ResolveDependencies(ctx context.Context, layer *data.Laye
 }
 
 func (e *cloudBackend) UpdateLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	return e.updateLayers(ctx, layers, "")
+}
+
+// updateLayers configures layers only if the definitions still have etag,
+// failing with errCloudConflict otherwise. An empty etag always configures.
+func (e *cloudBackend) updateLayers(ctx context.Context, layers []*data.LayerDefinition, etag string) error {
 	dataBytes, err := json.Marshal(layers)
 	if err != nil {
 		return errors.Wrap(err, "fail to marshal layers to json")
@@ -110,15 +182,99 @@ func (e *cloudBackend) UpdateLayers(ctx context.Context, layers []*data.LayerDef
 	}
 
 	req.SetHeader("Content-Type", "application/json")
+	if etag != "" {
+		req.SetHeader("If-Match", etag)
+	}
 	resp, err := e.client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "fail to perform http request to cloud backend")
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return errors.Wrapf(errCloudConflict, "HTTP request to %s failed with status code %d", url, resp.StatusCode)
+	default:
 		return errors.Errorf("HTTP request to %s failed with status code %d", url, resp.StatusCode)
 	}
+}
 
-	return nil
+// modify configures the definitions returned by fn from the current ones.
+// The write is conditional on the definitions not changing in between and
+// fn is retried when they did, unless the cloud sends no ETag, in which case
+// changes made at the same time may be lost.
+func (e *cloudBackend) modify(
+	ctx context.Context,
+	fn func(current []*data.LayerDefinition) ([]*data.LayerDefinition, error),
+) error {
+	logger := hclog.FromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		current, etag, err := e.listLayers(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fail to list current layers")
+		}
+
+		layers, err := fn(current)
+		if err != nil {
+			return err
+		}
+
+		err = e.updateLayers(ctx, layers, etag)
+		if !errors.Is(err, errCloudConflict) {
+			return err
+		}
+
+		if attempt >= cloudMaxAttempts {
+			return errors.Wrapf(err, "fail to configure layers after %d attempts", attempt)
+		}
+
+		logger.Debug("Definitions were concurrently modified, retrying", "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*50) * time.Millisecond):
+		}
+	}
+}
+
+// UpsertLayers configures every current definition plus layers in a single
+// conditional write, see modify.
+func (e *cloudBackend) UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	return e.modify(ctx, func(current []*data.LayerDefinition) ([]*data.LayerDefinition, error) {
+		byName := map[string]bool{}
+		for _, l := range layers {
+			byName[l.Name] = true
+		}
+
+		next := []*data.LayerDefinition{}
+		for _, l := range current {
+			if !byName[l.Name] {
+				next = append(next, l)
+			}
+		}
+
+		return append(next, layers...), nil
+	})
+}
+
+// DeleteLayer configures every current definition but name, like
+// UpsertLayers.
+func (e *cloudBackend) DeleteLayer(ctx context.Context, name string) error {
+	return e.modify(ctx, func(current []*data.LayerDefinition) ([]*data.LayerDefinition, error) {
+		layers := []*data.LayerDefinition{}
+		for _, l := range current {
+			if l.Name != name {
+				layers = append(layers, l)
+			}
+		}
+
+		if len(layers) == len(current) {
+			return nil, errors.Wrapf(ErrNotFound, "fail to delete layer %s", name)
+		}
+
+		return layers, nil
+	})
 }
@@ -0,0 +1,90 @@
+package layerdefinitions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/cloud"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+// fakeCloud serves definitions with an ETag that changes on every write and
+// rejects writes with a stale If-Match. Before the first write is accepted,
+// interfere is configured as if by someone else.
+type fakeCloud struct {
+	mu        sync.Mutex
+	layers    []*data.LayerDefinition
+	version   int
+	interfere *data.LayerDefinition
+	writes    int
+}
+
+func (f *fakeCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	etag := fmt.Sprintf(`"%d"`, f.version)
+	switch r.URL.Path {
+	case "/v1/definitions":
+		w.Header().Set("ETag", etag)
+		_ = json.NewEncoder(w).Encode(f.layers)
+	case "/v1/configure":
+		if f.interfere != nil {
+			f.layers = append(f.layers, f.interfere)
+			f.interfere = nil
+			f.version++
+		}
+
+		if r.Header.Get("If-Match") != fmt.Sprintf(`"%d"`, f.version) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		var layers []*data.LayerDefinition
+		_ = json.NewDecoder(r.Body).Decode(&layers)
+		f.layers = layers
+		f.version++
+		f.writes++
+	}
+}
+
+func TestCloudBackend_UpsertLayers(t *testing.T) {
+	ctx := context.Background()
+	base := &data.LayerDefinition{SHA: []byte("base"), Name: "base"}
+	other := &data.LayerDefinition{SHA: []byte("other"), Name: "other"}
+	app := &data.LayerDefinition{SHA: []byte("app"), Name: "app", Dependencies: []string{"base"}}
+	worker := &data.LayerDefinition{SHA: []byte("worker"), Name: "worker", Dependencies: []string{"app"}}
+
+	fake := &fakeCloud{layers: []*data.LayerDefinition{base}, interfere: other}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	backend := NewCloud(&cloud.HTTPClient{BaseURL: server.URL})
+	require.NoError(t, backend.UpsertLayers(ctx, []*data.LayerDefinition{app, worker}))
+
+	assert.Equal(t, 1, fake.writes, "every layer is configured at once")
+	assert.ElementsMatch(t, []string{"base", "other", "app", "worker"}, names(fake.layers), "concurrent changes are kept")
+
+	require.NoError(t, backend.DeleteLayer(ctx, "other"))
+	assert.ElementsMatch(t, []string{"base", "app", "worker"}, names(fake.layers))
+
+	err := backend.DeleteLayer(ctx, "other")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func names(layers []*data.LayerDefinition) []string {
+	result := make([]string, len(layers))
+	for i, l := range layers {
+		result[i] = l.Name
+	}
+
+	return result
+}
@@ -1,7 +1,12 @@
 package layerdefinitions
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
@@ -15,6 +20,10 @@ const bloblayersVersion = 0
 type fileLikeModel struct {
 	Version uint                             `json:"version"`
 	Layers  map[string]*data.LayerDefinition `json:"layers"`
+	// History has every version configured for each layer, by the hex
+	// encoded sha, current ones included. Layers removed from the layerfile
+	// stay here so their instances can still be killed.
+	History map[string]map[string]*data.LayerDefinitionVersion `json:"history,omitempty"`
 }
 
 type fileLikeBackend struct {
@@ -77,15 +86,175 @@ func (flb *fileLikeBackend) ListLayers(ctx context.Context) ([]*data.LayerDefini
 	return layers, nil
 }
 
+func (flb *fileLikeBackend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Getting layer version", "layer", name, "sha", hex.EncodeToString(sha))
+
+	if layer, ok := flb.data.Layers[name]; ok && bytes.Equal(layer.SHA, sha) {
+		return layer, nil
+	}
+
+	version, ok := flb.data.History[name][hex.EncodeToString(sha)]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "fail to get version %s of layer %s", shortSHA(sha), name)
+	}
+
+	return version.Definition, nil
+}
+
+func (flb *fileLikeBackend) ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing layer history", "layer", name)
+
+	history := make([]*data.LayerDefinitionVersion, 0, len(flb.data.History[name]))
+	for _, v := range flb.data.History[name] {
+		history = append(history, v)
+	}
+
+	return sortHistory(history, flb.data.Layers[name]), nil
+}
+
+func (flb *fileLikeBackend) ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing history of every layer")
+
+	history := map[string][]*data.LayerDefinitionVersion{}
+	for name, versions := range flb.data.History {
+		for _, v := range versions {
+			history[name] = append(history[name], v)
+		}
+	}
+
+	return flattenHistory(history, flb.data.Layers), nil
+}
+
+func (flb *fileLikeBackend) ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error {
+	hclog.FromContext(ctx).Debug("Importing layer history", "count", len(versions))
+
+	description := fmt.Sprintf("Import %d layer definition versions", len(versions))
+	return flb.update(ctx, description, func(model *fileLikeModel, _ time.Time) error {
+		for _, v := range versions {
+			model.record(v.Definition, v.ConfiguredAt)
+		}
+
+		return nil
+	})
+}
+
 func (flb *fileLikeBackend) UpdateLayers(ctx context.Context, layers []*data.LayerDefinition) error {
 	hclog.FromContext(ctx).Debug("Updating layers")
 
-	flb.data.Layers = make(map[string]*data.LayerDefinition)
-	for _, l := range layers {
-		flb.data.Layers[l.Name] = l
+	names := make([]string, len(layers))
+	for i, l := range layers {
+		names[i] = l.Name
+	}
+
+	description := fmt.Sprintf("Update layer definitions: %s", strings.Join(names, ", "))
+	return flb.update(ctx, description, func(model *fileLikeModel, now time.Time) error {
+		next := make(map[string]bool)
+		for _, l := range layers {
+			model.setLayer(l, now)
+			next[l.Name] = true
+		}
+
+		for name := range model.Layers {
+			if !next[name] {
+				delete(model.Layers, name)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (flb *fileLikeBackend) UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	hclog.FromContext(ctx).Debug("Upserting layers", "count", len(layers))
+
+	names := make([]string, len(layers))
+	for i, l := range layers {
+		names[i] = l.Name
+	}
+
+	description := fmt.Sprintf("Upsert layer definitions: %s", strings.Join(names, ", "))
+	return flb.update(ctx, description, func(model *fileLikeModel, now time.Time) error {
+		for _, l := range layers {
+			model.setLayer(l, now)
+		}
+
+		return nil
+	})
+}
+
+func (flb *fileLikeBackend) DeleteLayer(ctx context.Context, name string) error {
+	hclog.FromContext(ctx).Debug("Deleting layer", "layer", name)
+
+	description := fmt.Sprintf("Delete layer definition %s", name)
+	return flb.update(ctx, description, func(model *fileLikeModel, _ time.Time) error {
+		if _, ok := model.Layers[name]; !ok {
+			return errors.Wrapf(ErrNotFound, "fail to delete layer %s", name)
+		}
+
+		// history is kept so instances of the layer can still be killed
+		delete(model.Layers, name)
+		return nil
+	})
+}
+
+// update loads the latest content of the storage, applies fn to it and saves
+// the result, retrying on concurrent modifications.
+func (flb *fileLikeBackend) update(
+	ctx context.Context,
+	description string,
+	fn func(model *fileLikeModel, now time.Time) error,
+) error {
+	ctx = storage.WithChangeDescription(ctx, description)
+	return flb.storage.Update(ctx, func(load storage.LoadFunc) (any, error) {
+		model := fileLikeModel{Version: bloblayersVersion}
+		if err := load(&model); err != nil {
+			return nil, err
+		}
+
+		if model.Layers == nil {
+			model.Layers = map[string]*data.LayerDefinition{}
+		}
+		if model.History == nil {
+			model.History = map[string]map[string]*data.LayerDefinitionVersion{}
+		}
+
+		// layers configured before history was kept have to be recorded
+		// before being replaced, their configuration time is unknown
+		for _, l := range model.Layers {
+			if _, ok := model.History[l.Name][hex.EncodeToString(l.SHA)]; !ok {
+				model.record(l, time.Time{})
+			}
+		}
+
+		if err := fn(&model, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+
+		flb.data = &model
+		return flb.data, nil
+	})
+}
+
+// setLayer makes layer the current definition of its name, recording it in
+// the history when it is a new version.
+func (m *fileLikeModel) setLayer(layer *data.LayerDefinition, now time.Time) {
+	current, ok := m.Layers[layer.Name]
+	if !ok || !bytes.Equal(current.SHA, layer.SHA) {
+		m.record(layer, now)
 	}
 
-	return flb.storage.Save(ctx, flb.data)
+	m.Layers[layer.Name] = layer
+}
+
+func (m *fileLikeModel) record(layer *data.LayerDefinition, configuredAt time.Time) {
+	if m.History[layer.Name] == nil {
+		m.History[layer.Name] = map[string]*data.LayerDefinitionVersion{}
+	}
+
+	m.History[layer.Name][hex.EncodeToString(layer.SHA)] = &data.LayerDefinitionVersion{
+		Definition:   layer,
+		ConfiguredAt: configuredAt,
+	}
 }
 
 func (flb *fileLikeBackend) Location(ctx context.Context) (string, error) {
@@ -2,11 +2,13 @@ package layerdefinitions
 
 import (
 	"context"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ergomake/layerform/internal/storage"
 	"github.com/ergomake/layerform/pkg/data"
 )
 
@@ -96,3 +98,102 @@ func TestFileLikeBackend_ListLayers(t *testing.T) {
 		assert.Empty(t, list)
 	})
 }
+
+func TestFileLikeBackend_History(t *testing.T) {
+	ctx := context.Background()
+	fpath := path.Join(t.TempDir(), "definitions.json")
+
+	backend, err := NewFileLikeBackend(ctx, storage.NewFileStorage(fpath, 0))
+	require.NoError(t, err)
+
+	v1 := &data.LayerDefinition{SHA: []byte("v1"), Name: "layer1"}
+	v2 := &data.LayerDefinition{SHA: []byte("v2"), Name: "layer1"}
+	other := &data.LayerDefinition{SHA: []byte("other"), Name: "layer2"}
+
+	require.NoError(t, backend.UpdateLayers(ctx, []*data.LayerDefinition{v1, other}))
+	require.NoError(t, backend.UpdateLayers(ctx, []*data.LayerDefinition{v2}))
+
+	// history must survive reloading from storage
+	backend, err = NewFileLikeBackend(ctx, storage.NewFileStorage(fpath, 0))
+	require.NoError(t, err)
+
+	current, err := backend.GetLayer(ctx, "layer1")
+	require.NoError(t, err)
+	assert.Equal(t, v2, current)
+
+	old, err := backend.GetLayerVersion(ctx, "layer1", v1.SHA)
+	require.NoError(t, err)
+	assert.Equal(t, v1, old)
+
+	removed, err := backend.GetLayerVersion(ctx, "layer2", other.SHA)
+	require.NoError(t, err, "versions of removed layers are kept")
+	assert.Equal(t, other, removed)
+
+	_, err = backend.GetLayerVersion(ctx, "layer1", []byte("unknown"))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	history, err := backend.ListLayerHistory(ctx, "layer1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, v2, history[0].Definition)
+	assert.Equal(t, v1, history[1].Definition)
+	assert.False(t, history[0].ConfiguredAt.Before(history[1].ConfiguredAt))
+
+	t.Run("reconfiguring the same version keeps its configuration time", func(t *testing.T) {
+		require.NoError(t, backend.UpdateLayers(ctx, []*data.LayerDefinition{v2}))
+
+		again, err := backend.ListLayerHistory(ctx, "layer1")
+		require.NoError(t, err)
+		assert.Equal(t, history, again)
+	})
+
+	t.Run("layers configured before history was kept", func(t *testing.T) {
+		legacy := setup([]*data.LayerDefinition{v1})
+
+		history, err := legacy.ListLayerHistory(ctx, "layer1")
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, v1, history[0].Definition)
+		assert.True(t, history[0].ConfiguredAt.IsZero())
+	})
+}
+
+func TestFileLikeBackend_UpsertAndDelete(t *testing.T) {
+	ctx := context.Background()
+	fpath := path.Join(t.TempDir(), "definitions.json")
+
+	backend, err := NewFileLikeBackend(ctx, storage.NewFileStorage(fpath, 0))
+	require.NoError(t, err)
+
+	v1 := &data.LayerDefinition{SHA: []byte("v1"), Name: "layer1"}
+	v2 := &data.LayerDefinition{SHA: []byte("v2"), Name: "layer1"}
+	other := &data.LayerDefinition{SHA: []byte("other"), Name: "layer2"}
+
+	require.NoError(t, backend.UpdateLayers(ctx, []*data.LayerDefinition{v1, other}))
+	require.NoError(t, backend.UpsertLayers(ctx, []*data.LayerDefinition{v2}))
+
+	layers, err := backend.ListLayers(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*data.LayerDefinition{v2, other}, layers, "other layers are left untouched")
+
+	old, err := backend.GetLayerVersion(ctx, "layer1", v1.SHA)
+	require.NoError(t, err)
+	assert.Equal(t, v1, old)
+
+	require.NoError(t, backend.DeleteLayer(ctx, "layer2"))
+
+	// changes must survive reloading from storage
+	backend, err = NewFileLikeBackend(ctx, storage.NewFileStorage(fpath, 0))
+	require.NoError(t, err)
+
+	layers, err = backend.ListLayers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*data.LayerDefinition{v2}, layers)
+
+	removed, err := backend.GetLayerVersion(ctx, "layer2", other.SHA)
+	require.NoError(t, err, "versions of deleted layers are kept")
+	assert.Equal(t, other, removed)
+
+	err = backend.DeleteLayer(ctx, "layer2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -1,7 +1,10 @@
 package layerdefinitions
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -13,7 +16,106 @@ var ErrNotFound = errors.New("layer not found")
 type Backend interface {
 	ListLayers(ctx context.Context) ([]*data.LayerDefinition, error)
 	GetLayer(ctx context.Context, name string) (*data.LayerDefinition, error)
+	// GetLayerVersion returns the definition of layer name with the given
+	// sha, which may have been replaced since. Fails with ErrNotFound when
+	// that version is unknown.
+	GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error)
+	// ListLayerHistory returns every known version of layer name, the most
+	// recently configured first.
+	ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error)
+	// ListHistory returns every known version of every layer, deleted layers
+	// included, sorted by name and then like ListLayerHistory.
+	ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error)
+	// ImportHistory records versions in the history as they are, replacing
+	// the configuration time of versions already known. Current definitions
+	// are left untouched.
+	ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error
 	ResolveDependencies(ctx context.Context, layer *data.LayerDefinition) ([]*data.LayerDefinition, error)
+	// UpdateLayers replaces every definition with layers.
 	UpdateLayers(ctx context.Context, layers []*data.LayerDefinition) error
+	// UpsertLayers adds each of layers or replaces the definition with the
+	// same name, leaving every other definition untouched. Either every layer
+	// is saved or none is.
+	UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error
+	// DeleteLayer removes the definition of layer name, its history is kept.
+	// Fails with ErrNotFound when there is no such layer.
+	DeleteLayer(ctx context.Context, name string) error
 	Location(ctx context.Context) (string, error)
 }
+
+// HistoryKeeper is implemented by backends that may not keep replaced
+// versions of definitions, ImportHistory drops versions when KeepsHistory is
+// false.
+type HistoryKeeper interface {
+	KeepsHistory() bool
+}
+
+// KeepsHistory reports whether b keeps replaced versions of definitions.
+func KeepsHistory(b Backend) bool {
+	hk, ok := b.(HistoryKeeper)
+	return !ok || hk.KeepsHistory()
+}
+
+// sortHistory orders history from the most to the least recently configured
+// version, adding current when it is missing, which happens for layers that
+// were configured before history was kept.
+func sortHistory(history []*data.LayerDefinitionVersion, current *data.LayerDefinition) []*data.LayerDefinitionVersion {
+	if current != nil {
+		found := false
+		for _, v := range history {
+			if bytes.Equal(v.Definition.SHA, current.SHA) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			history = append(history, &data.LayerDefinitionVersion{Definition: current})
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].ConfiguredAt.Equal(history[j].ConfiguredAt) {
+			return bytes.Compare(history[i].Definition.SHA, history[j].Definition.SHA) < 0
+		}
+
+		return history[i].ConfiguredAt.After(history[j].ConfiguredAt)
+	})
+
+	return history
+}
+
+// flattenHistory sorts the history of every layer with sortHistory and
+// joins them ordered by layer name.
+func flattenHistory(
+	history map[string][]*data.LayerDefinitionVersion,
+	current map[string]*data.LayerDefinition,
+) []*data.LayerDefinitionVersion {
+	names := []string{}
+	for name := range history {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := history[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := []*data.LayerDefinitionVersion{}
+	for _, name := range names {
+		versions := append([]*data.LayerDefinitionVersion{}, history[name]...)
+		result = append(result, sortHistory(versions, current[name])...)
+	}
+
+	return result
+}
+
+func shortSHA(sha []byte) string {
+	s := hex.EncodeToString(sha)
+	if len(s) > 7 {
+		return s[:7]
+	}
+
+	return s
+}
@@ -1,7 +1,10 @@
 package layerdefinitions
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
@@ -10,7 +13,8 @@ import (
 )
 
 type inMemoryBackend struct {
-	layers map[string]*data.LayerDefinition
+	layers  map[string]*data.LayerDefinition
+	history map[string][]*data.LayerDefinitionVersion
 }
 
 var _ Backend = &inMemoryBackend{}
@@ -21,7 +25,7 @@ func NewInMemoryBackend(layersArr []*data.LayerDefinition) *inMemoryBackend {
 		layers[l.Name] = l
 	}
 
-	return &inMemoryBackend{layers}
+	return &inMemoryBackend{layers, map[string][]*data.LayerDefinitionVersion{}}
 }
 
 func (imb *inMemoryBackend) GetLayer(ctx context.Context, name string) (*data.LayerDefinition, error) {
@@ -30,6 +34,56 @@ func (imb *inMemoryBackend) GetLayer(ctx context.Context, name string) (*data.La
 	return imb.layers[name], nil
 }
 
+func (imb *inMemoryBackend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Getting layer version", "layer", name, "sha", hex.EncodeToString(sha))
+
+	if layer, ok := imb.layers[name]; ok && bytes.Equal(layer.SHA, sha) {
+		return layer, nil
+	}
+
+	for _, v := range imb.history[name] {
+		if bytes.Equal(v.Definition.SHA, sha) {
+			return v.Definition, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrNotFound, "fail to get version %s of layer %s", shortSHA(sha), name)
+}
+
+func (imb *inMemoryBackend) ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing layer history", "layer", name)
+
+	history := append([]*data.LayerDefinitionVersion{}, imb.history[name]...)
+	return sortHistory(history, imb.layers[name]), nil
+}
+
+func (imb *inMemoryBackend) ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing history of every layer")
+
+	return flattenHistory(imb.history, imb.layers), nil
+}
+
+func (imb *inMemoryBackend) ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error {
+	hclog.FromContext(ctx).Debug("Importing layer history", "count", len(versions))
+
+	for _, v := range versions {
+		name := v.Definition.Name
+		if current, ok := imb.layers[name]; ok && len(imb.history[name]) == 0 {
+			imb.history[name] = append(imb.history[name], &data.LayerDefinitionVersion{Definition: current})
+		}
+
+		kept := imb.history[name][:0]
+		for _, known := range imb.history[name] {
+			if !bytes.Equal(known.Definition.SHA, v.Definition.SHA) {
+				kept = append(kept, known)
+			}
+		}
+		imb.history[name] = append(kept, &data.LayerDefinitionVersion{Definition: v.Definition, ConfiguredAt: v.ConfiguredAt})
+	}
+
+	return nil
+}
+
 func (imb *inMemoryBackend) ResolveDependencies(ctx context.Context, layer *data.LayerDefinition) ([]*data.LayerDefinition, error) {
 	hclog.FromContext(ctx).Debug("Resolving layer dependencies", "layer", layer.Name)
 	layers := make([]*data.LayerDefinition, len(layer.Dependencies))
@@ -63,14 +117,67 @@ func (imb *inMemoryBackend) ListLayers(ctx context.Context) ([]*data.LayerDefini
 func (imb *inMemoryBackend) UpdateLayers(ctx context.Context, layers []*data.LayerDefinition) error {
 	hclog.FromContext(ctx).Debug("Updating layers")
 
-	imb.layers = make(map[string]*data.LayerDefinition)
+	now := time.Now().UTC()
+	next := make(map[string]*data.LayerDefinition)
 	for _, l := range layers {
+		next[l.Name] = l
+		imb.record(l, now)
+	}
+	imb.layers = next
+
+	return nil
+}
+
+func (imb *inMemoryBackend) UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	hclog.FromContext(ctx).Debug("Upserting layers", "count", len(layers))
+
+	now := time.Now().UTC()
+	for _, l := range layers {
+		imb.record(l, now)
 		imb.layers[l.Name] = l
 	}
 
 	return nil
 }
 
+func (imb *inMemoryBackend) DeleteLayer(ctx context.Context, name string) error {
+	hclog.FromContext(ctx).Debug("Deleting layer", "layer", name)
+
+	current, ok := imb.layers[name]
+	if !ok {
+		return errors.Wrapf(ErrNotFound, "fail to delete layer %s", name)
+	}
+
+	if len(imb.history[name]) == 0 {
+		imb.history[name] = append(imb.history[name], &data.LayerDefinitionVersion{Definition: current})
+	}
+	delete(imb.layers, name)
+
+	return nil
+}
+
+// record adds layer to the history when it is not the current version of its
+// name, the current version is kept in the history with an unknown time when
+// it was configured before history was kept.
+func (imb *inMemoryBackend) record(l *data.LayerDefinition, now time.Time) {
+	current, ok := imb.layers[l.Name]
+	if ok && bytes.Equal(current.SHA, l.SHA) {
+		return
+	}
+
+	if ok && len(imb.history[l.Name]) == 0 {
+		imb.history[l.Name] = append(imb.history[l.Name], &data.LayerDefinitionVersion{Definition: current})
+	}
+
+	versions := imb.history[l.Name][:0]
+	for _, v := range imb.history[l.Name] {
+		if !bytes.Equal(v.Definition.SHA, l.SHA) {
+			versions = append(versions, v)
+		}
+	}
+	imb.history[l.Name] = append(versions, &data.LayerDefinitionVersion{Definition: l, ConfiguredAt: now})
+}
+
 func (imb *inMemoryBackend) Location(ctx context.Context) (string, error) {
 	return "memory", nil
 }
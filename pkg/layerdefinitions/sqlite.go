@@ -0,0 +1,563 @@
+package layerdefinitions
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type sqliteBackend struct {
+	db       *sql.DB
+	location string
+}
+
+var _ Backend = &sqliteBackend{}
+
+// NewSQLiteBackend stores each definition, file and dependency in its own
+// row, db must have been opened with sqlite.Open so the schema is up to date.
+func NewSQLiteBackend(db *sql.DB, location string) *sqliteBackend {
+	return &sqliteBackend{db, location}
+}
+
+func (sb *sqliteBackend) GetLayer(ctx context.Context, name string) (*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Getting layer", "layer", name)
+
+	layers, err := sb.query(ctx, "SELECT "+layerColumns+" FROM layer_definitions WHERE name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(layers) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "fail to get layer %s", name)
+	}
+
+	return layers[0], nil
+}
+
+func (sb *sqliteBackend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Getting layer version", "layer", name, "sha", hex.EncodeToString(sha))
+
+	layers, err := sb.query(ctx, "SELECT "+layerColumns+" FROM layer_definitions WHERE name = ? AND sha = ?", name, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(layers) > 0 {
+		return layers[0], nil
+	}
+
+	history, err := sb.queryHistory(ctx, "WHERE name = ? AND sha = ?", name, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "fail to get version %s of layer %s", shortSHA(sha), name)
+	}
+
+	return history[0].Definition, nil
+}
+
+func (sb *sqliteBackend) ListLayerHistory(ctx context.Context, name string) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing layer history", "layer", name)
+
+	history, err := sb.queryHistory(ctx, "WHERE name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := sb.GetLayer(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	return sortHistory(history, current), nil
+}
+
+func (sb *sqliteBackend) ListHistory(ctx context.Context) ([]*data.LayerDefinitionVersion, error) {
+	hclog.FromContext(ctx).Debug("Listing history of every layer")
+
+	versions, err := sb.queryHistory(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := sb.ListLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history := map[string][]*data.LayerDefinitionVersion{}
+	for _, v := range versions {
+		history[v.Definition.Name] = append(history[v.Definition.Name], v)
+	}
+
+	current := map[string]*data.LayerDefinition{}
+	for _, l := range layers {
+		current[l.Name] = l
+	}
+
+	return flattenHistory(history, current), nil
+}
+
+func (sb *sqliteBackend) ImportHistory(ctx context.Context, versions []*data.LayerDefinitionVersion) error {
+	hclog.FromContext(ctx).Debug("Importing layer history", "count", len(versions))
+
+	tx, err := sb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	for _, v := range versions {
+		err := insertVersion(ctx, tx, "INSERT OR REPLACE", v.Definition, v.ConfiguredAt)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save history of layer %s", v.Definition.Name)
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "fail to commit layer history")
+}
+
+func (sb *sqliteBackend) ResolveDependencies(ctx context.Context, layer *data.LayerDefinition) ([]*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Resolving layer dependencies", "layer", layer.Name)
+	layers := make([]*data.LayerDefinition, len(layer.Dependencies))
+	for i, d := range layer.Dependencies {
+		depLayer, err := sb.GetLayer(ctx, d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to get dependency \"%s\" of layer \"%s\"", d, layer.Name)
+		}
+
+		layers[i] = depLayer
+	}
+
+	return layers, nil
+}
+
+func (sb *sqliteBackend) ListLayers(ctx context.Context) ([]*data.LayerDefinition, error) {
+	hclog.FromContext(ctx).Debug("Listing layers")
+
+	return sb.query(ctx, "SELECT "+layerColumns+" FROM layer_definitions ORDER BY name")
+}
+
+func (sb *sqliteBackend) UpdateLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	hclog.FromContext(ctx).Debug("Updating layers")
+
+	// transactions are immediate, so nothing changes until commit
+	tx, err := sb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	current, err := queryLayers(ctx, tx, "SELECT "+layerColumns+" FROM layer_definitions")
+	if err != nil {
+		return errors.Wrap(err, "fail to list current layers")
+	}
+
+	// layers configured before history was kept have to be recorded before
+	// being replaced, their configuration time is unknown
+	currentSHA := map[string][]byte{}
+	for _, l := range current {
+		currentSHA[l.Name] = l.SHA
+		err := insertVersion(ctx, tx, "INSERT OR IGNORE", l, time.Time{})
+		if err != nil {
+			return errors.Wrapf(err, "fail to save history of layer %s", l.Name)
+		}
+	}
+
+	// files and dependencies are removed by the foreign key cascade
+	_, err = tx.ExecContext(ctx, "DELETE FROM layer_definitions")
+	if err != nil {
+		return errors.Wrap(err, "fail to clear layers")
+	}
+
+	now := time.Now().UTC()
+	for _, l := range layers {
+		err := insertLayer(ctx, tx, l)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save layer %s", l.Name)
+		}
+
+		if sha, ok := currentSHA[l.Name]; !ok || !bytes.Equal(sha, l.SHA) {
+			err := insertVersion(ctx, tx, "INSERT OR REPLACE", l, now)
+			if err != nil {
+				return errors.Wrapf(err, "fail to save history of layer %s", l.Name)
+			}
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "fail to commit layers")
+}
+
+func (sb *sqliteBackend) UpsertLayers(ctx context.Context, layers []*data.LayerDefinition) error {
+	hclog.FromContext(ctx).Debug("Upserting layers", "count", len(layers))
+
+	// transactions are immediate, so nothing changes until commit
+	tx, err := sb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	current, err := queryLayers(ctx, tx, "SELECT "+layerColumns+" FROM layer_definitions")
+	if err != nil {
+		return errors.Wrap(err, "fail to list current layers")
+	}
+
+	currentByName := map[string]*data.LayerDefinition{}
+	for _, l := range current {
+		currentByName[l.Name] = l
+	}
+
+	now := time.Now().UTC()
+	for _, l := range layers {
+		existing, ok := currentByName[l.Name]
+		if ok {
+			err := insertVersion(ctx, tx, "INSERT OR IGNORE", existing, time.Time{})
+			if err != nil {
+				return errors.Wrapf(err, "fail to save history of layer %s", existing.Name)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM layer_definitions WHERE name = ?", l.Name)
+		if err != nil {
+			return errors.Wrapf(err, "fail to remove layer %s", l.Name)
+		}
+
+		err = insertLayer(ctx, tx, l)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save layer %s", l.Name)
+		}
+
+		if !ok || !bytes.Equal(existing.SHA, l.SHA) {
+			err := insertVersion(ctx, tx, "INSERT OR REPLACE", l, now)
+			if err != nil {
+				return errors.Wrapf(err, "fail to save history of layer %s", l.Name)
+			}
+		}
+
+		// a layer given twice is recorded as replacing the first one
+		currentByName[l.Name] = l
+	}
+
+	return errors.Wrap(tx.Commit(), "fail to commit layers")
+}
+
+func (sb *sqliteBackend) DeleteLayer(ctx context.Context, name string) error {
+	hclog.FromContext(ctx).Debug("Deleting layer", "layer", name)
+
+	// transactions are immediate, so nothing changes until commit
+	tx, err := sb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	current, err := queryLayers(ctx, tx, "SELECT "+layerColumns+" FROM layer_definitions WHERE name = ?", name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get layer %s", name)
+	}
+
+	if len(current) == 0 {
+		return errors.Wrapf(ErrNotFound, "fail to delete layer %s", name)
+	}
+
+	// history is kept so instances of the layer can still be killed
+	err = insertVersion(ctx, tx, "INSERT OR IGNORE", current[0], time.Time{})
+	if err != nil {
+		return errors.Wrapf(err, "fail to save history of layer %s", name)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM layer_definitions WHERE name = ?", name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to delete layer %s", name)
+	}
+
+	return errors.Wrap(tx.Commit(), "fail to commit layer deletion")
+}
+
+// layerColumns are the columns of layer_definitions read by query.
+const layerColumns = "name, sha, signature_key_id, signature, terraform"
+
+func insertLayer(ctx context.Context, tx *sql.Tx, layer *data.LayerDefinition) error {
+	var keyID, signature any
+	if layer.Signature != nil {
+		keyID, signature = layer.Signature.KeyID, layer.Signature.Signature
+	}
+
+	var tf any
+	if layer.Terraform != nil {
+		b, err := json.Marshal(layer.Terraform)
+		if err != nil {
+			return errors.Wrap(err, "fail to encode terraform config")
+		}
+		tf = b
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO layer_definitions ("+layerColumns+") VALUES (?, ?, ?, ?, ?)",
+		layer.Name,
+		layer.SHA,
+		keyID,
+		signature,
+		tf,
+	)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range layer.Files {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO layer_definition_files (layer_name, position, path, content) VALUES (?, ?, ?, ?)",
+			layer.Name,
+			i,
+			f.Path,
+			f.Content,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save file %s", f.Path)
+		}
+	}
+
+	for i, m := range layer.Modules {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO layer_definition_modules (layer_name, position, path, content) VALUES (?, ?, ?, ?)",
+			layer.Name,
+			i,
+			m.Path,
+			m.Content,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save module file %s", m.Path)
+		}
+	}
+
+	for i, d := range layer.Dependencies {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO layer_definition_dependencies (layer_name, position, dependency) VALUES (?, ?, ?)",
+			layer.Name,
+			i,
+			d,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save dependency %s", d)
+		}
+	}
+
+	return nil
+}
+
+// insertVersion records layer in the history, verb is either "INSERT OR
+// IGNORE" or "INSERT OR REPLACE" depending on whether an existing entry for
+// the same version should be kept. A zero configuredAt means unknown.
+func insertVersion(ctx context.Context, tx *sql.Tx, verb string, layer *data.LayerDefinition, configuredAt time.Time) error {
+	definition, err := json.Marshal(layer)
+	if err != nil {
+		return errors.Wrap(err, "fail to marshal layer to json")
+	}
+
+	var at int64
+	if !configuredAt.IsZero() {
+		at = configuredAt.UnixNano()
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		verb+" INTO layer_definition_versions (name, sha, definition, configured_at) VALUES (?, ?, ?, ?)",
+		layer.Name,
+		layer.SHA,
+		definition,
+		at,
+	)
+	return err
+}
+
+func (sb *sqliteBackend) queryHistory(ctx context.Context, where string, args ...any) ([]*data.LayerDefinitionVersion, error) {
+	rows, err := sb.db.QueryContext(ctx, "SELECT definition, configured_at FROM layer_definition_versions "+where, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to query layer history")
+	}
+	defer rows.Close()
+
+	history := []*data.LayerDefinitionVersion{}
+	for rows.Next() {
+		var definition []byte
+		var at int64
+		err := rows.Scan(&definition, &at)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to scan layer version")
+		}
+
+		version := &data.LayerDefinitionVersion{}
+		err = json.Unmarshal(definition, &version.Definition)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to decode layer version")
+		}
+
+		if at != 0 {
+			version.ConfiguredAt = time.Unix(0, at).UTC()
+		}
+
+		history = append(history, version)
+	}
+
+	return history, errors.Wrap(rows.Err(), "fail to iterate over layer history")
+}
+
+func (sb *sqliteBackend) Location(ctx context.Context) (string, error) {
+	return sb.location, nil
+}
+
+// querier is either the database or a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (sb *sqliteBackend) query(ctx context.Context, query string, args ...any) ([]*data.LayerDefinition, error) {
+	return queryLayers(ctx, sb.db, query, args...)
+}
+
+// queryLayers reads the layers selected by query with q, query must select
+// layerColumns.
+func queryLayers(ctx context.Context, q querier, query string, args ...any) ([]*data.LayerDefinition, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to query layers")
+	}
+	defer rows.Close()
+
+	layers := make([]*data.LayerDefinition, 0)
+	for rows.Next() {
+		var layer data.LayerDefinition
+		var keyID sql.NullString
+		var signature, tf []byte
+		err := rows.Scan(&layer.Name, &layer.SHA, &keyID, &signature, &tf)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to scan layer")
+		}
+
+		if keyID.Valid {
+			layer.Signature = &data.LayerDefinitionSignature{KeyID: keyID.String, Signature: signature}
+		}
+
+		if tf != nil {
+			err := json.Unmarshal(tf, &layer.Terraform)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fail to decode terraform config of layer %s", layer.Name)
+			}
+		}
+
+		layers = append(layers, &layer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "fail to iterate over layers")
+	}
+	rows.Close()
+
+	for _, layer := range layers {
+		err := loadFiles(ctx, q, layer)
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadModules(ctx, q, layer)
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadDependencies(ctx, q, layer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return layers, nil
+}
+
+func loadFiles(ctx context.Context, q querier, layer *data.LayerDefinition) error {
+	rows, err := q.QueryContext(
+		ctx,
+		"SELECT path, content FROM layer_definition_files WHERE layer_name = ? ORDER BY position",
+		layer.Name,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "fail to query files of layer %s", layer.Name)
+	}
+	defer rows.Close()
+
+	layer.Files = []data.LayerDefinitionFile{}
+	for rows.Next() {
+		var f data.LayerDefinitionFile
+		err := rows.Scan(&f.Path, &f.Content)
+		if err != nil {
+			return errors.Wrap(err, "fail to scan layer file")
+		}
+
+		layer.Files = append(layer.Files, f)
+	}
+
+	return errors.Wrap(rows.Err(), "fail to iterate over layer files")
+}
+
+func loadModules(ctx context.Context, q querier, layer *data.LayerDefinition) error {
+	rows, err := q.QueryContext(
+		ctx,
+		"SELECT path, content FROM layer_definition_modules WHERE layer_name = ? ORDER BY position",
+		layer.Name,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "fail to query modules of layer %s", layer.Name)
+	}
+	defer rows.Close()
+
+	// left nil when there are none, like layers configured without modules
+	for rows.Next() {
+		var m data.LayerDefinitionFile
+		err := rows.Scan(&m.Path, &m.Content)
+		if err != nil {
+			return errors.Wrap(err, "fail to scan layer module file")
+		}
+
+		layer.Modules = append(layer.Modules, m)
+	}
+
+	return errors.Wrap(rows.Err(), "fail to iterate over layer module files")
+}
+
+func loadDependencies(ctx context.Context, q querier, layer *data.LayerDefinition) error {
+	rows, err := q.QueryContext(
+		ctx,
+		"SELECT dependency FROM layer_definition_dependencies WHERE layer_name = ? ORDER BY position",
+		layer.Name,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "fail to query dependencies of layer %s", layer.Name)
+	}
+	defer rows.Close()
+
+	layer.Dependencies = []string{}
+	for rows.Next() {
+		var d string
+		err := rows.Scan(&d)
+		if err != nil {
+			return errors.Wrap(err, "fail to scan layer dependency")
+		}
+
+		layer.Dependencies = append(layer.Dependencies, d)
+	}
+
+	return errors.Wrap(rows.Err(), "fail to iterate over layer dependencies")
+}
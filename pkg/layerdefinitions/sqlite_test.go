@@ -0,0 +1,203 @@
+package layerdefinitions
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/sqlite"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func setupSQLite(t *testing.T) *sqliteBackend {
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "layerform.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return NewSQLiteBackend(db, "sqlite://test")
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	ctx := context.Background()
+	sb := setupSQLite(t)
+
+	base := &data.LayerDefinition{
+		SHA:  []byte("base-sha"),
+		Name: "base",
+		Files: []data.LayerDefinitionFile{
+			{Path: "main.tf", Content: []byte("main")},
+			{Path: "base/vpc.tf", Content: []byte("vpc")},
+		},
+		Dependencies: []string{},
+	}
+	app := &data.LayerDefinition{
+		SHA:          []byte("app-sha"),
+		Name:         "app",
+		Files:        []data.LayerDefinitionFile{{Path: "app.tf", Content: []byte("app")}},
+		Dependencies: []string{"base"},
+		Modules:      []data.LayerDefinitionFile{{Path: "../modules/app/main.tf", Content: []byte("module")}},
+		Terraform:    &data.TerraformConfig{Engine: "tofu", Version: ">= 1.6"},
+	}
+
+	err := sb.UpdateLayers(ctx, []*data.LayerDefinition{base, app})
+	require.NoError(t, err)
+
+	got, err := sb.GetLayer(ctx, "base")
+	require.NoError(t, err)
+	assert.Equal(t, base, got, "files keep their order")
+
+	deps, err := sb.ResolveDependencies(ctx, app)
+	require.NoError(t, err)
+	assert.Equal(t, []*data.LayerDefinition{base}, deps)
+
+	layers, err := sb.ListLayers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*data.LayerDefinition{app, base}, layers)
+
+	t.Run("update replaces every layer", func(t *testing.T) {
+		err := sb.UpdateLayers(ctx, []*data.LayerDefinition{app})
+		require.NoError(t, err)
+
+		_, err = sb.GetLayer(ctx, "base")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = sb.ResolveDependencies(ctx, app)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		var files int
+		err = sb.db.QueryRow("SELECT COUNT(*) FROM layer_definition_files").Scan(&files)
+		require.NoError(t, err)
+		assert.Equal(t, 1, files)
+	})
+
+	t.Run("history keeps replaced versions", func(t *testing.T) {
+		appV2 := &data.LayerDefinition{
+			SHA:          []byte("app-sha-2"),
+			Name:         "app",
+			Files:        []data.LayerDefinitionFile{{Path: "app.tf", Content: []byte("app v2")}},
+			Dependencies: []string{},
+		}
+
+		err := sb.UpdateLayers(ctx, []*data.LayerDefinition{appV2})
+		require.NoError(t, err)
+
+		old, err := sb.GetLayerVersion(ctx, "app", app.SHA)
+		require.NoError(t, err)
+		assert.Equal(t, app, old)
+
+		removed, err := sb.GetLayerVersion(ctx, "base", base.SHA)
+		require.NoError(t, err)
+		assert.Equal(t, base, removed)
+
+		_, err = sb.GetLayerVersion(ctx, "app", []byte("unknown"))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		history, err := sb.ListLayerHistory(ctx, "app")
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, appV2, history[0].Definition)
+		assert.Equal(t, app, history[1].Definition)
+	})
+
+	t.Run("upsert and delete layers", func(t *testing.T) {
+		appV3 := &data.LayerDefinition{
+			SHA:          []byte("app-sha-3"),
+			Name:         "app",
+			Files:        []data.LayerDefinitionFile{{Path: "app.tf", Content: []byte("app v3")}},
+			Dependencies: []string{"base"},
+		}
+		err := sb.UpsertLayers(ctx, []*data.LayerDefinition{base, appV3})
+		require.NoError(t, err)
+
+		layers, err := sb.ListLayers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*data.LayerDefinition{appV3, base}, layers)
+
+		history, err := sb.ListLayerHistory(ctx, "app")
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+		assert.Equal(t, appV3, history[0].Definition)
+
+		err = sb.DeleteLayer(ctx, "app")
+		require.NoError(t, err)
+
+		_, err = sb.GetLayer(ctx, "app")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		deleted, err := sb.GetLayerVersion(ctx, "app", appV3.SHA)
+		require.NoError(t, err, "versions of deleted layers are kept")
+		assert.Equal(t, appV3, deleted)
+
+		err = sb.DeleteLayer(ctx, "app")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("signatures are kept", func(t *testing.T) {
+		signed := &data.LayerDefinition{
+			SHA:          []byte("signed-sha"),
+			Name:         "signed",
+			Files:        []data.LayerDefinitionFile{{Path: "main.tf", Content: []byte("signed")}},
+			Dependencies: []string{},
+			Signature:    &data.LayerDefinitionSignature{KeyID: "0102030405060708", Signature: []byte("signature")},
+		}
+
+		err := sb.UpsertLayers(ctx, []*data.LayerDefinition{signed})
+		require.NoError(t, err)
+
+		got, err := sb.GetLayer(ctx, "signed")
+		require.NoError(t, err)
+		assert.Equal(t, signed, got)
+
+		got, err = sb.GetLayer(ctx, "base")
+		require.NoError(t, err)
+		assert.Nil(t, got.Signature)
+	})
+}
+
+func TestSQLiteBackend_ConcurrentUpserts(t *testing.T) {
+	ctx := context.Background()
+	fpath := filepath.Join(t.TempDir(), "layerform.db")
+
+	// one database handle per process configuring the context
+	backends := make([]*sqliteBackend, 2)
+	for i := range backends {
+		db, err := sqlite.Open(ctx, fpath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		backends[i] = NewSQLiteBackend(db, "sqlite://test")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i, sb := range backends {
+		wg.Add(1)
+		go func(i int, sb *sqliteBackend) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				errs <- sb.UpsertLayers(ctx, []*data.LayerDefinition{
+					{SHA: []byte(fmt.Sprintf("app-%d-%d", i, j)), Name: "app"},
+					{SHA: []byte(fmt.Sprintf("own-%d-%d", i, j)), Name: fmt.Sprintf("own-%d", i)},
+				})
+			}
+		}(i, sb)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	layers, err := backends[0].ListLayers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, layers, 3, "no write is lost")
+
+	history, err := backends[0].ListLayerHistory(ctx, "app")
+	require.NoError(t, err)
+	assert.Len(t, history, 20)
+}
@@ -0,0 +1,108 @@
+package layerdefinitions
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type Verifier interface {
+	Verify(layer *data.LayerDefinition) error
+}
+
+type verifiedBackend struct {
+	Backend
+	verifier Verifier
+}
+
+var _ Backend = &verifiedBackend{}
+
+// NewVerifiedBackend wraps inner so every definition it returns is checked
+// by verifier first, definitions that fail verification are never returned.
+// The history of layers is listed as is since it is only informative.
+func NewVerifiedBackend(inner Backend, verifier Verifier) *verifiedBackend {
+	return &verifiedBackend{inner, verifier}
+}
+
+func (vb *verifiedBackend) KeepsHistory() bool {
+	return KeepsHistory(vb.Backend)
+}
+
+func (vb *verifiedBackend) verify(layers ...*data.LayerDefinition) error {
+	for _, l := range layers {
+		if l == nil {
+			continue
+		}
+
+		err := vb.verifier.Verify(l)
+		if err != nil {
+			return errors.Wrapf(err, "fail to verify layer %s", l.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vb *verifiedBackend) GetLayer(ctx context.Context, name string) (*data.LayerDefinition, error) {
+	layer, err := vb.Backend.GetLayer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vb.verify(layer)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer, nil
+}
+
+func (vb *verifiedBackend) GetLayerVersion(ctx context.Context, name string, sha []byte) (*data.LayerDefinition, error) {
+	layer, err := vb.Backend.GetLayerVersion(ctx, name, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	// a valid signature of another version must not pass for this one
+	if layer == nil || !bytes.Equal(layer.SHA, sha) {
+		return nil, errors.Errorf("backend returned another version of layer %s than %s", name, shortSHA(sha))
+	}
+
+	err = vb.verify(layer)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer, nil
+}
+
+func (vb *verifiedBackend) ListLayers(ctx context.Context) ([]*data.LayerDefinition, error) {
+	layers, err := vb.Backend.ListLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vb.verify(layers...)
+	if err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
+
+func (vb *verifiedBackend) ResolveDependencies(ctx context.Context, layer *data.LayerDefinition) ([]*data.LayerDefinition, error) {
+	layers, err := vb.Backend.ResolveDependencies(ctx, layer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vb.verify(layers...)
+	if err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
@@ -0,0 +1,72 @@
+package layerdefinitions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+var errRefused = errors.New("refused")
+
+type refuseVerifier map[string]bool
+
+func (r refuseVerifier) Verify(layer *data.LayerDefinition) error {
+	if r[layer.Name] {
+		return errRefused
+	}
+
+	return nil
+}
+
+func TestVerifiedBackend(t *testing.T) {
+	ctx := context.Background()
+	base := &data.LayerDefinition{Name: "base", SHA: []byte("base"), Dependencies: []string{}}
+	app := &data.LayerDefinition{Name: "app", SHA: []byte("app"), Dependencies: []string{"base"}}
+	inner := NewInMemoryBackend([]*data.LayerDefinition{base, app})
+
+	vb := NewVerifiedBackend(inner, refuseVerifier{"base": true})
+
+	got, err := vb.GetLayer(ctx, "app")
+	require.NoError(t, err)
+	assert.Equal(t, app, got)
+
+	_, err = vb.GetLayer(ctx, "base")
+	assert.ErrorIs(t, err, errRefused)
+
+	_, err = vb.ResolveDependencies(ctx, app)
+	assert.ErrorIs(t, err, errRefused, "dependencies are verified too")
+
+	_, err = vb.ListLayers(ctx)
+	assert.ErrorIs(t, err, errRefused)
+
+	missing, err := vb.GetLayer(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+type otherVersionBackend struct {
+	Backend
+	layer *data.LayerDefinition
+}
+
+func (b otherVersionBackend) GetLayerVersion(context.Context, string, []byte) (*data.LayerDefinition, error) {
+	return b.layer, nil
+}
+
+func TestVerifiedBackend_GetLayerVersion(t *testing.T) {
+	ctx := context.Background()
+	app := &data.LayerDefinition{Name: "app", SHA: []byte("app"), Dependencies: []string{}}
+	vb := NewVerifiedBackend(otherVersionBackend{layer: app}, refuseVerifier{})
+
+	got, err := vb.GetLayerVersion(ctx, "app", []byte("app"))
+	require.NoError(t, err)
+	assert.Equal(t, app, got)
+
+	_, err = vb.GetLayerVersion(ctx, "app", []byte("pinned"))
+	assert.ErrorContains(t, err, "another version")
+}
@@ -3,18 +3,16 @@ package layerinstances
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pkg/errors"
 
+	"github.com/ergomake/layerform/internal/migrations"
 	"github.com/ergomake/layerform/internal/storage"
 	"github.com/ergomake/layerform/pkg/data"
 )
 
-type version struct {
-	Version uint `json:"version"`
-}
-
 const CURRENT_FILE_LIKE_MODEL_VERSION = 1
 
 type fileLikeModelV0 struct {
@@ -26,49 +24,43 @@ type fileLikeModel struct {
 	Instances []*data.LayerInstance `json:"instances"`
 }
 
-func (f *fileLikeModel) UnmarshalJSON(b []byte) error {
-	f.Version = CURRENT_FILE_LIKE_MODEL_VERSION
-
-	var v version
-	err := json.Unmarshal(b, &v)
-	if err != nil {
-		return err
-	}
-
-	if v.Version == CURRENT_FILE_LIKE_MODEL_VERSION {
-		// need a type alias to avoid infinite recursion
-		type alias fileLikeModel
-		var tmp alias
-
-		err := json.Unmarshal(b, &tmp)
-		if err != nil {
-			return err
-		}
-
-		*f = fileLikeModel(tmp)
-		return nil
-	}
-
-	if v.Version > CURRENT_FILE_LIKE_MODEL_VERSION {
-		return errors.New("instances file was created using a newer version of layerform")
-	}
-
-	if v.Version == 0 {
+// fileLikeModelMigrations upgrade the JSON of the instances file, the element
+// at index N upgrading version N to N+1.
+var fileLikeModelMigrations = []migrations.JSONMigration{
+	func(b []byte) ([]byte, error) {
 		var v0 fileLikeModelV0
 		err := json.Unmarshal(b, &v0)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		f.Instances = make([]*data.LayerInstance, len(v0.States))
+		instances := make([]*data.LayerInstance, len(v0.States))
 		for i, s := range v0.States {
-			f.Instances[i] = s.ToLayerInstance()
+			instances[i] = s.ToLayerInstance()
 		}
 
-		return nil
+		return json.Marshal(fileLikeModel{Version: 1, Instances: instances})
+	},
+}
+
+func (f *fileLikeModel) UnmarshalJSON(b []byte) error {
+	b, err := migrations.UpgradeJSON(b, fileLikeModelMigrations, "instances file")
+	if err != nil {
+		return err
+	}
+
+	// need a type alias to avoid infinite recursion
+	type alias fileLikeModel
+	var tmp alias
+
+	err = json.Unmarshal(b, &tmp)
+	if err != nil {
+		return err
 	}
 
-	return errors.Errorf("got unexpected version %d of instances file", v.Version)
+	*f = fileLikeModel(tmp)
+	f.Version = CURRENT_FILE_LIKE_MODEL_VERSION
+	return nil
 }
 
 type fileLikeBackend struct {
@@ -106,33 +98,65 @@ func (flb *fileLikeBackend) GetInstance(ctx context.Context, layerName, instance
 func (flb *fileLikeBackend) SaveInstance(ctx context.Context, instance *data.LayerInstance) error {
 	hclog.FromContext(ctx).Debug("Saving layer instance", "layer", instance.DefinitionName, "instance", instance.InstanceName)
 
-	nextInstances := []*data.LayerInstance{}
-	for _, s := range flb.model.Instances {
-		if s.DefinitionName != instance.DefinitionName || s.InstanceName != instance.InstanceName {
-			nextInstances = append(nextInstances, s)
+	ctx = storage.WithChangeDescription(ctx, fmt.Sprintf(
+		"Save instance %s of layer %s as %s",
+		instance.InstanceName,
+		instance.DefinitionName,
+		instance.Status,
+	))
+	return flb.update(ctx, func(instances []*data.LayerInstance) []*data.LayerInstance {
+		nextInstances := []*data.LayerInstance{}
+		for _, s := range instances {
+			if s.DefinitionName != instance.DefinitionName || s.InstanceName != instance.InstanceName {
+				nextInstances = append(nextInstances, s)
+			}
 		}
-	}
-
-	nextInstances = append(nextInstances, instance)
-
-	flb.model.Instances = nextInstances
 
-	return flb.storage.Save(ctx, flb.model)
+		return append(nextInstances, instance)
+	})
 }
 
 func (flb *fileLikeBackend) DeleteInstance(ctx context.Context, layerName, instanceName string) error {
 	hclog.FromContext(ctx).Debug("Deleting layer instance", "layer", layerName, "instance", instanceName)
 
-	nextInstances := []*data.LayerInstance{}
-	for _, s := range flb.model.Instances {
-		if s.DefinitionName != layerName || s.InstanceName != instanceName {
-			nextInstances = append(nextInstances, s)
+	ctx = storage.WithChangeDescription(ctx, fmt.Sprintf("Delete instance %s of layer %s", instanceName, layerName))
+	return flb.update(ctx, func(instances []*data.LayerInstance) []*data.LayerInstance {
+		nextInstances := []*data.LayerInstance{}
+		for _, s := range instances {
+			if s.DefinitionName != layerName || s.InstanceName != instanceName {
+				nextInstances = append(nextInstances, s)
+			}
 		}
-	}
 
-	flb.model.Instances = nextInstances
+		return nextInstances
+	})
+}
+
+// update reloads the instances from storage before applying mutate so that
+// instances saved by other processes in the meantime are not lost.
+func (flb *fileLikeBackend) update(
+	ctx context.Context,
+	mutate func([]*data.LayerInstance) []*data.LayerInstance,
+) error {
+	var next *fileLikeModel
+	err := flb.storage.Update(ctx, func(load storage.LoadFunc) (any, error) {
+		model := &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION}
+		err := load(model)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to reload instances")
+		}
+
+		model.Instances = mutate(model.Instances)
+		next = model
+
+		return model, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "fail to update instances")
+	}
 
-	return flb.storage.Save(ctx, flb.model)
+	flb.model = next
+	return nil
 }
 
 func (flb *fileLikeBackend) ListInstancesByLayer(ctx context.Context, layerName string) ([]*data.LayerInstance, error) {
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	storagePkg "github.com/ergomake/layerform/internal/storage"
 	storageMock "github.com/ergomake/layerform/mocks/internal_/storage"
 	"github.com/ergomake/layerform/pkg/data"
 )
@@ -87,6 +88,32 @@ func TestFileLikeBackend_GetInstance(t *testing.T) {
 	})
 }
 
+// mockUpdate makes storage behave as if it contained stored, saved receives
+// whatever the backend writes back.
+func mockUpdate(t *testing.T, stored *fileLikeModel, saved *any) *storageMock.FileLike {
+	storage := storageMock.NewFileLike(t)
+	storage.EXPECT().
+		Update(mock.Anything, mock.Anything).
+		RunAndReturn(func(_ context.Context, fn storagePkg.UpdateFunc) error {
+			next, err := fn(func(v any) error {
+				bs, err := json.Marshal(stored)
+				if err != nil {
+					return err
+				}
+
+				return json.Unmarshal(bs, v)
+			})
+			if err != nil {
+				return err
+			}
+
+			*saved = next
+			return nil
+		})
+
+	return storage
+}
+
 func TestFileLikeBackend_SaveInstance(t *testing.T) {
 	t.Run("adds or update instance correctly", func(t *testing.T) {
 		instance := &data.LayerInstance{
@@ -94,11 +121,9 @@ func TestFileLikeBackend_SaveInstance(t *testing.T) {
 			InstanceName:   "instance1",
 			Bytes:          []byte("data1"),
 		}
-		storage := storageMock.NewFileLike(t)
-		storage.EXPECT().Save(
-			context.Background(),
-			&fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{instance}},
-		).Return(nil)
+
+		var saved any
+		storage := mockUpdate(t, &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION}, &saved)
 
 		fb := &fileLikeBackend{
 			model:   &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION},
@@ -108,12 +133,51 @@ func TestFileLikeBackend_SaveInstance(t *testing.T) {
 		err := fb.SaveInstance(context.Background(), instance)
 		require.NoError(t, err)
 
+		assert.Equal(t, &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{instance}}, saved)
 		assert.Len(t, fb.model.Instances, 1)
 		assert.Equal(t, "layer1", fb.model.Instances[0].DefinitionName)
 		assert.Equal(t, "instance1", fb.model.Instances[0].InstanceName)
 		assert.Equal(t, []byte("data1"), fb.model.Instances[0].Bytes)
 	})
 
+	t.Run("keeps instances saved concurrently by others", func(t *testing.T) {
+		other := &data.LayerInstance{
+			DefinitionName: "layer2",
+			InstanceName:   "instance2",
+			Bytes:          []byte("data2"),
+			Version:        data.CURRENT_INSTANCE_VERSION,
+		}
+		instance := &data.LayerInstance{
+			DefinitionName: "layer1",
+			InstanceName:   "instance1",
+			Bytes:          []byte("data1"),
+			Version:        data.CURRENT_INSTANCE_VERSION,
+		}
+
+		var saved any
+		storage := mockUpdate(
+			t,
+			&fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{other}},
+			&saved,
+		)
+
+		// backend was loaded before other was saved
+		fb := &fileLikeBackend{
+			model:   &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION},
+			storage: storage,
+		}
+
+		err := fb.SaveInstance(context.Background(), instance)
+		require.NoError(t, err)
+
+		expected := &fileLikeModel{
+			Version:   CURRENT_FILE_LIKE_MODEL_VERSION,
+			Instances: []*data.LayerInstance{other, instance},
+		}
+		assert.Equal(t, expected, saved)
+		assert.Equal(t, expected, fb.model)
+	})
+
 	t.Run("fails when fails to save fileLike", func(t *testing.T) {
 		expectedErr := errors.New("rip")
 
@@ -123,10 +187,7 @@ func TestFileLikeBackend_SaveInstance(t *testing.T) {
 			Bytes:          []byte("data1"),
 		}
 		storage := storageMock.NewFileLike(t)
-		storage.EXPECT().Save(
-			context.Background(),
-			&fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{instance}},
-		).Return(expectedErr)
+		storage.EXPECT().Update(mock.Anything, mock.Anything).Return(expectedErr)
 
 		fb := &fileLikeBackend{
 			model:   &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION},
@@ -136,69 +197,57 @@ func TestFileLikeBackend_SaveInstance(t *testing.T) {
 		err := fb.SaveInstance(context.Background(), instance)
 		assert.ErrorIs(t, err, expectedErr)
 
-		assert.Len(t, fb.model.Instances, 1)
-		assert.Equal(t, "layer1", fb.model.Instances[0].DefinitionName)
-		assert.Equal(t, "instance1", fb.model.Instances[0].InstanceName)
-		assert.Equal(t, []byte("data1"), fb.model.Instances[0].Bytes)
+		assert.Empty(t, fb.model.Instances)
 	})
 }
 
 func TestFileLikeBackend_DeleteInstance(t *testing.T) {
-	setup := func() *fileLikeBackend {
+	setup := func() *fileLikeModel {
 		instance1 := &data.LayerInstance{
 			DefinitionName: "layer1",
 			InstanceName:   "instance1",
 			Bytes:          []byte("data1"),
+			Version:        data.CURRENT_INSTANCE_VERSION,
 		}
 
 		instance2 := &data.LayerInstance{
 			DefinitionName: "layer2",
 			InstanceName:   "instance2",
 			Bytes:          []byte("data2"),
+			Version:        data.CURRENT_INSTANCE_VERSION,
 		}
 
-		return &fileLikeBackend{
-			model: &fileLikeModel{
-				Version:   CURRENT_FILE_LIKE_MODEL_VERSION,
-				Instances: []*data.LayerInstance{instance1, instance2},
-			},
+		return &fileLikeModel{
+			Version:   CURRENT_FILE_LIKE_MODEL_VERSION,
+			Instances: []*data.LayerInstance{instance1, instance2},
 		}
 	}
 
 	t.Run("delete existing instance", func(t *testing.T) {
-		flb := setup()
-		instance2 := flb.model.Instances[1]
+		stored := setup()
+		instance2 := stored.Instances[1]
 
-		storage := storageMock.NewFileLike(t)
-		storage.EXPECT().
-			Save(
-				mock.Anything,
-				&fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{flb.model.Instances[1]}},
-			).
-			Return(nil)
-
-		flb.storage = storage
+		var saved any
+		flb := &fileLikeBackend{model: setup(), storage: mockUpdate(t, stored, &saved)}
 
 		err := flb.DeleteInstance(context.Background(), "layer1", "instance1")
 		require.NoError(t, err)
 
+		assert.Equal(t, &fileLikeModel{Version: CURRENT_FILE_LIKE_MODEL_VERSION, Instances: []*data.LayerInstance{instance2}}, saved)
 		assert.Len(t, flb.model.Instances, 1)
 		assert.Equal(t, instance2, flb.model.Instances[0])
 	})
 
 	t.Run("delete non-existent instance", func(t *testing.T) {
-		flb := setup()
-
-		storage := storageMock.NewFileLike(t)
-		storage.EXPECT().
-			Save(mock.Anything, flb.model).
-			Return(nil)
+		stored := setup()
 
-		flb.storage = storage
+		var saved any
+		flb := &fileLikeBackend{model: setup(), storage: mockUpdate(t, stored, &saved)}
 
 		err := flb.DeleteInstance(context.Background(), "nonExistentLayer", "nonExistentInstance")
 		assert.NoError(t, err)
 
+		assert.Equal(t, stored, saved)
 		assert.Len(t, flb.model.Instances, 2)
 	})
 }
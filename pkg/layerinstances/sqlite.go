@@ -0,0 +1,199 @@
+package layerinstances
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+var _ Backend = &sqliteBackend{}
+
+// NewSQLiteBackend stores each instance in its own row, db must have been
+// opened with sqlite.Open so the schema is up to date.
+func NewSQLiteBackend(db *sql.DB) *sqliteBackend {
+	return &sqliteBackend{db}
+}
+
+const selectInstances = `SELECT definition_name, instance_name, definition_sha, bytes, status, version FROM layer_instances`
+
+func (sb *sqliteBackend) GetInstance(ctx context.Context, layerName, instanceName string) (*data.LayerInstance, error) {
+	hclog.FromContext(ctx).Debug("Getting layer instance", "layer", layerName, "instance", instanceName)
+
+	instances, err := sb.query(
+		ctx,
+		selectInstances+" WHERE definition_name = ? AND instance_name = ?",
+		layerName,
+		instanceName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, errors.Wrapf(ErrInstanceNotFound, "instance %s for layer %s not found", instanceName, layerName)
+	}
+
+	return instances[0], nil
+}
+
+func (sb *sqliteBackend) ListInstancesByLayer(ctx context.Context, layerName string) ([]*data.LayerInstance, error) {
+	hclog.FromContext(ctx).Debug("Listing instances by layer", "layer", layerName)
+
+	return sb.query(ctx, selectInstances+" WHERE definition_name = ? ORDER BY instance_name", layerName)
+}
+
+func (sb *sqliteBackend) ListInstances(ctx context.Context) ([]*data.LayerInstance, error) {
+	hclog.FromContext(ctx).Debug("Listing all layers instances")
+
+	return sb.query(ctx, selectInstances+" ORDER BY definition_name, instance_name")
+}
+
+func (sb *sqliteBackend) SaveInstance(ctx context.Context, instance *data.LayerInstance) error {
+	hclog.FromContext(ctx).Debug("Saving layer instance", "layer", instance.DefinitionName, "instance", instance.InstanceName)
+
+	tx, err := sb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO layer_instances (definition_name, instance_name, definition_sha, bytes, status, version)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (definition_name, instance_name) DO UPDATE SET
+			definition_sha = excluded.definition_sha,
+			bytes = excluded.bytes,
+			status = excluded.status,
+			version = excluded.version`,
+		instance.DefinitionName,
+		instance.InstanceName,
+		instance.DefinitionSHA,
+		instance.Bytes,
+		string(instance.Status),
+		data.CURRENT_INSTANCE_VERSION,
+	)
+	if err != nil {
+		return errors.Wrap(err, "fail to save instance")
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM layer_instance_dependencies WHERE definition_name = ? AND instance_name = ?",
+		instance.DefinitionName,
+		instance.InstanceName,
+	)
+	if err != nil {
+		return errors.Wrap(err, "fail to clear instance dependencies")
+	}
+
+	for dep, depInstance := range instance.DependenciesInstance {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO layer_instance_dependencies (definition_name, instance_name, dependency, dependency_instance)
+			VALUES (?, ?, ?, ?)`,
+			instance.DefinitionName,
+			instance.InstanceName,
+			dep,
+			depInstance,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "fail to save instance dependency %s", dep)
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "fail to commit instance")
+}
+
+func (sb *sqliteBackend) DeleteInstance(ctx context.Context, layerName, instanceName string) error {
+	hclog.FromContext(ctx).Debug("Deleting layer instance", "layer", layerName, "instance", instanceName)
+
+	// dependencies are removed by the foreign key cascade
+	_, err := sb.db.ExecContext(
+		ctx,
+		"DELETE FROM layer_instances WHERE definition_name = ? AND instance_name = ?",
+		layerName,
+		instanceName,
+	)
+
+	return errors.Wrap(err, "fail to delete instance")
+}
+
+func (sb *sqliteBackend) query(ctx context.Context, query string, args ...any) ([]*data.LayerInstance, error) {
+	rows, err := sb.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to query instances")
+	}
+	defer rows.Close()
+
+	instances := make([]*data.LayerInstance, 0)
+	for rows.Next() {
+		var instance data.LayerInstance
+		var status string
+		err := rows.Scan(
+			&instance.DefinitionName,
+			&instance.InstanceName,
+			&instance.DefinitionSHA,
+			&instance.Bytes,
+			&status,
+			&instance.Version,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to scan instance")
+		}
+
+		instance.Status = data.LayerInstanceStatus(status)
+		instances = append(instances, &instance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "fail to iterate over instances")
+	}
+	rows.Close()
+
+	for _, instance := range instances {
+		instance.DependenciesInstance, err = sb.getDependencies(ctx, instance.DefinitionName, instance.InstanceName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return instances, nil
+}
+
+func (sb *sqliteBackend) getDependencies(ctx context.Context, layerName, instanceName string) (map[string]string, error) {
+	rows, err := sb.db.QueryContext(
+		ctx,
+		`SELECT dependency, dependency_instance FROM layer_instance_dependencies
+		WHERE definition_name = ? AND instance_name = ?`,
+		layerName,
+		instanceName,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to query dependencies of instance %s of layer %s", instanceName, layerName)
+	}
+	defer rows.Close()
+
+	var deps map[string]string
+	for rows.Next() {
+		var dep, depInstance string
+		err := rows.Scan(&dep, &depInstance)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to scan instance dependency")
+		}
+
+		if deps == nil {
+			deps = map[string]string{}
+		}
+		deps[dep] = depInstance
+	}
+
+	return deps, errors.Wrap(rows.Err(), "fail to iterate over instance dependencies")
+}
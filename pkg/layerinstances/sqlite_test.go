@@ -0,0 +1,97 @@
+package layerinstances
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ergomake/layerform/internal/sqlite"
+	"github.com/ergomake/layerform/pkg/data"
+)
+
+func TestSQLiteBackend(t *testing.T) {
+	ctx := context.Background()
+	fpath := filepath.Join(t.TempDir(), "layerform.db")
+	db, err := sqlite.Open(ctx, fpath)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sb := NewSQLiteBackend(db)
+
+	base := &data.LayerInstance{
+		DefinitionSHA:  []byte("base-sha"),
+		DefinitionName: "base",
+		InstanceName:   "default",
+		Bytes:          []byte("state"),
+		Status:         data.LayerInstanceStatusAlive,
+		Version:        data.CURRENT_INSTANCE_VERSION,
+	}
+	app := &data.LayerInstance{
+		DefinitionSHA:        []byte("app-sha"),
+		DefinitionName:       "app",
+		InstanceName:         "dev",
+		DependenciesInstance: map[string]string{"base": "default"},
+		Bytes:                []byte("state"),
+		Status:               data.LayerInstanceStatusSpawning,
+		Version:              data.CURRENT_INSTANCE_VERSION,
+	}
+
+	require.NoError(t, sb.SaveInstance(ctx, base))
+	require.NoError(t, sb.SaveInstance(ctx, app))
+
+	got, err := sb.GetInstance(ctx, "app", "dev")
+	require.NoError(t, err)
+	assert.Equal(t, app, got)
+
+	t.Run("save updates the existing row", func(t *testing.T) {
+		app.Status = data.LayerInstanceStatusAlive
+		app.DependenciesInstance = map[string]string{"base": "other"}
+		require.NoError(t, sb.SaveInstance(ctx, app))
+
+		instances, err := sb.ListInstancesByLayer(ctx, "app")
+		require.NoError(t, err)
+		assert.Equal(t, []*data.LayerInstance{app}, instances)
+	})
+
+	t.Run("concurrent saves from different connections are all kept", func(t *testing.T) {
+		other, err := sqlite.Open(ctx, fpath)
+		require.NoError(t, err)
+		defer other.Close()
+		backends := []*sqliteBackend{sb, NewSQLiteBackend(other)}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				err := backends[i%2].SaveInstance(ctx, &data.LayerInstance{
+					DefinitionName: "base",
+					InstanceName:   string(rune('a' + i)),
+					Status:         data.LayerInstanceStatusAlive,
+				})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		instances, err := sb.ListInstancesByLayer(ctx, "base")
+		require.NoError(t, err)
+		assert.Len(t, instances, 11)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, sb.DeleteInstance(ctx, "app", "dev"))
+
+		_, err := sb.GetInstance(ctx, "app", "dev")
+		assert.ErrorIs(t, err, ErrInstanceNotFound)
+
+		var deps int
+		err = db.QueryRow("SELECT COUNT(*) FROM layer_instance_dependencies").Scan(&deps)
+		require.NoError(t, err)
+		assert.Equal(t, 0, deps)
+	})
+}